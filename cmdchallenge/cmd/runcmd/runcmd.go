@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"encoding/base64"
 	"errors"
 	"flag"
@@ -8,13 +9,15 @@ import (
 	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
 	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
 	//nolint:gosec,G108
 	_ "net/http/pprof"
 
-	"github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
 	_ "github.com/ncruces/go-sqlite3/driver"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
@@ -25,7 +28,7 @@ import (
 	"gitlab.com/jarv/cmdchallenge/internal/store"
 )
 
-func handleCmd(log *slog.Logger, slug string, cfg *config.Config) error {
+func handleCmd(log *slog.Logger, slug string, cfg *config.Config, stream bool, seed int64) error {
 	if slug == "" {
 		return errors.New("you must provide a slug name for the command runner")
 	}
@@ -38,6 +41,7 @@ func handleCmd(log *slog.Logger, slug string, cfg *config.Config) error {
 	if err != nil {
 		return errors.New("Unable to parse challenge: " + err.Error())
 	}
+	ch = ch.WithSeed(seed)
 
 	decoded, err := base64.StdEncoding.DecodeString(flag.Args()[0])
 	var command string
@@ -46,38 +50,243 @@ func handleCmd(log *slog.Logger, slug string, cfg *config.Config) error {
 	} else {
 		command = string(decoded)
 	}
-	fmt.Println(runcmd.New(log, cfg).Run(ch, command))
+	if stream {
+		// The command output is streamed on stderr, keep it free of logs
+		log = slog.New(slog.DiscardHandler)
+	}
+
+	r := runcmd.New(log, cfg)
+	if stream {
+		r.SetStream(os.Stderr)
+	}
+	fmt.Println(r.Run(ch, command))
+
+	return nil
+}
+
+func handleExport(log *slog.Logger, cfg *config.Config, filter store.ExportFilter) error {
+	if flag.NArg() != 1 {
+		return errors.New("you must specify a file to export to")
+	}
+
+	db, err := store.NewSQLStore(log, metrics.New(log), cfg.DBFile)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Create(flag.Args()[0])
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	n, err := db.ExportResults(f, filter)
+	if err != nil {
+		return err
+	}
+	log.Info("Exported results", "count", n, "file", f.Name())
+	return f.Close()
+}
+
+func handleImport(log *slog.Logger, cfg *config.Config) error {
+	if flag.NArg() != 1 {
+		return errors.New("you must specify a file to import")
+	}
 
+	db, err := store.NewSQLStore(log, metrics.New(log), cfg.DBFile)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(flag.Args()[0])
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	n, err := db.ImportResults(f)
+	if err != nil {
+		return err
+	}
+	log.Info("Imported results", "count", n, "file", f.Name())
+
+	keyed, err := db.BackfillCmdKeys(challenge.NormalizeCmd)
+	if err != nil {
+		return err
+	}
+	log.Info("Backfilled command keys", "count", keyed)
 	return nil
 }
 
+func handleBackup(log *slog.Logger, cfg *config.Config) error {
+	if flag.NArg() != 1 {
+		return errors.New("you must specify a file to back up to")
+	}
+
+	db, err := store.NewSQLStore(log, metrics.New(log), cfg.DBFile)
+	if err != nil {
+		return err
+	}
+
+	return db.Backup(flag.Args()[0])
+}
+
+func exportFilter(slug string, version int, correct string) (store.ExportFilter, error) {
+	filter := store.ExportFilter{Slug: slug, Version: version}
+	if correct != "" {
+		c, err := strconv.ParseBool(correct)
+		if err != nil {
+			return filter, errors.New("correct must be true or false")
+		}
+		filter.Correct = &c
+	}
+	return filter, nil
+}
+
 func handleServer(log *slog.Logger, cfg *config.Config, addr string) {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+
 	cmdMetrics := metrics.New(log)
 	router := mux.NewRouter()
 	runner := challenge.NewRunner(log, cfg)
 
 	var cmdStorer store.CmdStorer
+	var sessionStorer store.SessionStorer
+	var leaderboardStorer store.LeaderboardStorer
+	var eventStorer store.EventStorer
+	var classStorer store.ClassStorer
+	var db *store.DB
 	var err error
 	if cfg.DevMode {
 		cmdStorer, err = store.NewMemStore()
+		memSessions := store.NewMemSessionStore()
+		sessionStorer, leaderboardStorer, eventStorer = memSessions, memSessions, memSessions
+		classStorer = store.NewMemClassStore()
 	} else {
-		cmdStorer, err = store.NewSQLStore(log, cmdMetrics, cfg.DBFile)
+		db, err = store.NewSQLStore(log, cmdMetrics, cfg.DBFile)
+		cmdStorer, sessionStorer, leaderboardStorer, eventStorer, classStorer = db, db, db, db, db
 	}
 	if err != nil {
 		log.Error("Unable to initialize db!", "err", err)
 		return
 	}
 
-	solutions := challenge.NewSolutions(log, cfg, cmdMetrics, cmdStorer)
-	server := challenge.NewServer(log, cfg, cmdMetrics, runner, cmdStorer)
+	if db != nil {
+		// Results stored before commands were normalized are looked up by key
+		keyed, err := db.BackfillCmdKeys(challenge.NormalizeCmd)
+		if err != nil {
+			log.Error("Unable to backfill command keys!", "err", err)
+			return
+		}
+		log.Info("Backfilled command keys", "count", keyed)
+	}
+
+	limiter, err := rateLimitBackend(ctx, log, cfg, db)
+	if err != nil {
+		log.Error("Unable to set up rate limits!", "err", err)
+		return
+	}
+	rateLimit := challenge.NewRateLimit(log, cmdMetrics, limiter)
+
+	if cfg.CacheSize > 0 {
+		log.Info("Caching results in memory", "size", cfg.CacheSize, "flushInterval", cfg.CacheFlushInterval)
+		cmdStorer = store.NewCachedStore(log, cmdMetrics, cmdStorer, cfg.CacheSize, cfg.CacheFlushInterval)
+	}
+
+	var blocklist *challenge.Blocklist
+	if cfg.BlocklistFile != "" {
+		if blocklist, err = challenge.LoadBlocklist(cfg.BlocklistFile); err != nil {
+			log.Error("Unable to load blocklist!", "err", err)
+			return
+		}
+	}
+
+	if err := challenge.ValidateRequires(); err != nil {
+		log.Error("Invalid challenges!", "err", err)
+		return
+	}
+
+	var events []*challenge.Event
+	if cfg.EventsFile != "" {
+		if events, err = challenge.LoadEvents(cfg.EventsFile); err != nil {
+			log.Error("Unable to load events!", "err", err)
+			return
+		}
+	}
+
+	eventBoard := challenge.NewEvents(log, cfg, cmdMetrics, eventStorer, events)
+	daily, err := challenge.NewDaily(log, cfg, cmdMetrics, cmdStorer, blocklist, eventBoard)
+	if err != nil {
+		log.Error("Unable to set up the daily challenge!", "err", err)
+		return
+	}
+
+	solutions := challenge.NewSolutions(log, cfg, cmdMetrics, cmdStorer, blocklist, eventBoard)
+	stats := challenge.NewStats(log, cfg, cmdMetrics, cmdStorer, eventBoard)
+	sessions := challenge.NewSessions(log, cfg, cmdMetrics, sessionStorer, cmdStorer, blocklist)
+	leaderboard := challenge.NewLeaderboard(log, cfg, cmdMetrics, leaderboardStorer, blocklist, eventBoard)
+	classes := challenge.NewClasses(log, cfg, cmdMetrics, classStorer, sessions)
+	server := challenge.NewServer(log, cfg, cmdMetrics, runner, cmdStorer, challenge.ServerOptions{
+		Sessions: sessions,
+		Events:   eventBoard,
+		Classes:  classes,
+		Daily:    daily,
+	})
+	admin := challenge.NewAdmin(log, cfg, cmdMetrics, cmdStorer)
+
+	health := challenge.NewHealth(log, cfg, runner, cmdStorer)
+
+	if cfg.PullImages {
+		health.PullImages(runner.PullImages)
+	}
+
+	if cfg.Revalidate {
+		go revalidate(ctx, log, cfg, cmdMetrics, runner, cmdStorer)
+	}
+
+	go sessions.PruneIdle(ctx)
+
+	clientIP, err := challenge.NewClientIP(cfg.TrustedProxies)
+	if err != nil {
+		log.Error("Unable to parse trusted proxies!", "err", err)
+		return
+	}
 
 	router.Use(cmdMetrics.PrometheusMiddleware)
-	router.PathPrefix("/c/s").Handler(handlers.ProxyHeaders(solutions.Handler()))
-	router.PathPrefix("/c/r").Handler(handlers.ProxyHeaders(server.Handler()))
-	router.Path("/metrics").Handler(handlers.ProxyHeaders(promhttp.Handler()))
-	router.PathPrefix("/debug/pprof/").Handler(http.DefaultServeMux)
+	router.Use(clientIP.Handler)
+	// Registered before /c/s, which would otherwise match them as a prefix
+	router.Path("/c/stats/{slug}").Handler(limit(rateLimit, cfg, "stats", cfg.ReadRateLimit, stats.Handler()))
+	router.Path("/c/session").Handler(limit(rateLimit, cfg, "session", cfg.ReadRateLimit, sessions.SessionHandler()))
+	router.Path("/c/session/handle").Handler(limit(rateLimit, cfg, "session", cfg.ReadRateLimit, sessions.HandleHandler()))
+	router.Path("/c/leaderboard").Handler(limit(rateLimit, cfg, "leaderboard", cfg.ReadRateLimit, leaderboard.Handler()))
+	router.Path("/c/leaderboard/{slug}").Handler(limit(rateLimit, cfg, "leaderboard", cfg.ReadRateLimit, leaderboard.Handler()))
+	router.Path("/c/events").Handler(limit(rateLimit, cfg, "events", cfg.ReadRateLimit, eventBoard.ListHandler()))
+	router.Path("/c/events/{name}/scoreboard").Handler(limit(rateLimit, cfg, "events", cfg.ReadRateLimit, eventBoard.ScoreboardHandler()))
+	router.Path("/c/classes").Handler(limit(rateLimit, cfg, "classes", cfg.ReadRateLimit, classes.CreateHandler()))
+	router.Path("/c/classes/join").Handler(limit(rateLimit, cfg, "classes", cfg.ReadRateLimit, classes.JoinHandler()))
+	router.Path("/c/classes/{id}").Handler(limit(rateLimit, cfg, "classes", cfg.ReadRateLimit, classes.ProgressHandler()))
+	router.Path("/c/classes/{id}/results.csv").Handler(limit(rateLimit, cfg, "classes", cfg.ReadRateLimit, classes.ExportHandler()))
+	router.Path("/c/daily").Handler(limit(rateLimit, cfg, "daily", cfg.ReadRateLimit, daily.Handler()))
+	router.Path("/c/hint/{slug}").Handler(limit(rateLimit, cfg, "hint", cfg.ReadRateLimit, sessions.HintHandler()))
+	router.Path("/c/progress").Handler(limit(rateLimit, cfg, "progress", cfg.ReadRateLimit, sessions.ProgressHandler()))
+	router.Path("/c/progress/import").Handler(limit(rateLimit, cfg, "progress", cfg.ReadRateLimit, sessions.ImportHandler()))
+	router.Path("/c/stream").Handler(limit(rateLimit, cfg, "run", cfg.RunRateLimit, server.StreamHandler()))
+	router.PathPrefix("/c/s").Handler(limit(rateLimit, cfg, "solutions", cfg.ReadRateLimit, solutions.Handler()))
+	router.PathPrefix("/c/r").Handler(limit(rateLimit, cfg, "run", cfg.RunRateLimit, server.Handler()))
+	router.Path("/c/batch").Handler(server.BatchHandler())
 	router.PathPrefix("/").Handler(http.FileServer(http.Dir(cfg.StaticDistDir)))
 
+	// Profiling, metrics, health and admin endpoints are only served on the
+	// admin listener so they can't be exposed by the public proxy
+	adminRouter := mux.NewRouter()
+	adminRouter.Path("/healthz").Handler(health.LiveHandler())
+	adminRouter.Path("/readyz").Handler(health.ReadyHandler())
+	adminRouter.Path("/admin/moderate").Handler(admin.ModerateHandler())
+	adminRouter.Path("/admin/unban").Handler(admin.RequireToken(server.Abuse().UnbanHandler()))
+	adminRouter.Path("/metrics").Handler(admin.RequireTokenIfSet(promhttp.Handler()))
+	adminRouter.PathPrefix("/debug/pprof/").Handler(admin.RequireTokenIfSet(http.DefaultServeMux))
+
 	log.Info("Listening on " + addr)
 
 	srv := http.Server{
@@ -88,19 +297,192 @@ func handleServer(log *slog.Logger, cfg *config.Config, addr string) {
 		ReadHeaderTimeout: 2 * time.Second,
 	}
 
-	if err := srv.ListenAndServe(); err != nil {
+	srvs := []*http.Server{&srv}
+
+	if cfg.AdminAddr != "" {
+		log.Info("Admin listening on " + cfg.AdminAddr)
+		srvs = append(srvs, &http.Server{
+			Handler: adminRouter,
+			Addr:    cfg.AdminAddr,
+			// CPU profiles run for 30 seconds by default
+			WriteTimeout:      2 * time.Minute,
+			ReadTimeout:       15 * time.Second,
+			ReadHeaderTimeout: 2 * time.Second,
+		})
+	}
+
+	serveErr := make(chan error, len(srvs))
+	for _, s := range srvs {
+		go func() {
+			serveErr <- s.ListenAndServe()
+		}()
+	}
+
+	select {
+	case err := <-serveErr:
 		log.Error("Failed to setup listener!", "err", err)
+	case <-ctx.Done():
+		log.Info("Shutting down", "timeout", cfg.ShutdownTimeout)
+	}
+
+	shutdown(log, cfg, srvs, runner, server, cmdStorer)
+}
+
+// rateLimitBackend returns where rate limit buckets are kept, the store
+// backend needs the SQL db so that buckets are shared by every server.
+func rateLimitBackend(ctx context.Context, log *slog.Logger, cfg *config.Config, db *store.DB) (challenge.RateLimitBackend, error) {
+	switch cfg.RateLimitBackend {
+	case config.RateLimitBackendMemory:
+		return challenge.NewMemoryRateLimiter(), nil
+	case config.RateLimitBackendStore:
+		if db == nil {
+			return nil, errors.New("the store rate limit backend requires the SQL store, it isn't available in dev mode")
+		}
+		lmt := challenge.NewStoreRateLimiter(log, db)
+		go lmt.Run(ctx)
+		return lmt, nil
+	default:
+		return nil, fmt.Errorf("unknown rate limit backend %q", cfg.RateLimitBackend)
 	}
 }
 
+// limit applies a rate limit to h when rate limits are enabled, endpoints
+// with the same name share the limit.
+func limit(l *challenge.RateLimit, cfg *config.Config, name string, rl config.RateLimit, h http.Handler) http.Handler {
+	if !cfg.RateLimit {
+		return h
+	}
+
+	msg := "Your are sending requests too fast, slow down!"
+	if name == "run" {
+		msg = "Your are sending command too fast, slow down!"
+	}
+	return l.Handler(name, rl, msg, h)
+}
+
+// shutdown stops accepting requests and waits for the ones in progress,
+// including their container runs, before writing queued submissions and
+// closing the store. Containers of runs that don't finish in time are
+// removed.
+func shutdown(
+	log *slog.Logger,
+	cfg *config.Config,
+	srvs []*http.Server,
+	runner *challenge.Runner,
+	server *challenge.Server,
+	cmdStorer store.CmdStorer,
+) {
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+
+	// The public listener is stopped first so that health checks keep
+	// working while requests drain
+	for _, srv := range srvs {
+		if err := srv.Shutdown(ctx); err != nil {
+			log.Error("Requests did not finish before shutdown", "addr", srv.Addr, "err", err)
+		}
+	}
+
+	if err := runner.Shutdown(ctx); err != nil {
+		log.Error("Unable to remove containers", "err", err)
+	}
+
+	server.Close()
+
+	if err := cmdStorer.Close(); err != nil {
+		log.Error("Unable to close store", "err", err)
+	}
+
+	log.Info("Shutdown complete")
+}
+
+func revalidate(
+	ctx context.Context,
+	log *slog.Logger,
+	cfg *config.Config,
+	m *metrics.Metrics,
+	r challenge.RunnerExecutor,
+	s store.CmdStorer,
+) {
+	chs, err := challenge.AllChallenges()
+	if err != nil {
+		log.Error("Unable to load challenges for revalidation", "err", err)
+		return
+	}
+
+	reports, err := challenge.NewRevalidator(log, cfg, m, r, s).Run(ctx, chs)
+	if err != nil {
+		log.Error("Revalidation failed", "err", err)
+		return
+	}
+
+	for _, report := range reports {
+		if len(report.Failed) > 0 {
+			log.Warn("Previously correct commands fail after version bump",
+				"slug", report.Slug,
+				"fromVersion", report.FromVersion,
+				"toVersion", report.ToVersion,
+				"failed", report.Failed,
+			)
+		}
+	}
+	log.Info("Revalidation finished", "challenges", len(reports))
+}
+
 func main() {
 	devMode := flag.Bool("dev", lookupEnvOrVal("CMD_DEV_MODE", false), "run in development mode")
 	rateLimit := flag.Bool("setRateLimit", lookupEnvOrVal("CMD_SET_RATE_LIMIT", false), "set rate limits")
 	devTag := flag.Bool("devTag", lookupEnvOrVal("CMD_DEV_TAG", false), "use a dev tag for container images")
 	dbFile := flag.String("dbFile", lookupEnvOrVal("CMD_DB_FILE", "/app/db.sqlite3"), "path to the db file")
 	staticDistDir := flag.String("staticDistDir", lookupEnvOrVal("CMD_STATIC_DIST_DIR", "/app/dist"), "path to static files")
+	submissionRetentionDays := flag.Int("submissionRetentionDays",
+		lookupEnvOrVal("CMD_SUBMISSION_RETENTION_DAYS", 90), "days to keep entries in the submissions log")
+	sessionRetentionDays := flag.Int("sessionRetentionDays",
+		lookupEnvOrVal("CMD_SESSION_RETENTION_DAYS", 30), "days to keep idle sessions that have no progress")
+	adminToken := flag.String("adminToken", lookupEnvOrVal("CMD_ADMIN_TOKEN", ""), "bearer token for admin endpoints, disabled if empty")
+	adminAddr := flag.String("adminAddr", lookupEnvOrVal("CMD_ADMIN_ADDR", "127.0.0.1:8182"),
+		"bind address for metrics, pprof, health and admin endpoints, disabled if empty")
+	runRate := flag.Float64("runRate", lookupEnvOrVal("CMD_RUN_RATE", config.DefaultRunRateLimit.PerSec),
+		"commands per second allowed from a client")
+	runBurst := flag.Int("runBurst", lookupEnvOrVal("CMD_RUN_BURST", config.DefaultRunRateLimit.Burst),
+		"commands a client may send at once above the rate")
+	readRate := flag.Float64("readRate", lookupEnvOrVal("CMD_READ_RATE", config.DefaultReadRateLimit.PerSec),
+		"solutions and stats requests per second allowed from a client")
+	readBurst := flag.Int("readBurst", lookupEnvOrVal("CMD_READ_BURST", config.DefaultReadRateLimit.Burst),
+		"solutions and stats requests a client may send at once")
+	abuseThreshold := flag.Int("abuseThreshold", lookupEnvOrVal("CMD_ABUSE_THRESHOLD", 5),
+		"timeouts, runner errors and truncated outputs from a client in 10 minutes before it is banned")
+	hintPenalty := flag.Int("hintPenalty", lookupEnvOrVal("CMD_HINT_PENALTY", 10),
+		"characters added to the command length on leaderboards for each hint used")
+	abuseBanMinutes := flag.Int("abuseBanMinutes", lookupEnvOrVal("CMD_ABUSE_BAN_MINUTES", 15), "minutes a client is banned for")
+	rateLimitBackend := flag.String("rateLimitBackend", lookupEnvOrVal("CMD_RATE_LIMIT_BACKEND", config.RateLimitBackendMemory),
+		"where rate limits are kept, memory for each server or store to share them across servers using the same db")
+	trustedProxies := flag.String("trustedProxies",
+		lookupEnvOrVal("CMD_TRUSTED_PROXIES", strings.Join(config.DefaultTrustedProxies, ",")),
+		"comma separated CIDRs of proxies whose X-Forwarded-For header is trusted")
+	classToken := flag.String("classToken", lookupEnvOrVal("CMD_CLASS_TOKEN", ""),
+		"bearer token for creating classes, classroom mode is disabled if empty")
+	batchToken := flag.String("batchToken", lookupEnvOrVal("CMD_BATCH_TOKEN", ""), "bearer token for the batch endpoint, disabled if empty")
+	pullImages := flag.Bool("pullImages", lookupEnvOrVal("CMD_PULL_IMAGES", true), "pull the command images on startup")
+	revalidateFlag := flag.Bool("revalidate", lookupEnvOrVal("CMD_REVALIDATE", false),
+		"replay correct commands from previous challenge versions on startup")
+	cacheSize := flag.Int("cacheSize", lookupEnvOrVal("CMD_CACHE_SIZE", 10000), "number of results cached in memory, 0 to disable")
+	blocklistFile := flag.String("blocklistFile", lookupEnvOrVal("CMD_BLOCKLIST_FILE", ""),
+		"file with words or regexes that are never published as solutions")
+	dailyTags := flag.String("dailyTags", lookupEnvOrVal("CMD_DAILY_TAGS", ""),
+		"comma separated tags of the challenges the daily challenge is picked from, untagged challenges if empty")
+	dailySeed := flag.Bool("dailySeed", lookupEnvOrVal("CMD_DAILY_SEED", false),
+		"generate the randomized data of the daily challenge from the date")
+	eventsFile := flag.String("eventsFile", lookupEnvOrVal("CMD_EVENTS_FILE", ""), "YAML file with timed competition events")
 	cmd := flag.Bool("cmd", false, "execute a command inside the runner")
-	slug := flag.String("slug", "", "slug for the command executor")
+	stream := flag.Bool("stream", false, "with -cmd, write the command output to stderr while it runs")
+	seed := flag.Int64("seed", 0, "with -cmd, seed for the randomized data of the challenge, random if 0")
+	export := flag.Bool("export", false, "export results to a gzipped JSON lines file")
+	importFlag := flag.Bool("import", false, "import results from a gzipped JSON file")
+	backup := flag.Bool("backup", false, "write a consistent copy of the db to a file")
+	slug := flag.String("slug", "", "slug for the command executor, or to filter exported results")
+	version := flag.Int("version", 0, "challenge version to filter exported results")
+	correct := flag.String("correct", "", "export only correct (true) or incorrect (false) results")
 	addr := flag.String("addr", ":8181", "bind address")
 
 	flag.Parse()
@@ -112,22 +494,71 @@ func main() {
 		DevTag:        *devTag,
 		DBFile:        *dbFile,
 		StaticDistDir: *staticDistDir,
+
+		SubmissionRetentionDays: *submissionRetentionDays,
+		SessionRetentionDays:    *sessionRetentionDays,
+		AdminToken:              *adminToken,
+		BlocklistFile:           *blocklistFile,
+		EventsFile:              *eventsFile,
+		Revalidate:              *revalidateFlag,
+		CacheSize:               *cacheSize,
+		BatchToken:              *batchToken,
+		ClassToken:              *classToken,
+		PullImages:              *pullImages,
+		AdminAddr:               *adminAddr,
+		RunRateLimit:            config.RateLimit{PerSec: *runRate, Burst: *runBurst},
+		ReadRateLimit:           config.RateLimit{PerSec: *readRate, Burst: *readBurst},
+		RateLimitBackend:        *rateLimitBackend,
+		AbuseThreshold:          *abuseThreshold,
+		AbuseBanMinutes:         *abuseBanMinutes,
+		HintPenalty:             *hintPenalty,
+		DailyTags:               strings.FieldsFunc(*dailyTags, func(r rune) bool { return r == ',' }),
+		DailySeed:               *dailySeed,
+		TrustedProxies:          strings.Split(*trustedProxies, ","),
 	})
 
 	if *cmd {
-		if err := handleCmd(log, *slug, cfg); err != nil {
+		if err := handleCmd(log, *slug, cfg, *stream, *seed); err != nil {
 			log.Error("Command failed", "err", err)
 			os.Exit(1)
 		}
 		os.Exit(0)
 	}
 
-	log.Info(fmt.Sprintf("%#v", cfg))
+	if *export {
+		filter, err := exportFilter(*slug, *version, *correct)
+		if err == nil {
+			err = handleExport(log, cfg, filter)
+		}
+		if err != nil {
+			log.Error("Export failed", "err", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	if *importFlag {
+		if err := handleImport(log, cfg); err != nil {
+			log.Error("Import failed", "err", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	if *backup {
+		if err := handleBackup(log, cfg); err != nil {
+			log.Error("Backup failed", "err", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	log.Info(fmt.Sprintf("%#v", cfg.Redacted()))
 	handleServer(log, cfg, *addr)
 }
 
 type envLookup interface {
-	string | int | bool
+	string | int | float64 | bool
 }
 
 func lookupEnvOrVal[T envLookup](key string, defaultVal T) T {
@@ -138,8 +569,14 @@ func lookupEnvOrVal[T envLookup](key string, defaultVal T) T {
 			*p = val
 		case *int:
 			*p, _ = strconv.Atoi(val)
+		case *float64:
+			*p, _ = strconv.ParseFloat(val, 64)
 		case *bool:
-			*p = true
+			// A set variable that isn't a bool enables the flag
+			var err error
+			if *p, err = strconv.ParseBool(val); err != nil {
+				*p = true
+			}
 		}
 		return ret
 	}
@@ -4,6 +4,7 @@ import (
 	"compress/gzip"
 	"encoding/json"
 	"fmt"
+	"log/slog"
 	"os"
 	"strconv"
 	"time"
@@ -64,7 +65,7 @@ func disp(results []string) {
 func main() {
 	cfg := config.New(config.ConfigOpts{})
 	log := newLogger(true)
-	discardLog := logr.Discard()
+	discardLog := slog.New(slog.DiscardHandler)
 
 	type Answer struct {
 		Cmd     string `json:"cmd"`
@@ -0,0 +1,211 @@
+package challenge
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"gitlab.com/jarv/cmdchallenge/internal/config"
+	"gitlab.com/jarv/cmdchallenge/internal/metrics"
+)
+
+// Kinds of runs that count towards a ban, each one used the runner for far
+// longer or produced far more output than a normal command.
+const (
+	AbuseTimeout     = "timeout"
+	AbuseRunnerError = "runner_error"
+	AbuseTruncated   = "truncated"
+)
+
+type jsonUnban struct {
+	Client   string `json:"client"`
+	Unbanned bool   `json:"unbanned"`
+}
+
+type abuseClient struct {
+	events      []time.Time
+	bannedUntil time.Time
+}
+
+// banError is returned for requests of a banned client.
+type banError struct {
+	until      time.Time
+	retryAfter time.Duration
+}
+
+func (e *banError) Error() string {
+	return fmt.Sprintf("%s until %s", ErrServerBanned, e.until.UTC().Format(time.RFC3339))
+}
+
+func (e *banError) Unwrap() error {
+	return ErrServerBanned
+}
+
+// AbuseTracker counts pathological runs of each client over a sliding
+// window and bans clients that reach the threshold for a while. Bans are
+// kept in memory, they don't survive a restart and aren't shared between
+// servers.
+type AbuseTracker struct {
+	log     *slog.Logger
+	cfg     *config.Config
+	metrics *metrics.Metrics
+
+	mu        sync.Mutex
+	clients   map[string]*abuseClient
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+func NewAbuseTracker(log *slog.Logger, cfg *config.Config, m *metrics.Metrics) *AbuseTracker {
+	return &AbuseTracker{
+		log:     log,
+		cfg:     cfg,
+		metrics: m,
+		clients: make(map[string]*abuseClient),
+		now:     time.Now,
+	}
+}
+
+// Check returns ErrServerBanned if the client is banned.
+func (a *AbuseTracker) Check(client string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	c, ok := a.clients[client]
+	if !ok || !a.now().Before(c.bannedUntil) {
+		return nil
+	}
+
+	a.metrics.AbuseRejected.Inc()
+	return &banError{until: c.bannedUntil, retryAfter: c.bannedUntil.Sub(a.now())}
+}
+
+// Record counts a run of the client towards a ban if it was pathological,
+// it is either failed with err or returned resp.
+func (a *AbuseTracker) Record(client string, resp *CmdResponse, err error) {
+	kind := abuseKind(resp, err)
+	if kind == "" {
+		return
+	}
+	a.metrics.AbuseEvents.WithLabelValues(kind).Inc()
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	now := a.now()
+	a.sweep(now)
+
+	c, ok := a.clients[client]
+	if !ok {
+		c = &abuseClient{}
+		a.clients[client] = c
+	}
+	c.events = append(inWindow(c.events, now.Add(-a.cfg.AbuseWindow)), now)
+
+	if len(c.events) < a.cfg.AbuseThreshold {
+		return
+	}
+
+	c.events = nil
+	c.bannedUntil = now.Add(a.cfg.AbuseBanDuration)
+	a.metrics.AbuseBans.Inc()
+	a.log.Warn("Banning client",
+		"client", client,
+		"kind", kind,
+		"until", c.bannedUntil,
+	)
+}
+
+// Unban lifts the ban of a client and forgets its recent runs, it reports
+// whether the client was banned.
+func (a *AbuseTracker) Unban(client string) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	c, ok := a.clients[client]
+	if !ok {
+		return false
+	}
+	delete(a.clients, client)
+
+	return a.now().Before(c.bannedUntil)
+}
+
+// sweep forgets clients that aren't banned and have no runs in the window,
+// at most once a window.
+func (a *AbuseTracker) sweep(now time.Time) {
+	if now.Sub(a.lastSweep) < a.cfg.AbuseWindow {
+		return
+	}
+	a.lastSweep = now
+
+	start := now.Add(-a.cfg.AbuseWindow)
+	for client, c := range a.clients {
+		c.events = inWindow(c.events, start)
+		if len(c.events) == 0 && !now.Before(c.bannedUntil) {
+			delete(a.clients, client)
+		}
+	}
+}
+
+// UnbanHandler lifts the ban of the client posted in the client form value.
+func (a *AbuseTracker) UnbanHandler() http.Handler {
+	return http.HandlerFunc(a.unbanHandler)
+}
+
+func (a *AbuseTracker) unbanHandler(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Cache-Control", "no-store, max-age=0")
+
+	if req.Method != http.MethodPost {
+		a.log.Error("expect POST", "method", req.Method)
+		writeError(w, ErrServerInvalidMethod)
+		return
+	}
+
+	client := req.PostFormValue("client")
+	if client == "" {
+		writeError(w, ErrAdminInvalidClient)
+		return
+	}
+
+	unbanned := a.Unban(client)
+	a.log.Info("Unbanned client", "client", client, "wasBanned", unbanned)
+
+	b, _ := json.Marshal(&jsonUnban{Client: client, Unbanned: unbanned})
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	_, _ = w.Write(b)
+}
+
+// abuseKind returns the kind of pathological run, or an empty string for
+// runs that don't count towards a ban. Cached results never count, they
+// didn't use the runner.
+func abuseKind(resp *CmdResponse, err error) string {
+	var chError *ChallengeError
+	if errors.As(err, &chError) && chError.typ == TypeRunner {
+		if chError.msg == RunnerTimeout {
+			return AbuseTimeout
+		}
+		return AbuseRunnerError
+	}
+
+	if err == nil && resp != nil && resp.Cached != nil && !*resp.Cached &&
+		resp.Truncated != nil && *resp.Truncated {
+		return AbuseTruncated
+	}
+
+	return ""
+}
+
+// inWindow returns the times at or after start, times are in order.
+func inWindow(times []time.Time, start time.Time) []time.Time {
+	for i, t := range times {
+		if !t.Before(start) {
+			return times[i:]
+		}
+	}
+	return nil
+}
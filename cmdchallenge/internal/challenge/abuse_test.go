@@ -0,0 +1,144 @@
+package challenge
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gitlab.com/jarv/cmdchallenge/internal/config"
+	"gitlab.com/jarv/cmdchallenge/internal/metrics"
+	"gitlab.com/jarv/cmdchallenge/internal/store"
+)
+
+var timeoutErr = &ChallengeError{msg: RunnerTimeout, typ: TypeRunner}
+
+func TestAbuseBan(t *testing.T) {
+	abuseCfg := config.New(config.ConfigOpts{AbuseThreshold: 2, AbuseBanMinutes: 1})
+	a := NewAbuseTracker(testLogger(t), abuseCfg, metrics.New(testLogger(t)))
+	now := time.Now()
+	a.now = func() time.Time { return now }
+
+	a.Record("1.1.1.1", nil, timeoutErr)
+	require.NoError(t, a.Check("1.1.1.1"))
+
+	// Runs that don't use the runner for long never count
+	a.Record("1.1.1.1", &fakeResponse, nil)
+	a.Record("1.1.1.1", &CmdResponse{Cached: toPtr(true), Output: toPtr("y"), Truncated: toPtr(true)}, nil)
+	a.Record("1.1.1.1", nil, ErrServerInvalidChallenge)
+	require.NoError(t, a.Check("1.1.1.1"))
+
+	a.Record("1.1.1.1", nil, &ChallengeError{msg: RunnerError, typ: TypeRunner})
+	assert.ErrorIs(t, a.Check("1.1.1.1"), ErrServerBanned)
+	assert.NoError(t, a.Check("2.2.2.2"))
+
+	now = now.Add(time.Minute)
+	assert.NoError(t, a.Check("1.1.1.1"))
+}
+
+func TestAbuseSlidingWindow(t *testing.T) {
+	abuseCfg := config.New(config.ConfigOpts{AbuseThreshold: 2})
+	a := NewAbuseTracker(testLogger(t), abuseCfg, metrics.New(testLogger(t)))
+	now := time.Now()
+	a.now = func() time.Time { return now }
+
+	truncated := &CmdResponse{Cached: toPtr(false), Output: toPtr("y"), Truncated: toPtr(true)}
+	a.Record("1.1.1.1", truncated, nil)
+	now = now.Add(abuseCfg.AbuseWindow + time.Second)
+	a.Record("1.1.1.1", truncated, nil)
+	assert.NoError(t, a.Check("1.1.1.1"))
+
+	a.Record("1.1.1.1", truncated, nil)
+	assert.ErrorIs(t, a.Check("1.1.1.1"), ErrServerBanned)
+}
+
+func TestAbuseBannedRequest(t *testing.T) {
+	stubStore := &StubStor{}
+	stubStore.On(
+		"GetResult",
+		"echo hello world",
+		"hello_world",
+		5,
+	).Return(nil, store.ErrResultNotFound).Times(cfg.AbuseThreshold)
+
+	stubRunnerExecutor := &StubRunnerExecutor{}
+	stubRunnerExecutor.On(
+		"RunContainer",
+		"echo hello world",
+		helloWorldCh(t),
+	).Return((*CmdResponse)(nil), ErrRunnerTimeout).Times(cfg.AbuseThreshold)
+
+	m := metrics.New(testLogger(t))
+	banned := testutil.ToFloat64(m.CmdErrors.WithLabelValues(ErrServerBanned.Error(), TypeServer))
+	s := NewServer(testLogger(t), cfg, m, stubRunnerExecutor, stubStore, ServerOptions{})
+	for range cfg.AbuseThreshold {
+		req, resp := createTestRequest()
+		s.runHandler(resp, req)
+		assert.Equal(t, 504, resp.Code)
+	}
+
+	req, resp := createTestRequest()
+	s.runHandler(resp, req)
+
+	stubStore.AssertExpectations(t)
+	stubRunnerExecutor.AssertExpectations(t)
+	assert.Equal(t, 429, resp.Code)
+	assert.Contains(t, resp.Body.String(), `"code":"client_banned"`)
+	assert.Equal(t, strconv.Itoa(int(cfg.AbuseBanDuration.Seconds())), resp.Header().Get("Retry-After"))
+	// The ban time is left out of the label
+	assert.Equal(t, banned+1, testutil.ToFloat64(m.CmdErrors.WithLabelValues(ErrServerBanned.Error(), TypeServer)))
+
+	// Other clients aren't affected
+	req, resp = createStreamRequest("does_not_exist", "ls")
+	req.RemoteAddr = "2.2.2.2:80"
+	s.streamHandler(resp, req)
+	assert.Equal(t, 400, resp.Code)
+
+	assert.True(t, s.Abuse().Unban("1.1.1.1"))
+	assert.NoError(t, s.Abuse().Check("1.1.1.1"))
+}
+
+func TestUnbanHandler(t *testing.T) {
+	a := NewAbuseTracker(testLogger(t), cfg, metrics.New(testLogger(t)))
+	for range cfg.AbuseThreshold {
+		a.Record("1.1.1.1", nil, timeoutErr)
+	}
+
+	unban := func(client string) *httptest.ResponseRecorder {
+		data := url.Values{}
+		data.Set("client", client)
+		req, _ := http.NewRequest(http.MethodPost, "/admin/unban", strings.NewReader(data.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		resp := httptest.NewRecorder()
+		a.UnbanHandler().ServeHTTP(resp, req)
+		return resp
+	}
+
+	resp := unban("1.1.1.1")
+	assert.Equal(t, 200, resp.Code)
+	assert.Equal(t, `{"client":"1.1.1.1","unbanned":true}`, resp.Body.String())
+	assert.NoError(t, a.Check("1.1.1.1"))
+
+	assert.Equal(t, `{"client":"1.1.1.1","unbanned":false}`, unban("1.1.1.1").Body.String())
+	assert.Equal(t, 400, unban("").Code)
+}
+
+func TestTruncateOutput(t *testing.T) {
+	resp := CmdResponse{Output: toPtr(strings.Repeat("é", MaxOutputLength))}
+	resp.TruncateOutput()
+	assert.LessOrEqual(t, len(*resp.Output), MaxOutputLength)
+	assert.True(t, strings.HasSuffix(*resp.Output, outputTruncatedSuffix))
+	assert.True(t, *resp.Truncated)
+
+	// Output that ends like truncated output isn't flagged
+	resp = CmdResponse{Cached: toPtr(false), Output: toPtr("hello world" + outputTruncatedSuffix)}
+	resp.TruncateOutput()
+	assert.Nil(t, resp.Truncated)
+	assert.Empty(t, abuseKind(&resp, nil))
+}
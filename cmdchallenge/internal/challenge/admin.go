@@ -0,0 +1,161 @@
+package challenge
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"gitlab.com/jarv/cmdchallenge/internal/config"
+	"gitlab.com/jarv/cmdchallenge/internal/metrics"
+	"gitlab.com/jarv/cmdchallenge/internal/store"
+)
+
+type jsonModeration struct {
+	Slug    string `json:"slug"`
+	Version int    `json:"version"`
+	Cmd     string `json:"cmd"`
+	Action  string `json:"action"`
+}
+
+type Admin struct {
+	log       *slog.Logger
+	cfg       *config.Config
+	metrics   *metrics.Metrics
+	cmdStorer store.CmdStorer
+}
+
+func NewAdmin(log *slog.Logger, cfg *config.Config, m *metrics.Metrics, s store.CmdStorer) *Admin {
+	return &Admin{
+		log:       log,
+		cfg:       cfg,
+		metrics:   m,
+		cmdStorer: s,
+	}
+}
+
+func (a *Admin) httpError(w http.ResponseWriter, e error) {
+	a.metrics.CmdErrors.WithLabelValues(errorLabel(e), TypeServer).Inc()
+	writeError(w, e)
+}
+
+// RequireToken only allows requests carrying the configured admin token as a
+// bearer token, admin endpoints are disabled when no token is configured.
+func (a *Admin) RequireToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if a.cfg.AdminToken == "" {
+			a.httpError(w, ErrAdminDisabled)
+			return
+		}
+
+		if !hasBearerToken(req, a.cfg.AdminToken) {
+			a.log.Error("Invalid admin token", "Addr", req.RemoteAddr, "URI", req.RequestURI)
+			a.httpError(w, ErrAdminUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, req)
+	})
+}
+
+// RequireTokenIfSet is like RequireToken when an admin token is configured
+// and lets every request through when it isn't. It protects endpoints that
+// are served on the admin listener only.
+func (a *Admin) RequireTokenIfSet(next http.Handler) http.Handler {
+	if a.cfg.AdminToken == "" {
+		return next
+	}
+	return a.RequireToken(next)
+}
+
+// hasBearerToken reports whether the request carries token as a bearer token.
+func hasBearerToken(req *http.Request, token string) bool {
+	got, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(got), []byte(token)) == 1
+}
+
+func (a *Admin) ModerateHandler() http.Handler {
+	return a.RequireToken(http.HandlerFunc(a.moderateHandler))
+}
+
+func (a *Admin) moderateHandler(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Cache-Control", "no-store, max-age=0")
+
+	if req.Method != http.MethodPost {
+		a.log.Error("expect POST", "method", req.Method)
+		a.httpError(w, ErrServerInvalidMethod)
+		return
+	}
+
+	slug := req.PostFormValue("slug")
+	cmd := req.PostFormValue("cmd")
+	action := req.PostFormValue("action")
+
+	if err := isValidRequest(slug, cmd); err != nil {
+		a.httpError(w, err)
+		return
+	}
+
+	m, err := moderationForAction(action)
+	if err != nil {
+		a.httpError(w, err)
+		return
+	}
+
+	// Without an explicit version moderate the result for the current
+	// version of the challenge
+	var version int
+	if v := req.PostFormValue("version"); v != "" {
+		if version, err = strconv.Atoi(v); err != nil {
+			a.httpError(w, ErrAdminInvalidVersion)
+			return
+		}
+	} else {
+		ch, err := NewChallenge(ChallengeOptions{Slug: slug})
+		if err != nil {
+			a.httpError(w, ErrServerInvalidChallenge)
+			return
+		}
+		version = ch.Version()
+	}
+
+	err = a.cmdStorer.ModerateResult(cmd, slug, version, m)
+	if errors.Is(err, store.ErrResultNotFound) {
+		a.httpError(w, err)
+		return
+	}
+	if err != nil {
+		a.log.Error("Unable to moderate result", "slug", slug, "cmd", cmd, "err", err)
+		a.httpError(w, ErrSolutionsStore)
+		return
+	}
+
+	a.log.Info("Moderated result", "slug", slug, "version", version, "cmd", cmd, "action", action)
+
+	b, _ := json.Marshal(&jsonModeration{
+		Slug:    slug,
+		Version: version,
+		Cmd:     cmd,
+		Action:  action,
+	})
+	fmt.Fprint(w, string(b))
+}
+
+func moderationForAction(action string) (store.Moderation, error) {
+	switch action {
+	case "hide":
+		return store.Moderation{Hidden: toPtr(true)}, nil
+	case "unhide":
+		return store.Moderation{Hidden: toPtr(false)}, nil
+	case "pin":
+		return store.Moderation{Pinned: toPtr(true)}, nil
+	case "unpin":
+		return store.Moderation{Pinned: toPtr(false)}, nil
+	default:
+		return store.Moderation{}, ErrAdminInvalidAction
+	}
+}
@@ -0,0 +1,128 @@
+package challenge
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/jarv/cmdchallenge/internal/config"
+	"gitlab.com/jarv/cmdchallenge/internal/metrics"
+	"gitlab.com/jarv/cmdchallenge/internal/store"
+)
+
+var adminCfg = config.New(config.ConfigOpts{AdminToken: "secret"})
+
+func TestModerate(t *testing.T) {
+	stubStore := &StubStor{}
+	stubStore.On(
+		"ModerateResult",
+		"echo hello world",
+		"hello_world",
+		5,
+		store.Moderation{Hidden: toPtr(true)},
+	).Return(nil).Once()
+
+	req, resp := createModerateRequest("hide", "secret")
+	NewAdmin(testLogger(t), adminCfg, metrics.New(testLogger(t)), stubStore).ModerateHandler().ServeHTTP(resp, req)
+
+	stubStore.AssertExpectations(t)
+	assert.Equal(t, `{"slug":"hello_world","version":5,"cmd":"echo hello world","action":"hide"}`, resp.Body.String())
+	assert.Equal(t, 200, resp.Code)
+}
+
+func TestModerateNotFound(t *testing.T) {
+	stubStore := &StubStor{}
+	stubStore.On(
+		"ModerateResult",
+		"echo hello world",
+		"hello_world",
+		5,
+		store.Moderation{Pinned: toPtr(true)},
+	).Return(store.ErrResultNotFound).Once()
+
+	req, resp := createModerateRequest("pin", "secret")
+	NewAdmin(testLogger(t), adminCfg, metrics.New(testLogger(t)), stubStore).ModerateHandler().ServeHTTP(resp, req)
+
+	stubStore.AssertExpectations(t)
+	assert.Equal(t, 404, resp.Code)
+}
+
+func TestModerateInvalidAction(t *testing.T) {
+	stubStore := &StubStor{}
+
+	req, resp := createModerateRequest("delete", "secret")
+	NewAdmin(testLogger(t), adminCfg, metrics.New(testLogger(t)), stubStore).ModerateHandler().ServeHTTP(resp, req)
+
+	stubStore.AssertExpectations(t)
+	assert.Equal(t, 400, resp.Code)
+}
+
+func TestModerateAuth(t *testing.T) {
+	testCases := []struct {
+		name  string
+		cfg   *config.Config
+		token string
+		want  int
+	}{
+		{name: "disabled without a configured token", cfg: cfg, token: "", want: 403},
+		{name: "missing token", cfg: adminCfg, token: "", want: 401},
+		{name: "wrong token", cfg: adminCfg, token: "guess", want: 401},
+	}
+
+	for _, tt := range testCases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			stubStore := &StubStor{}
+			req, resp := createModerateRequest("hide", tt.token)
+			NewAdmin(testLogger(t), tt.cfg, metrics.New(testLogger(t)), stubStore).ModerateHandler().ServeHTTP(resp, req)
+
+			stubStore.AssertExpectations(t)
+			assert.Equal(t, tt.want, resp.Code)
+		})
+	}
+}
+
+func createModerateRequest(action, token string) (*http.Request, *httptest.ResponseRecorder) {
+	data := url.Values{}
+	data.Set("cmd", "echo hello world")
+	data.Set("slug", "hello_world")
+	data.Set("action", action)
+	req, _ := http.NewRequest(http.MethodPost, "/admin/moderate", strings.NewReader(data.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	req.RemoteAddr = "1.1.1.1:80"
+
+	return req, httptest.NewRecorder()
+}
+
+func TestRequireTokenIfSet(t *testing.T) {
+	testCases := []struct {
+		name  string
+		cfg   *config.Config
+		token string
+		want  int
+	}{
+		{name: "open without a configured token", cfg: cfg, token: "", want: 200},
+		{name: "missing token", cfg: adminCfg, token: "", want: 401},
+		{name: "valid token", cfg: adminCfg, token: "secret", want: 200},
+	}
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {})
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodGet, "/metrics", http.NoBody)
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			resp := httptest.NewRecorder()
+
+			NewAdmin(testLogger(t), tt.cfg, metrics.New(testLogger(t)), &StubStor{}).RequireTokenIfSet(ok).ServeHTTP(resp, req)
+
+			assert.Equal(t, tt.want, resp.Code)
+		})
+	}
+}
@@ -0,0 +1,41 @@
+package challenge
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+)
+
+const rateLimitedCode = "rate_limited"
+
+type jsonErrorBody struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+type jsonError struct {
+	Error jsonErrorBody `json:"error"`
+}
+
+func jsonErrorMessage(code, msg string) string {
+	b, _ := json.Marshal(&jsonError{Error: jsonErrorBody{Code: code, Message: msg}})
+	return string(b)
+}
+
+// writeError replies with a JSON error envelope and the status code that
+// belongs to the error.
+func writeError(w http.ResponseWriter, e error) {
+	code, status := codeForError(e)
+
+	var ban *banError
+	if errors.As(e, &ban) {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(ban.retryAfter.Seconds()))))
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	_, _ = w.Write([]byte(jsonErrorMessage(code, e.Error())))
+}
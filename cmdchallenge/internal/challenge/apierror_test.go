@@ -0,0 +1,55 @@
+package challenge
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/jarv/cmdchallenge/internal/store"
+)
+
+func TestCodeForError(t *testing.T) {
+	tests := []struct {
+		err    error
+		code   string
+		status int
+	}{
+		{ErrServerInvalidRequest, "invalid_request", http.StatusBadRequest},
+		{ErrServerCmdTooLong, "cmd_too_long", http.StatusBadRequest},
+		{ErrServerInvalidMethod, "invalid_method", http.StatusMethodNotAllowed},
+		{ErrSolutionsInvalidParam, "invalid_param", http.StatusBadRequest},
+		{ErrAdminUnauthorized, "unauthorized", http.StatusUnauthorized},
+		{fmt.Errorf("wrapped: %w", store.ErrResultNotFound), "not_found", http.StatusNotFound},
+		{&ChallengeError{msg: RunnerTimeout, typ: TypeRunner}, "runner_timeout", http.StatusGatewayTimeout},
+		{&ChallengeError{msg: RunnerError, typ: TypeRunner}, "runner_error", http.StatusInternalServerError},
+		{&ChallengeError{msg: StoreQueryError, typ: TypeStore}, "store_error", http.StatusInternalServerError},
+		{errors.New("something else"), "unknown_error", http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		code, status := codeForError(tt.err)
+		assert.Equal(t, tt.code, code, tt.err.Error())
+		assert.Equal(t, tt.status, status, tt.err.Error())
+	}
+}
+
+func TestErrorLabel(t *testing.T) {
+	tests := []struct {
+		err   error
+		label string
+	}{
+		{ErrServerInvalidRequest, ErrServerInvalidRequest.Error()},
+		{&banError{until: time.Now()}, ErrServerBanned.Error()},
+		{fmt.Errorf("%w, solve hello_world first", ErrServerChallengeLocked), ErrServerChallengeLocked.Error()},
+		{&ChallengeError{msg: RunnerTimeout, typ: TypeRunner}, RunnerTimeout},
+		{fmt.Errorf("wrapped: %w", errors.New("something else")), ErrServerUnknown.Error()},
+		{errors.New("something else"), "something else"},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.label, errorLabel(tt.err), tt.err.Error())
+	}
+}
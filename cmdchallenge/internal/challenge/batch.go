@@ -0,0 +1,141 @@
+package challenge
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// BatchRequest is the body accepted by the batch endpoint.
+type BatchRequest struct {
+	Items []CmdRequest `json:"items"`
+}
+
+// BatchResult is the outcome of a single item of a batch, exactly one of
+// Result or Error is set.
+type BatchResult struct {
+	Slug   string         `json:"slug"`
+	Cmd    string         `json:"cmd"`
+	Result *CmdResponse   `json:"result,omitempty"`
+	Error  *jsonErrorBody `json:"error,omitempty"`
+}
+
+type jsonBatch struct {
+	Results []BatchResult `json:"results"`
+}
+
+// BatchHandler grades many commands in one request for trusted clients. It
+// isn't rate limited and requires the configured batch token, items go
+// through the same result cache and runner as single commands.
+func (c *Server) BatchHandler() http.Handler {
+	return http.HandlerFunc(c.batchHandler)
+}
+
+func (c *Server) batchHandler(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Cache-Control", "no-store, max-age=0")
+
+	if c.cfg.BatchToken == "" {
+		c.httpError(w, ErrBatchDisabled)
+		return
+	}
+
+	if !hasBearerToken(req, c.cfg.BatchToken) {
+		c.log.Error("Invalid batch token", "Addr", req.RemoteAddr, "URI", req.RequestURI)
+		c.httpError(w, ErrBatchUnauthorized)
+		return
+	}
+
+	if req.Method != http.MethodPost {
+		c.log.Error("expect POST", "method", req.Method)
+		c.httpError(w, ErrServerInvalidMethod)
+		return
+	}
+
+	var batchReq BatchRequest
+
+	maxBytes := int64(maxRequestBodyBytes * c.cfg.BatchMaxItems)
+	dec := json.NewDecoder(http.MaxBytesReader(w, req.Body, maxBytes))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&batchReq); err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			c.httpError(w, ErrBatchTooLarge)
+			return
+		}
+		c.httpError(w, ErrServerInvalidBody)
+		return
+	}
+
+	if len(batchReq.Items) == 0 {
+		c.httpError(w, ErrBatchEmpty)
+		return
+	}
+	if len(batchReq.Items) > c.cfg.BatchMaxItems {
+		c.httpError(w, ErrBatchTooLarge)
+		return
+	}
+
+	c.log.Info("Batch request received",
+		"items", len(batchReq.Items),
+		"Addr", req.RemoteAddr,
+	)
+
+	// A batch can take much longer than a single command, allow enough time
+	// for every round of commands to time out
+	rounds := (len(batchReq.Items) + c.cfg.BatchConcurrency - 1) / c.cfg.BatchConcurrency
+	deadline := time.Now().Add(time.Duration(rounds+1) * c.cfg.RunCmdTimeout)
+	if err := http.NewResponseController(w).SetWriteDeadline(deadline); err != nil {
+		c.log.Warn("Unable to extend write deadline for batch", "err", err)
+	}
+
+	b, err := json.Marshal(&jsonBatch{Results: c.runBatch(batchReq.Items, req.RemoteAddr)})
+	if err != nil {
+		c.httpError(w, ErrServerDecode)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	_, _ = w.Write(b)
+}
+
+// runBatch runs the items with at most BatchConcurrency commands at a time,
+// results are returned in the same order as the items.
+func (c *Server) runBatch(items []CmdRequest, remoteAddr string) []BatchResult {
+	results := make([]BatchResult, len(items))
+	sem := make(chan struct{}, c.cfg.BatchConcurrency)
+
+	var wg sync.WaitGroup
+	for i, item := range items {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			results[i] = c.runBatchItem(item, remoteAddr)
+		}()
+	}
+	wg.Wait()
+
+	return results
+}
+
+func (c *Server) runBatchItem(item CmdRequest, remoteAddr string) BatchResult {
+	result := BatchResult{Slug: item.Slug, Cmd: item.Cmd}
+
+	cmd, err := item.decodedCmd()
+	if err == nil {
+		result.Cmd = cmd
+		result.Result, err = c.submit(item.Slug, cmd, remoteAddr, player{})
+	}
+
+	if err != nil {
+		c.countError(err)
+		code, _ := codeForError(err)
+		result.Result = nil
+		result.Error = &jsonErrorBody{Code: code, Message: err.Error()}
+	}
+
+	return result
+}
@@ -0,0 +1,129 @@
+package challenge
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gitlab.com/jarv/cmdchallenge/internal/config"
+	"gitlab.com/jarv/cmdchallenge/internal/metrics"
+	"gitlab.com/jarv/cmdchallenge/internal/store"
+)
+
+var batchCfg = config.New(config.ConfigOpts{BatchToken: "secret"})
+
+func TestBatch(t *testing.T) {
+	stubStore := &StubStor{}
+	stubStore.On(
+		"GetResult",
+		"echo hello world",
+		"hello_world",
+		5,
+	).Return(&fakeStore, nil).Twice()
+
+	stubStore.On(
+		"IncrementResult",
+		"echo hello world",
+		"hello_world",
+		5,
+	).Return(nil).Twice()
+
+	body := `{"items":[` +
+		`{"slug":"hello_world","cmd":"echo hello world"},` +
+		`{"slug":"hello_world","cmd":"ZWNobyBoZWxsbyB3b3JsZA==","encoding":"base64"},` +
+		`{"slug":"does_not_exist","cmd":"ls"}` +
+		`]}`
+	req, resp := createBatchRequest(body, "secret")
+	s := NewServer(testLogger(t), batchCfg, metrics.New(testLogger(t)), &StubRunnerExecutor{}, stubStore, ServerOptions{})
+	s.BatchHandler().ServeHTTP(resp, req)
+
+	stubStore.AssertExpectations(t)
+	require.Equal(t, 200, resp.Code)
+
+	var batch jsonBatch
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &batch))
+	require.Len(t, batch.Results, 3)
+
+	for _, r := range batch.Results[:2] {
+		assert.Equal(t, "echo hello world", r.Cmd)
+		assert.Nil(t, r.Error)
+		assert.True(t, *r.Result.Correct)
+	}
+
+	assert.Nil(t, batch.Results[2].Result)
+	assert.Equal(t, "invalid_challenge", batch.Results[2].Error.Code)
+}
+
+func TestBatchRunsUncached(t *testing.T) {
+	stubStore := &StubStor{}
+	stubStore.On(
+		"GetResult",
+		"echo hello world",
+		"hello_world",
+		5,
+	).Return(nil, store.ErrResultNotFound).Once()
+
+	stubStore.On("CreateResult", &fakeStore).Return(nil).Once()
+
+	stubStore.On(
+		"IncrementResult",
+		"echo hello world",
+		"hello_world",
+		5,
+	).Return(nil).Once()
+
+	stubRunnerExecutor := &StubRunnerExecutor{}
+	stubRunnerExecutor.On(
+		"RunContainer",
+		"echo hello world",
+		helloWorldCh(t),
+	).Return(&fakeResponse, nil).Once()
+
+	req, resp := createBatchRequest(`{"items":[{"slug":"hello_world","cmd":"echo hello world"}]}`, "secret")
+	s := NewServer(testLogger(t), batchCfg, metrics.New(testLogger(t)), stubRunnerExecutor, stubStore, ServerOptions{})
+	s.BatchHandler().ServeHTTP(resp, req)
+
+	stubStore.AssertExpectations(t)
+	stubRunnerExecutor.AssertExpectations(t)
+	assert.Equal(t, `{"results":[{"slug":"hello_world","cmd":"echo hello world","result":`+
+		`{"Cached":false,"Correct":true,"ExitCode":0,"Output":"hello world"}}]}`, resp.Body.String())
+}
+
+func TestBatchInvalid(t *testing.T) {
+	tooMany := `{"items":[` + strings.Repeat(`{"slug":"hello_world","cmd":"ls"},`, batchCfg.BatchMaxItems) +
+		`{"slug":"hello_world","cmd":"ls"}]}`
+
+	tests := []struct {
+		cfg    *config.Config
+		body   string
+		token  string
+		status int
+	}{
+		{cfg, `{"items":[]}`, "secret", http.StatusForbidden},
+		{batchCfg, `{"items":[]}`, "wrong", http.StatusUnauthorized},
+		{batchCfg, `{"items":[]}`, "secret", http.StatusBadRequest},
+		{batchCfg, `{"items":`, "secret", http.StatusBadRequest},
+		{batchCfg, tooMany, "secret", http.StatusRequestEntityTooLarge},
+	}
+
+	for _, tt := range tests {
+		req, resp := createBatchRequest(tt.body, tt.token)
+		s := NewServer(testLogger(t), tt.cfg, metrics.New(testLogger(t)), &StubRunnerExecutor{}, &StubStor{}, ServerOptions{})
+		s.BatchHandler().ServeHTTP(resp, req)
+
+		assert.Equal(t, tt.status, resp.Code, resp.Body.String())
+	}
+}
+
+func createBatchRequest(body, token string) (*http.Request, *httptest.ResponseRecorder) {
+	req, _ := http.NewRequest(http.MethodPost, "/c/batch", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.RemoteAddr = "1.1.1.1:80"
+
+	return req, httptest.NewRecorder()
+}
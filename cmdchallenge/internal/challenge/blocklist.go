@@ -0,0 +1,64 @@
+package challenge
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// Blocklist holds case-insensitive patterns for text that must never be
+// published, it is checked before solutions are returned to users.
+type Blocklist struct {
+	patterns []*regexp.Regexp
+}
+
+func NewBlocklist(patterns []string) (*Blocklist, error) {
+	b := &Blocklist{}
+	for _, p := range patterns {
+		re, err := regexp.Compile("(?i)" + p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid blocklist pattern %q: %w", p, err)
+		}
+		b.patterns = append(b.patterns, re)
+	}
+	return b, nil
+}
+
+// LoadBlocklist reads one word or regular expression per line, blank lines
+// and lines starting with # are ignored.
+func LoadBlocklist(fname string) (*Blocklist, error) {
+	f, err := os.Open(fname) // #nosec G304
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var patterns []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		patterns = append(patterns, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return NewBlocklist(patterns)
+}
+
+func (b *Blocklist) Matches(s string) bool {
+	if b == nil {
+		return false
+	}
+	for _, re := range b.patterns {
+		if re.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
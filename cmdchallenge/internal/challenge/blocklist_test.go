@@ -0,0 +1,34 @@
+package challenge
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBlocklistMatches(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "blocklist.txt")
+	require.NoError(t, os.WriteFile(fname, []byte("# comment\n\nbadword\nrm\\s+-rf\n"), 0o600))
+
+	bl, err := LoadBlocklist(fname)
+	require.NoError(t, err)
+
+	assert.False(t, bl.Matches("echo hello world"))
+	assert.True(t, bl.Matches("echo BadWord"))
+	assert.True(t, bl.Matches("ls # badword"))
+	assert.True(t, bl.Matches("rm  -rf /"))
+	assert.False(t, bl.Matches("rm file"))
+}
+
+func TestBlocklistNil(t *testing.T) {
+	var bl *Blocklist
+	assert.False(t, bl.Matches("echo badword"))
+}
+
+func TestBlocklistInvalidPattern(t *testing.T) {
+	_, err := NewBlocklist([]string{"("})
+	assert.Error(t, err)
+}
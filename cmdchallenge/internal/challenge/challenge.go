@@ -30,10 +30,14 @@ type ChInfo struct {
 		Lines             *[]string `yaml:"lines,omitempty"`
 	} `yaml:"expected_output,omitempty"`
 	ExpectedFailures *[]string `yaml:"expected_failures,omitempty"`
+	Tags             *[]string `yaml:"tags,omitempty"`
+	Requires         *[]string `yaml:"requires,omitempty"`
+	Hints            *[]string `yaml:"hints,omitempty"`
 }
 
 type Challenge struct {
 	chInfo *ChInfo
+	seed   int64
 }
 
 //go:embed challenges.yaml
@@ -66,6 +70,75 @@ func NewChallenge(opt ChallengeOptions) (*Challenge, error) {
 	return nil, fmt.Errorf("unable to find challenge for slug %s", opt.Slug)
 }
 
+// AllChallenges returns every challenge defined in the embedded YAML.
+func AllChallenges() ([]*Challenge, error) {
+	var challenges []ChInfo
+
+	if err := yaml.Unmarshal([]byte(challengesYAML), &challenges); err != nil {
+		return nil, err
+	}
+
+	chs := make([]*Challenge, 0, len(challenges))
+	for _, c := range challenges {
+		c := c
+		chs = append(chs, &Challenge{chInfo: &c})
+	}
+	return chs, nil
+}
+
+// ValidateRequires checks that the challenges only require challenges that
+// exist and that no challenge requires itself, directly or not.
+func ValidateRequires() error {
+	chs, err := AllChallenges()
+	if err != nil {
+		return err
+	}
+	return validateRequires(chs)
+}
+
+func validateRequires(chs []*Challenge) error {
+	bySlug := make(map[string]*Challenge, len(chs))
+	for _, ch := range chs {
+		bySlug[ch.Slug()] = ch
+	}
+
+	const (
+		visiting = 1
+		done     = 2
+	)
+	state := make(map[string]int, len(chs))
+
+	var visit func(ch *Challenge) error
+	visit = func(ch *Challenge) error {
+		switch state[ch.Slug()] {
+		case visiting:
+			return fmt.Errorf("%w: %s is part of a cycle", ErrInvalidRequires, ch.Slug())
+		case done:
+			return nil
+		}
+
+		state[ch.Slug()] = visiting
+		for _, slug := range ch.Requires() {
+			req, ok := bySlug[slug]
+			if !ok {
+				return fmt.Errorf("%w: %s requires unknown challenge %s", ErrInvalidRequires, ch.Slug(), slug)
+			}
+			if err := visit(req); err != nil {
+				return err
+			}
+		}
+		state[ch.Slug()] = done
+		return nil
+	}
+
+	for _, ch := range chs {
+		if err := visit(ch); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (c *Challenge) HasExpectedLines() bool {
 	if c.chInfo.ExpectedOutput == nil || c.chInfo.ExpectedOutput.Lines == nil {
 		return false
@@ -96,6 +169,40 @@ func (c *Challenge) Version() int {
 	return *c.chInfo.Version
 }
 
+func (c *Challenge) Tags() []string {
+	if c.chInfo.Tags == nil {
+		return []string{}
+	}
+	return *c.chInfo.Tags
+}
+
+// Requires returns the slugs of the challenges that must be solved before
+// this one.
+func (c *Challenge) Requires() []string {
+	if c.chInfo.Requires == nil {
+		return []string{}
+	}
+	return *c.chInfo.Requires
+}
+
+func (c *Challenge) Hints() []string {
+	if c.chInfo.Hints == nil {
+		return []string{}
+	}
+	return *c.chInfo.Hints
+}
+
+// WithSeed returns a copy of the challenge whose randomized data is generated
+// from seed, so every run of it checks commands against the same data.
+func (c *Challenge) WithSeed(seed int64) *Challenge {
+	return &Challenge{chInfo: c.chInfo, seed: seed}
+}
+
+// Seed returns the seed of the randomized data, 0 when it is random.
+func (c *Challenge) Seed() int64 {
+	return c.seed
+}
+
 func (c *Challenge) Dir() string {
 	if c.chInfo.Dir == nil {
 		return *c.chInfo.Slug
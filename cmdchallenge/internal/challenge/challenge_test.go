@@ -183,3 +183,28 @@ func fakeHelloWorldCh(t *testing.T) *Challenge {
 
 	return ch
 }
+
+func TestValidateRequires(t *testing.T) {
+	require.NoError(t, ValidateRequires())
+
+	chWithRequires := func(slug string, requires ...string) *Challenge {
+		return &Challenge{chInfo: &ChInfo{Slug: &slug, Requires: &requires}}
+	}
+
+	assert.NoError(t, validateRequires([]*Challenge{
+		chWithRequires("a"),
+		chWithRequires("b", "a"),
+		chWithRequires("c", "a", "b"),
+	}))
+	assert.ErrorIs(t, validateRequires([]*Challenge{
+		chWithRequires("a", "nope"),
+	}), ErrInvalidRequires)
+	assert.ErrorIs(t, validateRequires([]*Challenge{
+		chWithRequires("a", "c"),
+		chWithRequires("b", "a"),
+		chWithRequires("c", "b"),
+	}), ErrInvalidRequires)
+	assert.ErrorIs(t, validateRequires([]*Challenge{
+		chWithRequires("a", "a"),
+	}), ErrInvalidRequires)
+}
@@ -0,0 +1,442 @@
+package challenge
+
+import (
+	"crypto/rand"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"gitlab.com/jarv/cmdchallenge/internal/config"
+	"gitlab.com/jarv/cmdchallenge/internal/metrics"
+	"gitlab.com/jarv/cmdchallenge/internal/store"
+)
+
+const (
+	classIDBytes   = 8
+	joinCodeLength = 8
+
+	// Join codes are read out loud and typed, so they leave out characters
+	// that look alike
+	joinCodeChars = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+)
+
+// Names of classes and of the students in them
+var classNameRe = regexp.MustCompile(`^[\p{L}\p{N} '._-]{1,40}$`)
+
+type jsonCreateClass struct {
+	Name  string   `json:"name"`
+	Slugs []string `json:"slugs"`
+	Tags  []string `json:"tags"`
+}
+
+type jsonClass struct {
+	ID              string   `json:"id"`
+	Name            string   `json:"name"`
+	Slugs           []string `json:"slugs"`
+	JoinCode        string   `json:"join_code,omitempty"`
+	InstructorToken string   `json:"instructor_token,omitempty"`
+}
+
+type jsonJoinClass struct {
+	Code string `json:"code"`
+	Name string `json:"name"`
+}
+
+type jsonClassAttempt struct {
+	Slug          string    `json:"slug"`
+	Solved        bool      `json:"solved"`
+	Attempts      int       `json:"attempts"`
+	LastCmd       string    `json:"last_cmd"`
+	LastAttemptAt time.Time `json:"last_attempt_at"`
+}
+
+type jsonClassStudent struct {
+	Name       string             `json:"name"`
+	JoinedAt   time.Time          `json:"joined_at"`
+	Solved     int                `json:"solved"`
+	Challenges []jsonClassAttempt `json:"challenges"`
+}
+
+type jsonClassProgress struct {
+	jsonClass
+	Students []jsonClassStudent `json:"students"`
+}
+
+// Classes lets instructors assign a set of challenges to a class of
+// students who join it with a code. Every command a student sends for an
+// assigned challenge is recorded, instructors see the progress of their
+// class with the instructor token given when it was created.
+type Classes struct {
+	log      *slog.Logger
+	cfg      *config.Config
+	metrics  *metrics.Metrics
+	storer   store.ClassStorer
+	sessions *Sessions
+}
+
+func NewClasses(log *slog.Logger, cfg *config.Config, m *metrics.Metrics, s store.ClassStorer, sessions *Sessions) *Classes {
+	return &Classes{
+		log:      log,
+		cfg:      cfg,
+		metrics:  m,
+		storer:   s,
+		sessions: sessions,
+	}
+}
+
+func (c *Classes) httpError(w http.ResponseWriter, e error) {
+	c.metrics.CmdErrors.WithLabelValues(errorLabel(e), TypeServer).Inc()
+	writeError(w, e)
+}
+
+// record keeps cmd as the last attempt of the session for slug in every
+// class it joined that has the challenge.
+func (c *Classes) record(sessionID, slug, cmd string, correct bool) {
+	if err := c.storer.RecordClassAttempt(sessionID, slug, cmd, correct, time.Now()); err != nil {
+		c.log.Error("Unable to record class attempt", "slug", slug, "err", err)
+	}
+}
+
+// CreateHandler creates a class for the challenges posted by slug or tag,
+// it requires the configured class token.
+func (c *Classes) CreateHandler() http.Handler {
+	return http.HandlerFunc(c.createHandler)
+}
+
+func (c *Classes) createHandler(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Cache-Control", "no-store, max-age=0")
+
+	if c.cfg.ClassToken == "" {
+		c.httpError(w, ErrClassDisabled)
+		return
+	}
+
+	if !hasBearerToken(req, c.cfg.ClassToken) {
+		c.log.Error("Invalid class token", "Addr", req.RemoteAddr, "URI", req.RequestURI)
+		c.httpError(w, ErrClassUnauthorized)
+		return
+	}
+
+	if req.Method != http.MethodPost {
+		c.log.Error("expect POST", "method", req.Method)
+		c.httpError(w, ErrServerInvalidMethod)
+		return
+	}
+
+	var createReq jsonCreateClass
+	dec := json.NewDecoder(http.MaxBytesReader(w, req.Body, maxRequestBodyBytes))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&createReq); err != nil {
+		c.httpError(w, ErrServerInvalidBody)
+		return
+	}
+
+	createReq.Name = strings.TrimSpace(createReq.Name)
+	if !classNameRe.MatchString(createReq.Name) {
+		c.httpError(w, ErrClassInvalidName)
+		return
+	}
+
+	slugs, err := c.assignedSlugs(createReq.Slugs, createReq.Tags)
+	if err != nil {
+		c.httpError(w, err)
+		return
+	}
+
+	id, err := randomHex(classIDBytes)
+	if err != nil {
+		c.log.Error("Unable to generate class id", "err", err)
+		c.httpError(w, ErrServerUnknown)
+		return
+	}
+	joinCode, err := newJoinCode()
+	if err != nil {
+		c.log.Error("Unable to generate join code", "err", err)
+		c.httpError(w, ErrServerUnknown)
+		return
+	}
+	token, err := newSessionToken()
+	if err != nil {
+		c.log.Error("Unable to generate instructor token", "err", err)
+		c.httpError(w, ErrServerUnknown)
+		return
+	}
+
+	// The instructor token is hashed like session tokens
+	err = c.storer.CreateClass(&store.Class{
+		ID:            id,
+		Name:          createReq.Name,
+		JoinCode:      joinCode,
+		InstructorKey: sessionID(token),
+		Slugs:         slugs,
+		CreateTime:    time.Now(),
+	})
+	if err != nil {
+		c.log.Error("Unable to create class", "err", err)
+		c.httpError(w, ErrClassStore)
+		return
+	}
+
+	c.log.Info("Class created", "id", id, "slugs", len(slugs), "Addr", req.RemoteAddr)
+	writeJSON(w, &jsonClass{
+		ID:              id,
+		Name:            createReq.Name,
+		Slugs:           slugs,
+		JoinCode:        joinCode,
+		InstructorToken: token,
+	})
+}
+
+// assignedSlugs returns the sorted slugs of a class, the posted slugs and
+// every challenge with one of the posted tags.
+func (c *Classes) assignedSlugs(slugs, tags []string) ([]string, error) {
+	assigned := make([]string, 0, len(slugs))
+	for _, slug := range slugs {
+		ch, err := NewChallenge(ChallengeOptions{Slug: slug})
+		if err != nil || ch.Slug() != slug {
+			return nil, ErrServerInvalidChallenge
+		}
+		assigned = append(assigned, slug)
+	}
+
+	if len(tags) > 0 {
+		chs, err := AllChallenges()
+		if err != nil {
+			return nil, err
+		}
+		for _, tag := range tags {
+			n := len(assigned)
+			for _, ch := range chs {
+				if slices.Contains(ch.Tags(), tag) {
+					assigned = append(assigned, ch.Slug())
+				}
+			}
+			if len(assigned) == n {
+				return nil, ErrClassInvalidTag
+			}
+		}
+	}
+
+	slices.Sort(assigned)
+	assigned = slices.Compact(assigned)
+
+	if len(assigned) == 0 {
+		return nil, ErrClassNoChallenges
+	}
+	if len(assigned) > c.cfg.ClassMaxSlugs {
+		return nil, ErrClassTooLarge
+	}
+	return assigned, nil
+}
+
+// JoinHandler adds the session of the request to the class of the posted
+// join code under the posted name, joining again changes the name.
+func (c *Classes) JoinHandler() http.Handler {
+	return http.HandlerFunc(c.joinHandler)
+}
+
+func (c *Classes) joinHandler(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Cache-Control", "no-store, max-age=0")
+
+	if req.Method != http.MethodPost {
+		c.log.Error("expect POST", "method", req.Method)
+		c.httpError(w, ErrServerInvalidMethod)
+		return
+	}
+
+	id, ok := c.sessions.requireSession(w, req)
+	if !ok {
+		return
+	}
+
+	var joinReq jsonJoinClass
+	dec := json.NewDecoder(http.MaxBytesReader(w, req.Body, maxRequestBodyBytes))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&joinReq); err != nil {
+		c.httpError(w, ErrServerInvalidBody)
+		return
+	}
+
+	joinReq.Name = strings.TrimSpace(joinReq.Name)
+	if !classNameRe.MatchString(joinReq.Name) {
+		c.httpError(w, ErrClassInvalidName)
+		return
+	}
+	if c.sessions.blocklist.Matches(joinReq.Name) {
+		c.log.Info("Rejected blocklisted student name", "name", joinReq.Name, "Addr", req.RemoteAddr)
+		c.httpError(w, ErrClassInvalidName)
+		return
+	}
+
+	class, err := c.storer.ClassByJoinCode(strings.ToUpper(strings.TrimSpace(joinReq.Code)))
+	if errors.Is(err, store.ErrClassNotFound) {
+		c.httpError(w, ErrClassInvalidCode)
+		return
+	}
+	if err != nil {
+		c.log.Error("Unable to look up class", "err", err)
+		c.httpError(w, ErrClassStore)
+		return
+	}
+
+	err = c.storer.JoinClass(class.ID, id, joinReq.Name, time.Now())
+	if errors.Is(err, store.ErrNameTaken) {
+		c.httpError(w, err)
+		return
+	}
+	if err != nil {
+		c.log.Error("Unable to join class", "err", err)
+		c.httpError(w, ErrClassStore)
+		return
+	}
+
+	writeJSON(w, &jsonClass{ID: class.ID, Name: class.Name, Slugs: class.Slugs})
+}
+
+// ProgressHandler returns the progress of every student of the class of
+// the id route variable, it requires the instructor token of the class.
+func (c *Classes) ProgressHandler() http.Handler {
+	return http.HandlerFunc(c.progressHandler)
+}
+
+func (c *Classes) progressHandler(w http.ResponseWriter, req *http.Request) {
+	class, students, ok := c.classForInstructor(w, req)
+	if !ok {
+		return
+	}
+
+	resp := jsonClassProgress{
+		jsonClass: jsonClass{ID: class.ID, Name: class.Name, Slugs: class.Slugs},
+		Students:  make([]jsonClassStudent, 0, len(students)),
+	}
+	for _, s := range students {
+		student := jsonClassStudent{
+			Name:       s.Name,
+			JoinedAt:   s.JoinTime.UTC(),
+			Challenges: make([]jsonClassAttempt, 0, len(s.Attempts)),
+		}
+		for _, a := range s.Attempts {
+			if a.Solved {
+				student.Solved++
+			}
+			student.Challenges = append(student.Challenges, jsonClassAttempt{
+				Slug:          a.Slug,
+				Solved:        a.Solved,
+				Attempts:      a.Attempts,
+				LastCmd:       a.Cmd,
+				LastAttemptAt: a.UpdateTime.UTC(),
+			})
+		}
+		resp.Students = append(resp.Students, student)
+	}
+	writeJSON(w, &resp)
+}
+
+// ExportHandler returns the progress of the class of the id route variable
+// as CSV, with a row for every student and assigned challenge. It requires
+// the instructor token of the class.
+func (c *Classes) ExportHandler() http.Handler {
+	return http.HandlerFunc(c.exportHandler)
+}
+
+func (c *Classes) exportHandler(w http.ResponseWriter, req *http.Request) {
+	class, students, ok := c.classForInstructor(w, req)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="class-`+class.ID+`.csv"`)
+
+	cw := csv.NewWriter(w)
+	_ = cw.Write([]string{"student", "joined_at", "slug", "solved", "attempts", "last_cmd", "last_attempt_at"})
+	for _, s := range students {
+		for _, slug := range class.Slugs {
+			row := []string{csvSafe(s.Name), s.JoinTime.UTC().Format(time.RFC3339), slug, "false", "0", "", ""}
+			if i := slices.IndexFunc(s.Attempts, func(a store.ClassAttempt) bool { return a.Slug == slug }); i >= 0 {
+				a := s.Attempts[i]
+				row[3] = strconv.FormatBool(a.Solved)
+				row[4] = strconv.Itoa(a.Attempts)
+				row[5] = csvSafe(a.Cmd)
+				row[6] = a.UpdateTime.UTC().Format(time.RFC3339)
+			}
+			_ = cw.Write(row)
+		}
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		c.log.Info("Unable to write class export", "err", err)
+	}
+}
+
+// csvSafe keeps spreadsheets from running a cell that students control as a
+// formula by prefixing cells that start like one with a quote.
+func csvSafe(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+// classForInstructor returns the class of the id route variable and its
+// students. Unknown classes are reported like a wrong token so class ids
+// can't be probed.
+func (c *Classes) classForInstructor(w http.ResponseWriter, req *http.Request) (*store.Class, []store.ClassStudent, bool) {
+	w.Header().Set("Cache-Control", "no-store, max-age=0")
+
+	if req.Method != http.MethodGet {
+		c.log.Error("expect GET", "method", req.Method)
+		c.httpError(w, ErrServerInvalidMethod)
+		return nil, nil, false
+	}
+
+	class, err := c.storer.ClassByID(mux.Vars(req)["id"])
+	if err != nil && !errors.Is(err, store.ErrClassNotFound) {
+		c.log.Error("Unable to look up class", "err", err)
+		c.httpError(w, ErrClassStore)
+		return nil, nil, false
+	}
+
+	token, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+	if class == nil || !ok || !hasToken(sessionID(token), class.InstructorKey) {
+		c.log.Error("Invalid instructor token", "Addr", req.RemoteAddr, "URI", req.RequestURI)
+		c.httpError(w, ErrClassUnauthorized)
+		return nil, nil, false
+	}
+
+	students, err := c.storer.ClassStudents(class.ID)
+	if err != nil {
+		c.log.Error("Unable to query class students", "class", class.ID, "err", err)
+		c.httpError(w, ErrClassStore)
+		return nil, nil, false
+	}
+	return class, students, true
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func newJoinCode() (string, error) {
+	b := make([]byte, joinCodeLength)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	for i := range b {
+		b[i] = joinCodeChars[int(b[i])%len(joinCodeChars)]
+	}
+	return string(b), nil
+}
@@ -0,0 +1,134 @@
+package challenge
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gitlab.com/jarv/cmdchallenge/internal/config"
+	"gitlab.com/jarv/cmdchallenge/internal/metrics"
+	"gitlab.com/jarv/cmdchallenge/internal/store"
+)
+
+var classCfg = config.New(config.ConfigOpts{ClassToken: "secret"})
+
+func postClass(h http.Handler, token, sessionToken, body string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(http.MethodPost, "/c/classes", strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	if sessionToken != "" {
+		req.Header.Set(SessionHeader, sessionToken)
+	}
+	resp := httptest.NewRecorder()
+	h.ServeHTTP(resp, req)
+	return resp
+}
+
+func getClass(h http.Handler, id, token string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(http.MethodGet, "/c/classes/"+id, http.NoBody)
+	req = mux.SetURLVars(req, map[string]string{"id": id})
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp := httptest.NewRecorder()
+	h.ServeHTTP(resp, req)
+	return resp
+}
+
+func TestClassCreate(t *testing.T) {
+	m := metrics.New(testLogger(t))
+	classes := NewClasses(testLogger(t), cfg, m, store.NewMemClassStore(), nil)
+	assert.Equal(t, 403, postClass(classes.CreateHandler(), "secret", "", `{}`).Code)
+
+	classes = NewClasses(testLogger(t), classCfg, m, store.NewMemClassStore(), nil)
+	h := classes.CreateHandler()
+	assert.Equal(t, 401, postClass(h, "wrong", "", `{"name":"a","slugs":["hello_world"]}`).Code)
+	assert.Equal(t, 400, postClass(h, "secret", "", `{"name":"","slugs":["hello_world"]}`).Code)
+	assert.Equal(t, 400, postClass(h, "secret", "", `{"name":"a","slugs":["nope"]}`).Code)
+	assert.Equal(t, 400, postClass(h, "secret", "", `{"name":"a","tags":["nope"]}`).Code)
+	assert.Equal(t, 400, postClass(h, "secret", "", `{"name":"a"}`).Code)
+
+	resp := postClass(h, "secret", "", `{"name":"Onboarding","slugs":["hello_world"],"tags":["oops"]}`)
+	require.Equal(t, 200, resp.Code)
+
+	var class jsonClass
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &class))
+	assert.Equal(t, "Onboarding", class.Name)
+	assert.Len(t, class.Slugs, 6)
+	assert.Contains(t, class.Slugs, "hello_world")
+	assert.Len(t, class.JoinCode, joinCodeLength)
+	assert.NotEmpty(t, class.InstructorToken)
+}
+
+func TestClassProgress(t *testing.T) {
+	stubStore := &StubStor{}
+	stubStore.On("GetResult", "echo hello world", "hello_world", 5).Return(&fakeStore, nil)
+	stubStore.On("IncrementResult", "echo hello world", "hello_world", 5).Return(nil)
+
+	m := metrics.New(testLogger(t))
+	sessions := NewSessions(testLogger(t), classCfg, m, store.NewMemSessionStore(), stubStore, nil)
+	classes := NewClasses(testLogger(t), classCfg, m, store.NewMemClassStore(), sessions)
+	s := NewServer(testLogger(t), classCfg, m, &StubRunnerExecutor{}, stubStore, ServerOptions{Sessions: sessions, Classes: classes})
+
+	var class jsonClass
+	resp := postClass(classes.CreateHandler(), "secret", "", `{"name":"Onboarding","slugs":["hello_world"]}`)
+	require.Equal(t, 200, resp.Code)
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &class))
+
+	token := newTestSession(t, sessions)
+	assert.Equal(t, 401, postClass(classes.JoinHandler(), "", "", `{"code":"`+class.JoinCode+`","name":"Alice"}`).Code)
+	assert.Equal(t, 404, postClass(classes.JoinHandler(), "", token, `{"code":"nope","name":"Alice"}`).Code)
+	resp = postClass(classes.JoinHandler(), "", token, `{"code":"`+strings.ToLower(class.JoinCode)+`","name":"Alice"}`)
+	require.Equal(t, 200, resp.Code)
+	assert.NotContains(t, resp.Body.String(), "instructor_token")
+
+	other := newTestSession(t, sessions)
+	resp = postClass(classes.JoinHandler(), "", other, `{"code":"`+class.JoinCode+`","name":"alice"}`)
+	assert.Equal(t, 409, resp.Code)
+	assert.Contains(t, resp.Body.String(), `"code":"name_taken"`)
+
+	req, resp := createTestRequest()
+	req.Header.Set(SessionHeader, token)
+	s.runHandler(resp, req)
+	require.Equal(t, 200, resp.Code)
+
+	assert.Equal(t, 401, getClass(classes.ProgressHandler(), class.ID, "wrong").Code)
+	assert.Equal(t, 401, getClass(classes.ProgressHandler(), "missing", class.InstructorToken).Code)
+
+	resp = getClass(classes.ProgressHandler(), class.ID, class.InstructorToken)
+	require.Equal(t, 200, resp.Code)
+	var progress jsonClassProgress
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &progress))
+	require.Len(t, progress.Students, 1)
+	assert.Equal(t, "Alice", progress.Students[0].Name)
+	assert.Equal(t, 1, progress.Students[0].Solved)
+	assert.Equal(t, "echo hello world", progress.Students[0].Challenges[0].LastCmd)
+
+	resp = getClass(classes.ExportHandler(), class.ID, class.InstructorToken)
+	require.Equal(t, 200, resp.Code)
+	assert.Equal(t, "text/csv; charset=utf-8", resp.Header().Get("Content-Type"))
+	lines := strings.Split(strings.TrimSpace(resp.Body.String()), "\n")
+	require.Len(t, lines, 2)
+	assert.Equal(t, "student,joined_at,slug,solved,attempts,last_cmd,last_attempt_at", lines[0])
+	assert.Contains(t, lines[1], ",hello_world,true,1,echo hello world,")
+}
+
+func TestCSVSafe(t *testing.T) {
+	for in, want := range map[string]string{
+		"":                   "",
+		"echo hello world":   "echo hello world",
+		"Alice":              "Alice",
+		"=HYPERLINK(\"x\")":  "'=HYPERLINK(\"x\")",
+		"+1":                 "'+1",
+		"-cmd|' /C calc'!A0": "'-cmd|' /C calc'!A0",
+		"@SUM(A1)":           "'@SUM(A1)",
+		"\t=1":               "'\t=1",
+		"echo =1":            "echo =1",
+	} {
+		assert.Equal(t, want, csvSafe(in), in)
+	}
+}
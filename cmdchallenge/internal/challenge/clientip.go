@@ -0,0 +1,78 @@
+package challenge
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// ClientIP sets the remote address of requests to the address of the client
+// that sent them. X-Forwarded-For is only used for requests that come from a
+// trusted proxy, and only the hops appended by trusted proxies are skipped,
+// so clients can't pick the address their requests are rate limited by.
+type ClientIP struct {
+	trusted []netip.Prefix
+}
+
+func NewClientIP(cidrs []string) (*ClientIP, error) {
+	c := &ClientIP{}
+	for _, cidr := range cidrs {
+		cidr = strings.TrimSpace(cidr)
+		if cidr == "" {
+			continue
+		}
+		p, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrServerTrustedProxy, cidr)
+		}
+		c.trusted = append(c.trusted, p.Masked())
+	}
+	return c, nil
+}
+
+func (c *ClientIP) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		req.RemoteAddr = c.clientIP(req)
+		next.ServeHTTP(w, req)
+	})
+}
+
+func (c *ClientIP) clientIP(req *http.Request) string {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		host = req.RemoteAddr
+	}
+
+	peer, err := netip.ParseAddr(host)
+	if err != nil || !c.isTrusted(peer) {
+		return host
+	}
+
+	// Walk the forwarded addresses from the closest hop, the first one that
+	// isn't a trusted proxy is the client
+	hops := strings.Split(strings.Join(req.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			break
+		}
+		peer = hop
+		if !c.isTrusted(hop) {
+			break
+		}
+	}
+
+	return peer.Unmap().String()
+}
+
+func (c *ClientIP) isTrusted(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, p := range c.trusted {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
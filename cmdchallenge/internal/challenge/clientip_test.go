@@ -0,0 +1,88 @@
+package challenge
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gitlab.com/jarv/cmdchallenge/internal/config"
+	"gitlab.com/jarv/cmdchallenge/internal/metrics"
+)
+
+func TestClientIP(t *testing.T) {
+	testCases := []struct {
+		name         string
+		remoteAddr   string
+		forwardedFor []string
+		wantClientIP string
+	}{
+		{name: "direct", remoteAddr: "1.1.1.1:80", wantClientIP: "1.1.1.1"},
+		{name: "spoofed from an untrusted peer", remoteAddr: "1.1.1.1:80", forwardedFor: []string{"2.2.2.2"}, wantClientIP: "1.1.1.1"},
+		{name: "behind the proxy", remoteAddr: "172.18.0.2:80", forwardedFor: []string{"2.2.2.2"}, wantClientIP: "2.2.2.2"},
+		{
+			name: "spoofed behind the proxy", remoteAddr: "172.18.0.2:80",
+			forwardedFor: []string{"3.3.3.3, 2.2.2.2"}, wantClientIP: "2.2.2.2",
+		},
+		{
+			name: "behind two proxies", remoteAddr: "127.0.0.1:80",
+			forwardedFor: []string{"3.3.3.3", "2.2.2.2, 10.0.0.1"}, wantClientIP: "2.2.2.2",
+		},
+		{name: "invalid hop", remoteAddr: "172.18.0.2:80", forwardedFor: []string{"2.2.2.2, nope"}, wantClientIP: "172.18.0.2"},
+		{name: "ipv6", remoteAddr: "[::1]:80", forwardedFor: []string{"2001:db8::1"}, wantClientIP: "2001:db8::1"},
+		{name: "no forwarded header", remoteAddr: "127.0.0.1:80", wantClientIP: "127.0.0.1"},
+	}
+
+	clientIP, err := NewClientIP(config.DefaultTrustedProxies)
+	require.NoError(t, err)
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodGet, "/c/r", http.NoBody)
+			req.RemoteAddr = tt.remoteAddr
+			for _, v := range tt.forwardedFor {
+				req.Header.Add("X-Forwarded-For", v)
+			}
+
+			var got string
+			clientIP.Handler(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				got = req.RemoteAddr
+			})).ServeHTTP(httptest.NewRecorder(), req)
+
+			assert.Equal(t, tt.wantClientIP, got)
+		})
+	}
+}
+
+func TestClientIPInvalidCIDR(t *testing.T) {
+	_, err := NewClientIP([]string{"10.0.0.0/8", "not a cidr"})
+	assert.ErrorIs(t, err, ErrServerTrustedProxy)
+}
+
+func TestRateLimitByClientIP(t *testing.T) {
+	clientIP, err := NewClientIP(config.DefaultTrustedProxies)
+	require.NoError(t, err)
+
+	stubStore := &StubStor{}
+	stubStore.On("StatsForSlug", "hello_world", 5).Return(nil, ErrStatsStore)
+	m := metrics.New(testLogger(t))
+	rl := config.RateLimit{PerSec: 0.001, Burst: 1}
+	h := clientIP.Handler(NewRateLimit(testLogger(t), m, NewMemoryRateLimiter()).Handler(
+		"stats", rl, "slow down", NewStats(testLogger(t), cfg, m, stubStore, nil).Handler()))
+
+	statsFrom := func(forwardedFor string) *httptest.ResponseRecorder {
+		req, resp := createStatsRequest("hello_world")
+		req.RemoteAddr = "172.18.0.2:80"
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		h.ServeHTTP(resp, req)
+		return resp
+	}
+
+	assert.Equal(t, 500, statsFrom("2.2.2.2").Code)
+	// Prepending an address doesn't change the client
+	resp := statsFrom("3.3.3.3, 2.2.2.2")
+	assert.Equal(t, 429, resp.Code)
+	assert.Contains(t, resp.Body.String(), `"code":"rate_limited"`)
+	assert.Equal(t, 500, statsFrom("3.3.3.3").Code)
+}
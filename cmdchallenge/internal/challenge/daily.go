@@ -0,0 +1,199 @@
+package challenge
+
+import (
+	"hash/fnv"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"gitlab.com/jarv/cmdchallenge/internal/config"
+	"gitlab.com/jarv/cmdchallenge/internal/metrics"
+	"gitlab.com/jarv/cmdchallenge/internal/store"
+)
+
+const dailyDateLayout = "2006-01-02"
+
+type jsonDailyStats struct {
+	Attempts int    `json:"attempts"`
+	Solves   int    `json:"solves"`
+	Shortest string `json:"shortest,omitempty"`
+}
+
+type jsonDaily struct {
+	Date    string         `json:"date"`
+	Slug    string         `json:"slug"`
+	Version int            `json:"version"`
+	Seed    int64          `json:"seed,omitempty"`
+	Stats   jsonDailyStats `json:"stats"`
+}
+
+// Daily picks a challenge of the day from a pool of challenges, every server
+// picks the same one for a UTC day without sharing any state. The shortest
+// command isn't shown while the challenge is part of a running event.
+type Daily struct {
+	log       *slog.Logger
+	cfg       *config.Config
+	metrics   *metrics.Metrics
+	cmdStorer store.CmdStorer
+	blocklist *Blocklist
+	events    *Events
+	pool      []*Challenge
+	now       func() time.Time
+}
+
+func NewDaily(
+	log *slog.Logger,
+	cfg *config.Config,
+	m *metrics.Metrics,
+	s store.CmdStorer,
+	blocklist *Blocklist,
+	events *Events,
+) (*Daily, error) {
+	chs, err := AllChallenges()
+	if err != nil {
+		return nil, err
+	}
+
+	pool, err := dailyPool(chs, cfg.DailyTags)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Daily{
+		log:       log,
+		cfg:       cfg,
+		metrics:   m,
+		cmdStorer: s,
+		blocklist: blocklist,
+		events:    events,
+		pool:      pool,
+		now:       time.Now,
+	}, nil
+}
+
+// dailyPool returns the challenges with one of the tags sorted by slug, or
+// the untagged challenges when there are no tags. Challenges with
+// prerequisites are left out so the daily challenge is open to everyone.
+func dailyPool(chs []*Challenge, tags []string) ([]*Challenge, error) {
+	pool := make([]*Challenge, 0)
+	for _, ch := range chs {
+		if len(ch.Requires()) > 0 {
+			continue
+		}
+		inPool := len(ch.Tags()) == 0
+		if len(tags) > 0 {
+			inPool = slices.ContainsFunc(ch.Tags(), func(tag string) bool { return slices.Contains(tags, tag) })
+		}
+		if inPool {
+			pool = append(pool, ch)
+		}
+	}
+
+	if len(pool) == 0 {
+		return nil, ErrDailyConfig
+	}
+
+	slices.SortFunc(pool, func(a, b *Challenge) int { return strings.Compare(a.Slug(), b.Slug()) })
+	return pool, nil
+}
+
+func (d *Daily) httpError(w http.ResponseWriter, err error) {
+	d.metrics.CmdErrors.WithLabelValues(errorLabel(err), TypeServer).Inc()
+	writeError(w, err)
+}
+
+// pick returns the challenge of the UTC day of date.
+func (d *Daily) pick(date string) *Challenge {
+	return d.pool[dailyHash(date)%uint64(len(d.pool))]
+}
+
+// seed returns the seed of the randomized data of the challenge of the day,
+// it is never 0 which means random data.
+func (d *Daily) seed(date string) int64 {
+	seed := int64(dailyHash("seed/"+date) >> 1)
+	if seed == 0 {
+		return 1
+	}
+	return seed
+}
+
+// variant returns ch with the randomized data of the day when seeding is
+// enabled and ch is the challenge of the day.
+func (d *Daily) variant(ch *Challenge) *Challenge {
+	if !d.cfg.DailySeed || !ch.HasRandomizer() {
+		return ch
+	}
+
+	date := d.now().UTC().Format(dailyDateLayout)
+	if d.pick(date).Slug() != ch.Slug() {
+		return ch
+	}
+	return ch.WithSeed(d.seed(date))
+}
+
+// Handler returns the challenge of the day with the stats of the commands
+// sent for it that day. The date query parameter selects a previous day.
+func (d *Daily) Handler() http.Handler {
+	return http.HandlerFunc(d.dailyHandler)
+}
+
+func (d *Daily) dailyHandler(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Cache-Control", "public, max-age=60, s-maxage=60")
+
+	if req.Method != http.MethodGet {
+		d.log.Error("expected GET", "method", req.Method)
+		d.httpError(w, ErrServerInvalidMethod)
+		return
+	}
+
+	today := d.now().UTC().Truncate(24 * time.Hour)
+	day := today
+	if date := req.URL.Query().Get("date"); date != "" {
+		var err error
+		if day, err = time.Parse(dailyDateLayout, date); err != nil || day.After(today) {
+			d.log.Error("Invalid date for daily challenge", "date", date)
+			d.httpError(w, ErrDailyInvalidDate)
+			return
+		}
+	}
+
+	date := day.Format(dailyDateLayout)
+	ch := d.pick(date)
+	stats, err := d.cmdStorer.DailyStatsForSlug(ch.Slug(), ch.Version(), day, day.Add(24*time.Hour))
+	if err != nil {
+		d.log.Error("Unable to query daily stats", "slug", ch.Slug(), "date", date, "err", err)
+		d.httpError(w, ErrDailyStore)
+		return
+	}
+
+	resp := jsonDaily{
+		Date:    date,
+		Slug:    ch.Slug(),
+		Version: ch.Version(),
+		Stats: jsonDailyStats{
+			Attempts: stats.Attempts,
+			Solves:   stats.Solves,
+			Shortest: stats.Shortest,
+		},
+	}
+	if d.blocklist.Matches(resp.Stats.Shortest) {
+		resp.Stats.Shortest = ""
+	}
+	if d.events.inRunningEvent(ch.Slug()) {
+		resp.Stats.Shortest = ""
+		w.Header().Set("Cache-Control", "no-store")
+	}
+	if d.cfg.DailySeed && ch.HasRandomizer() {
+		resp.Seed = d.seed(date)
+	}
+	writeJSON(w, &resp)
+}
+
+func dailyHash(s string) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(s))
+	return h.Sum64()
+}
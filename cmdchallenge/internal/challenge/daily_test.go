@@ -0,0 +1,236 @@
+package challenge
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"gitlab.com/jarv/cmdchallenge/internal/config"
+	"gitlab.com/jarv/cmdchallenge/internal/metrics"
+	"gitlab.com/jarv/cmdchallenge/internal/store"
+)
+
+var dailyNow = time.Date(2026, 3, 14, 15, 9, 26, 0, time.UTC)
+
+func newTestDaily(t *testing.T, dailyCfg *config.Config, s store.CmdStorer) *Daily {
+	d, err := NewDaily(testLogger(t), dailyCfg, metrics.New(testLogger(t)), s, nil, nil)
+	require.NoError(t, err)
+	d.now = func() time.Time { return dailyNow }
+	return d
+}
+
+func getDaily(d *Daily, date string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(http.MethodGet, "/c/daily?date="+date, http.NoBody)
+	resp := httptest.NewRecorder()
+	d.Handler().ServeHTTP(resp, req)
+	return resp
+}
+
+func TestDailyPool(t *testing.T) {
+	chs, err := AllChallenges()
+	require.NoError(t, err)
+
+	pool, err := dailyPool(chs, nil)
+	require.NoError(t, err)
+	slugs := make([]string, 0, len(pool))
+	for _, ch := range pool {
+		assert.Empty(t, ch.Tags(), ch.Slug())
+		assert.Empty(t, ch.Requires(), ch.Slug())
+		slugs = append(slugs, ch.Slug())
+	}
+	assert.IsIncreasing(t, slugs)
+	assert.Contains(t, slugs, "hello_world")
+
+	// Challenges with prerequisites are left out
+	pool, err = dailyPool(chs, []string{"12days"})
+	require.NoError(t, err)
+	require.Len(t, pool, 1)
+	assert.Equal(t, "12days_1", pool[0].Slug())
+
+	_, err = dailyPool(chs, []string{"nope"})
+	assert.ErrorIs(t, err, ErrDailyConfig)
+}
+
+func TestDailyPick(t *testing.T) {
+	d := newTestDaily(t, cfg, &StubStor{})
+
+	picked := make(map[string]bool)
+	day := dailyNow
+	for i := 0; i < 60; i++ {
+		date := day.Format(dailyDateLayout)
+		assert.Equal(t, d.pick(date).Slug(), d.pick(date).Slug())
+		assert.NotZero(t, d.seed(date))
+		picked[d.pick(date).Slug()] = true
+		day = day.Add(24 * time.Hour)
+	}
+	assert.Greater(t, len(picked), 1)
+}
+
+func TestDailyHandler(t *testing.T) {
+	stubStore := &StubStor{}
+	d := newTestDaily(t, cfg, stubStore)
+
+	today := time.Date(2026, 3, 14, 0, 0, 0, 0, time.UTC)
+	ch := d.pick("2026-03-14")
+	stubStore.On("DailyStatsForSlug", ch.Slug(), ch.Version(), today, today.Add(24*time.Hour)).
+		Return(&store.DailyStats{Attempts: 3, Solves: 2, Shortest: "pwd"}, nil).Once()
+
+	resp := getDaily(d, "")
+	require.Equal(t, 200, resp.Code)
+	assert.JSONEq(t, `{"date":"2026-03-14","slug":"`+ch.Slug()+`","version":`+
+		strconv.Itoa(ch.Version())+`,"stats":{"attempts":3,"solves":2,"shortest":"pwd"}}`, resp.Body.String())
+
+	yesterday := today.Add(-24 * time.Hour)
+	ch = d.pick("2026-03-13")
+	stubStore.On("DailyStatsForSlug", ch.Slug(), ch.Version(), yesterday, today).
+		Return(nil, assert.AnError).Once()
+	resp = getDaily(d, "2026-03-13")
+	assert.Equal(t, 500, resp.Code)
+	assert.Contains(t, resp.Body.String(), `"code":"store_error"`)
+
+	for _, date := range []string{"2026-03-15", "14-03-2026", "yesterday"} {
+		resp = getDaily(d, date)
+		assert.Equal(t, 400, resp.Code, date)
+		assert.Contains(t, resp.Body.String(), `"code":"invalid_param"`, date)
+	}
+	stubStore.AssertExpectations(t)
+}
+
+func TestDailyEventRunning(t *testing.T) {
+	stubStore := &StubStor{}
+	d := newTestDaily(t, cfg, stubStore)
+	d.pool = []*Challenge{helloWorldCh(t)}
+	d.events = NewEvents(testLogger(t), cfg, metrics.New(testLogger(t)), store.NewMemSessionStore(), []*Event{testEvent()})
+	now := eventStart.Add(10 * time.Minute)
+	d.events.now = func() time.Time { return now }
+
+	today := time.Date(2026, 3, 14, 0, 0, 0, 0, time.UTC)
+	stubStore.On("DailyStatsForSlug", "hello_world", 5, today, today.Add(24*time.Hour)).
+		Return(&store.DailyStats{Attempts: 3, Solves: 2, Shortest: "pwd"}, nil).Twice()
+
+	// The shortest command is hidden while the challenge is part of an event
+	resp := getDaily(d, "")
+	require.Equal(t, 200, resp.Code)
+	assert.JSONEq(t, `{"date":"2026-03-14","slug":"hello_world","version":5,"stats":{"attempts":3,"solves":2}}`, resp.Body.String())
+	assert.Equal(t, "no-store", resp.Header().Get("Cache-Control"))
+
+	now = eventStart.Add(2 * time.Hour)
+	resp = getDaily(d, "")
+	require.Equal(t, 200, resp.Code)
+	assert.Contains(t, resp.Body.String(), `"shortest":"pwd"`)
+	assert.Equal(t, "public, max-age=60, s-maxage=60", resp.Header().Get("Cache-Control"))
+	stubStore.AssertExpectations(t)
+}
+
+func TestDailyVariant(t *testing.T) {
+	seedCfg := config.New(config.ConfigOpts{DailySeed: true})
+	d := newTestDaily(t, seedCfg, &StubStor{})
+	countFiles, err := NewChallenge(ChallengeOptions{Slug: "count_files"})
+	require.NoError(t, err)
+	d.pool = []*Challenge{countFiles}
+
+	// The challenge of the day gets the randomized data of the day
+	seeded := d.variant(countFiles)
+	assert.Equal(t, d.seed("2026-03-14"), seeded.Seed())
+	assert.Equal(t, countFiles.Slug(), seeded.Slug())
+	assert.Zero(t, countFiles.Seed())
+	assert.Zero(t, d.variant(fakeHelloWorldCh(t)).Seed())
+
+	// The same seed generates the same data
+	a, b := NewRandomizer(testLogger(t), seeded), NewRandomizer(testLogger(t), seeded)
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, a.rndNum(1000), b.rndNum(1000))
+	}
+
+	d.cfg = cfg
+	assert.Zero(t, d.variant(countFiles).Seed())
+}
+
+func TestDailySeededRunNotCached(t *testing.T) {
+	seedCfg := config.New(config.ConfigOpts{DailySeed: true})
+	d := newTestDaily(t, seedCfg, &StubStor{})
+	countFiles, err := NewChallenge(ChallengeOptions{Slug: "count_files"})
+	require.NoError(t, err)
+	d.pool = []*Challenge{countFiles}
+
+	// The store has no expectations, seeded results are never looked up,
+	// stored or counted
+	stubStore := &StubStor{}
+	stubRunnerExecutor := &StubRunnerExecutor{}
+	stubRunnerExecutor.On("RunContainer", "echo 4", mock.MatchedBy(func(ch *Challenge) bool {
+		return ch.Seed() == d.seed("2026-03-14")
+	})).Return(&fakeResponse, nil).Twice()
+
+	s := NewServer(testLogger(t), seedCfg, metrics.New(testLogger(t)), stubRunnerExecutor, stubStore, ServerOptions{Daily: d})
+	for i := 0; i < 2; i++ {
+		data := url.Values{"cmd": {"echo 4"}, "slug": {"count_files"}}
+		req, _ := http.NewRequest(http.MethodPost, "/c/r", strings.NewReader(data.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		resp := httptest.NewRecorder()
+		s.runHandler(resp, req)
+
+		require.Equal(t, 200, resp.Code)
+		assert.Contains(t, resp.Body.String(), `"Cached":false`)
+	}
+
+	stubStore.AssertExpectations(t)
+	stubRunnerExecutor.AssertExpectations(t)
+}
+
+func TestDailySolveModerated(t *testing.T) {
+	log := testLogger(t)
+	m := metrics.New(log)
+	db, err := store.NewSQLStore(log, m, filepath.Join(t.TempDir(), "db.sqlite3"))
+	require.NoError(t, err)
+
+	seedCfg := config.New(config.ConfigOpts{DailySeed: true, AdminToken: "secret"})
+	d := newTestDaily(t, seedCfg, db)
+	d.now = time.Now
+	countFiles, err := NewChallenge(ChallengeOptions{Slug: "count_files"})
+	require.NoError(t, err)
+
+	stubRunnerExecutor := &StubRunnerExecutor{}
+	stubRunnerExecutor.On("RunContainer", mock.Anything, mock.Anything).Return(&fakeResponse, nil)
+	sessions := NewSessions(log, seedCfg, m, db, db, nil)
+	s := NewServer(log, seedCfg, m, stubRunnerExecutor, db, ServerOptions{Sessions: sessions, Daily: d})
+	t.Cleanup(s.Close)
+	token := newTestSession(t, sessions)
+
+	submit := func(slug, cmd string) {
+		req, resp := createTestRequestJSON(`{"slug":"` + slug + `","cmd":"` + cmd + `"}`)
+		req.Header.Set(SessionHeader, token)
+		s.runHandler(resp, req)
+		require.Equal(t, 200, resp.Code)
+	}
+	shortest := func() string {
+		var daily jsonDaily
+		resp := getDaily(d, "")
+		require.Equal(t, 200, resp.Code)
+		require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &daily))
+		return daily.Stats.Shortest
+	}
+
+	// Seeded solves have no stored result to moderate, they aren't progress
+	d.pool = []*Challenge{countFiles}
+	submit("count_files", "echo 4")
+	assert.Empty(t, shortest())
+	assert.Equal(t, `{"progress":[]}`, getProgress(sessions, token).Body.String())
+
+	d.pool = []*Challenge{helloWorldCh(t)}
+	submit("hello_world", "echo hello world")
+	assert.Equal(t, "echo hello world", shortest())
+
+	req, resp := createModerateRequest("hide", "secret")
+	NewAdmin(log, seedCfg, m, db).ModerateHandler().ServeHTTP(resp, req)
+	require.Equal(t, 200, resp.Code)
+	assert.Empty(t, shortest())
+}
@@ -1,6 +1,11 @@
 package challenge
 
-import "errors"
+import (
+	"errors"
+	"net/http"
+
+	"gitlab.com/jarv/cmdchallenge/internal/store"
+)
 
 var (
 	ErrRunnerNonZeroReturn     = errors.New("non-zero return code")
@@ -8,6 +13,9 @@ var (
 	ErrRunnerResultNotFound    = errors.New("result not found")
 	ErrRunnerTimeout           = errors.New("runner timeout")
 	ErrRunnerImgRemovalTimeout = errors.New("unable to cleanup after timeout")
+	ErrRunnerImageMissing      = errors.New("image is not present")
+	ErrRunnerClosed            = errors.New("runner is shutting down")
+	ErrHealthPulling           = errors.New("pulling images")
 )
 
 type ChallengeError struct {
@@ -19,6 +27,24 @@ func (s *ChallengeError) Error() string {
 	return s.msg
 }
 
+// Code returns the stable error code and HTTP status for the error.
+func (s *ChallengeError) Code() (string, int) {
+	switch {
+	case s.msg == RunnerTimeout:
+		return "runner_timeout", http.StatusGatewayTimeout
+	case s.typ == TypeRunner:
+		return "runner_error", http.StatusInternalServerError
+	case s.msg == RunCmdInvalid:
+		return "runcmd_invalid", http.StatusInternalServerError
+	case s.typ == TypeRunCmd:
+		return "runcmd_error", http.StatusInternalServerError
+	case s.typ == TypeStore:
+		return "store_error", http.StatusInternalServerError
+	default:
+		return "unknown_error", http.StatusInternalServerError
+	}
+}
+
 var (
 	ErrServerInvalidSourceIP  = errors.New("unable to determine source IP")
 	ErrServerCmdTooLong       = errors.New("command is too long")
@@ -27,8 +53,16 @@ var (
 	ErrServerInvalidChallenge = errors.New("invalid challenge")
 	ErrServerUnknown          = errors.New("unknown error")
 	ErrServerDecode           = errors.New("decode error")
+	ErrServerInvalidBody      = errors.New("unable to parse request body")
+	ErrServerInvalidEncoding  = errors.New("encoding must be plain or base64")
+	ErrServerContentType      = errors.New("content type must be application/json or a form")
+	ErrServerTrustedProxy     = errors.New("invalid trusted proxy CIDR")
+	ErrServerBanned           = errors.New("too many commands timed out or failed, try again later")
+	ErrServerChallengeLocked  = errors.New("challenge is locked")
 )
 
+var ErrInvalidRequires = errors.New("invalid challenge requirements")
+
 const (
 	RunnerError     = "runner error"
 	RunnerTimeout   = "timed out executing command"
@@ -45,8 +79,187 @@ var (
 	ErrSolutionsInvalidMethod = errors.New("invalid method for solutions")
 	ErrSolutionsInvalidParam  = errors.New("invalid parameter for solutions")
 	ErrSolutionsStore         = errors.New("storage error for solutions")
+	ErrSolutionsEventRunning  = errors.New("solutions are hidden during an event")
+)
+
+var (
+	ErrStatsInvalidMethod = errors.New("invalid method for stats")
+	ErrStatsInvalidParam  = errors.New("invalid parameter for stats")
+	ErrStatsStore         = errors.New("storage error for stats")
+	ErrStatsNotFound      = errors.New("challenge not found")
+	ErrStatsEventRunning  = errors.New("stats are hidden during an event")
+)
+
+var (
+	ErrAdminDisabled       = errors.New("admin endpoints are disabled")
+	ErrAdminUnauthorized   = errors.New("invalid admin token")
+	ErrAdminInvalidAction  = errors.New("action must be one of hide, unhide, pin, unpin")
+	ErrAdminInvalidVersion = errors.New("invalid version")
+	ErrAdminInvalidClient  = errors.New("request must include client")
+)
+
+var (
+	ErrSessionInvalid        = errors.New("invalid session token")
+	ErrSessionRequired       = errors.New("request must include a session token")
+	ErrSessionStore          = errors.New("storage error for sessions")
+	ErrSessionNotSolved      = errors.New("command is not a correct solution")
+	ErrSessionImportTooLarge = errors.New("too many progress items to import")
+	ErrSessionInvalidHandle  = errors.New("handle must be 3 to 20 letters, digits, _ or -")
+	ErrSessionHandleBlocked  = errors.New("handle is not allowed")
+)
+
+var (
+	ErrHintInvalid = errors.New("n must be the number of a hint of the challenge")
+	ErrHintLocked  = errors.New("reveal the previous hints first")
+)
+
+var (
+	ErrLeaderboardStore = errors.New("storage error for leaderboard")
+)
+
+var (
+	ErrEventConfig           = errors.New("invalid event")
+	ErrEventInvalidToken     = errors.New("invalid event token")
+	ErrEventNotRunning       = errors.New("event is not running")
+	ErrEventInvalidChallenge = errors.New("challenge is not part of the event")
+	ErrEventNotFound         = errors.New("event not found")
+	ErrEventStore            = errors.New("storage error for events")
+)
+
+var (
+	ErrDailyConfig      = errors.New("no challenges in the daily pool")
+	ErrDailyInvalidDate = errors.New("date must be a past day formatted as YYYY-MM-DD")
+	ErrDailyStore       = errors.New("storage error for the daily challenge")
 )
 
+var (
+	ErrClassDisabled     = errors.New("classroom mode is disabled")
+	ErrClassUnauthorized = errors.New("invalid class token")
+	ErrClassInvalidName  = errors.New("name must be 1 to 40 letters, digits, spaces or '._-")
+	ErrClassInvalidTag   = errors.New("no challenges have the tag")
+	ErrClassInvalidCode  = errors.New("invalid join code")
+	ErrClassNoChallenges = errors.New("class must include at least one challenge")
+	ErrClassTooLarge     = errors.New("class has too many challenges")
+	ErrClassStore        = errors.New("storage error for classes")
+)
+
+var (
+	ErrBatchDisabled     = errors.New("batch endpoint is disabled")
+	ErrBatchUnauthorized = errors.New("invalid batch token")
+	ErrBatchEmpty        = errors.New("batch must include at least one item")
+	ErrBatchTooLarge     = errors.New("batch has too many items")
+)
+
+type errorCode struct {
+	code   string
+	status int
+}
+
+// Codes returned to clients in JSON error responses, these must not change
+// once released. They are documented in the README.
+var errorCodes = map[error]errorCode{
+	ErrServerCmdTooLong:       {"cmd_too_long", http.StatusBadRequest},
+	ErrServerInvalidMethod:    {"invalid_method", http.StatusMethodNotAllowed},
+	ErrServerInvalidRequest:   {"invalid_request", http.StatusBadRequest},
+	ErrServerInvalidChallenge: {"invalid_challenge", http.StatusBadRequest},
+	ErrServerUnknown:          {"unknown_error", http.StatusInternalServerError},
+	ErrServerDecode:           {"decode_error", http.StatusInternalServerError},
+	ErrServerInvalidBody:      {"invalid_request", http.StatusBadRequest},
+	ErrServerInvalidEncoding:  {"invalid_encoding", http.StatusBadRequest},
+	ErrServerContentType:      {"unsupported_media_type", http.StatusUnsupportedMediaType},
+	ErrServerBanned:           {"client_banned", http.StatusTooManyRequests},
+	ErrServerChallengeLocked:  {"challenge_locked", http.StatusForbidden},
+	ErrSolutionsInvalidMethod: {"invalid_method", http.StatusMethodNotAllowed},
+	ErrSolutionsInvalidParam:  {"invalid_param", http.StatusBadRequest},
+	ErrSolutionsStore:         {"store_error", http.StatusInternalServerError},
+	ErrSolutionsEventRunning:  {"event_running", http.StatusForbidden},
+	ErrStatsInvalidMethod:     {"invalid_method", http.StatusMethodNotAllowed},
+	ErrStatsInvalidParam:      {"invalid_param", http.StatusBadRequest},
+	ErrStatsStore:             {"store_error", http.StatusInternalServerError},
+	ErrStatsNotFound:          {"not_found", http.StatusNotFound},
+	ErrStatsEventRunning:      {"event_running", http.StatusForbidden},
+	ErrAdminDisabled:          {"admin_disabled", http.StatusForbidden},
+	ErrAdminUnauthorized:      {"unauthorized", http.StatusUnauthorized},
+	ErrAdminInvalidAction:     {"invalid_param", http.StatusBadRequest},
+	ErrAdminInvalidVersion:    {"invalid_param", http.StatusBadRequest},
+	ErrAdminInvalidClient:     {"invalid_param", http.StatusBadRequest},
+	ErrBatchDisabled:          {"batch_disabled", http.StatusForbidden},
+	ErrBatchUnauthorized:      {"unauthorized", http.StatusUnauthorized},
+	ErrBatchEmpty:             {"invalid_request", http.StatusBadRequest},
+	ErrBatchTooLarge:          {"batch_too_large", http.StatusRequestEntityTooLarge},
+	ErrSessionInvalid:         {"invalid_session", http.StatusUnauthorized},
+	ErrSessionRequired:        {"invalid_session", http.StatusUnauthorized},
+	ErrSessionStore:           {"store_error", http.StatusInternalServerError},
+	ErrSessionImportTooLarge:  {"import_too_large", http.StatusRequestEntityTooLarge},
+	ErrSessionInvalidHandle:   {"invalid_handle", http.StatusBadRequest},
+	ErrSessionHandleBlocked:   {"invalid_handle", http.StatusBadRequest},
+	ErrLeaderboardStore:       {"store_error", http.StatusInternalServerError},
+	ErrHintInvalid:            {"invalid_param", http.StatusBadRequest},
+	ErrHintLocked:             {"hint_locked", http.StatusForbidden},
+	ErrEventInvalidToken:      {"invalid_event", http.StatusUnauthorized},
+	ErrEventNotRunning:        {"event_closed", http.StatusForbidden},
+	ErrEventInvalidChallenge:  {"invalid_challenge", http.StatusBadRequest},
+	ErrEventNotFound:          {"not_found", http.StatusNotFound},
+	ErrEventStore:             {"store_error", http.StatusInternalServerError},
+	ErrDailyInvalidDate:       {"invalid_param", http.StatusBadRequest},
+	ErrDailyStore:             {"store_error", http.StatusInternalServerError},
+	ErrClassDisabled:          {"class_disabled", http.StatusForbidden},
+	ErrClassUnauthorized:      {"unauthorized", http.StatusUnauthorized},
+	ErrClassInvalidName:       {"invalid_param", http.StatusBadRequest},
+	ErrClassInvalidTag:        {"invalid_param", http.StatusBadRequest},
+	ErrClassInvalidCode:       {"not_found", http.StatusNotFound},
+	ErrClassNoChallenges:      {"invalid_request", http.StatusBadRequest},
+	ErrClassTooLarge:          {"invalid_request", http.StatusBadRequest},
+	ErrClassStore:             {"store_error", http.StatusInternalServerError},
+	store.ErrNameTaken:        {"name_taken", http.StatusConflict},
+	store.ErrHandleTaken:      {"handle_taken", http.StatusConflict},
+	store.ErrResultNotFound:   {"not_found", http.StatusNotFound},
+}
+
+// codeForError returns the error code and HTTP status for an error, errors
+// without a code are reported as unknown server errors.
+func codeForError(err error) (string, int) {
+	var chError *ChallengeError
+	if errors.As(err, &chError) {
+		return chError.Code()
+	}
+
+	if c, ok := errorCodes[err]; ok {
+		return c.code, c.status
+	}
+	for e, c := range errorCodes {
+		if errors.Is(err, e) {
+			return c.code, c.status
+		}
+	}
+
+	return "unknown_error", http.StatusInternalServerError
+}
+
+// errorLabel returns the metric label for an error. Wrapped errors are
+// labelled with the error they wrap, so that details such as slugs or times
+// don't grow the number of labels.
+func errorLabel(err error) string {
+	var chError *ChallengeError
+	if errors.As(err, &chError) {
+		return chError.Error()
+	}
+
+	if _, ok := errorCodes[err]; ok {
+		return err.Error()
+	}
+	for e := range errorCodes {
+		if errors.Is(err, e) {
+			return e.Error()
+		}
+	}
+
+	if errors.Unwrap(err) != nil {
+		return ErrServerUnknown.Error()
+	}
+	return err.Error()
+}
+
 var (
 	ErrCheckNotExist        = errors.New("check does not exist")
 	ErrOopsProccessNeverRan = errors.New("the oops process was never ran")
@@ -0,0 +1,363 @@
+package challenge
+
+import (
+	"cmp"
+	"crypto/subtle"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/gorilla/mux"
+	"gitlab.com/jarv/cmdchallenge/internal/config"
+	"gitlab.com/jarv/cmdchallenge/internal/metrics"
+	"gitlab.com/jarv/cmdchallenge/internal/store"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// EventHeader carries the token of the event a command is submitted to
+	EventHeader = "X-Event-Token"
+
+	ScoreSolves = "solves"
+	ScoreTime   = "time"
+	ScoreLength = "length"
+
+	EventUpcoming = "upcoming"
+	EventRunning  = "running"
+	EventEnded    = "ended"
+)
+
+var defaultScoring = []string{ScoreSolves, ScoreTime, ScoreLength}
+
+// Event is a timed competition over a set of challenges. Players submit
+// commands to it with its token while it is running, results are frozen
+// once it ends.
+type Event struct {
+	Name    string    `yaml:"name"`
+	Title   string    `yaml:"title"`
+	Start   time.Time `yaml:"start"`
+	End     time.Time `yaml:"end"`
+	Slugs   []string  `yaml:"slugs"`
+	Scoring []string  `yaml:"scoring"`
+	Token   string    `yaml:"token"`
+}
+
+func (e *Event) status(now time.Time) string {
+	switch {
+	case now.Before(e.Start):
+		return EventUpcoming
+	case now.Before(e.End):
+		return EventRunning
+	default:
+		return EventEnded
+	}
+}
+
+func (e *Event) validate() error {
+	if !slugRe.MatchString(e.Name) {
+		return fmt.Errorf("%w: invalid name %q", ErrEventConfig, e.Name)
+	}
+	if e.Token == "" {
+		return fmt.Errorf("%w: %s has no token", ErrEventConfig, e.Name)
+	}
+	if !e.End.After(e.Start) {
+		return fmt.Errorf("%w: %s must end after it starts", ErrEventConfig, e.Name)
+	}
+	if len(e.Slugs) == 0 {
+		return fmt.Errorf("%w: %s has no challenges", ErrEventConfig, e.Name)
+	}
+	for _, slug := range e.Slugs {
+		if ch, err := NewChallenge(ChallengeOptions{Slug: slug}); err != nil || ch.Slug() != slug {
+			return fmt.Errorf("%w: %s has unknown challenge %q", ErrEventConfig, e.Name, slug)
+		}
+	}
+
+	if len(e.Scoring) == 0 {
+		e.Scoring = defaultScoring
+	}
+	for _, rule := range e.Scoring {
+		if !slices.Contains(defaultScoring, rule) {
+			return fmt.Errorf("%w: %s has unknown scoring rule %q", ErrEventConfig, e.Name, rule)
+		}
+	}
+	return nil
+}
+
+// LoadEvents reads a list of events from a YAML file.
+func LoadEvents(fname string) ([]*Event, error) {
+	b, err := os.ReadFile(fname) // #nosec G304
+	if err != nil {
+		return nil, err
+	}
+
+	var events []*Event
+	if err := yaml.Unmarshal(b, &events); err != nil {
+		return nil, err
+	}
+
+	names := make(map[string]bool)
+	tokens := make(map[string]bool)
+	for _, e := range events {
+		if err := e.validate(); err != nil {
+			return nil, err
+		}
+		if names[e.Name] || tokens[e.Token] {
+			return nil, fmt.Errorf("%w: %s has a duplicate name or token", ErrEventConfig, e.Name)
+		}
+		names[e.Name], tokens[e.Token] = true, true
+	}
+	return events, nil
+}
+
+type jsonEvent struct {
+	Name   string    `json:"name"`
+	Title  string    `json:"title"`
+	Start  time.Time `json:"start"`
+	End    time.Time `json:"end"`
+	Slugs  []string  `json:"slugs"`
+	Status string    `json:"status"`
+}
+
+type jsonEvents struct {
+	Events []jsonEvent `json:"events"`
+}
+
+type jsonScoreboardEntry struct {
+	Rank        int    `json:"rank"`
+	Handle      string `json:"handle"`
+	Solved      int    `json:"solved"`
+	TimeSeconds int64  `json:"time_seconds"`
+	TotalLength int    `json:"total_length"`
+}
+
+type jsonScoreboard struct {
+	jsonEvent
+	Scoring []string              `json:"scoring"`
+	Frozen  bool                  `json:"frozen"`
+	Entries []jsonScoreboardEntry `json:"entries"`
+}
+
+// Events records the solves of players in events and serves their
+// scoreboards.
+type Events struct {
+	log     *slog.Logger
+	cfg     *config.Config
+	metrics *metrics.Metrics
+	storer  store.EventStorer
+	events  []*Event
+	now     func() time.Time
+}
+
+func NewEvents(log *slog.Logger, cfg *config.Config, m *metrics.Metrics, s store.EventStorer, events []*Event) *Events {
+	return &Events{
+		log:     log,
+		cfg:     cfg,
+		metrics: m,
+		storer:  s,
+		events:  events,
+		now:     time.Now,
+	}
+}
+
+func (e *Events) httpError(w http.ResponseWriter, err error) {
+	e.metrics.CmdErrors.WithLabelValues(errorLabel(err), TypeServer).Inc()
+	writeError(w, err)
+}
+
+// fromRequest returns the event a command for slug is submitted to, or nil
+// for requests without an event token. The event must be running and
+// include the challenge.
+func (e *Events) fromRequest(req *http.Request, slug string) (*Event, error) {
+	token := req.Header.Get(EventHeader)
+	if token == "" {
+		return nil, nil
+	}
+
+	i := slices.IndexFunc(e.events, func(ev *Event) bool { return hasToken(token, ev.Token) })
+	if i < 0 {
+		return nil, ErrEventInvalidToken
+	}
+
+	ev := e.events[i]
+	if ev.status(e.now()) != EventRunning {
+		return nil, ErrEventNotRunning
+	}
+	if !slices.Contains(ev.Slugs, slug) {
+		return nil, ErrEventInvalidChallenge
+	}
+	return ev, nil
+}
+
+// inRunningEvent reports whether slug is part of a running event, its
+// solutions and stats are hidden until the event ends.
+func (e *Events) inRunningEvent(slug string) bool {
+	if e == nil {
+		return false
+	}
+
+	now := e.now()
+	return slices.ContainsFunc(e.events, func(ev *Event) bool {
+		return ev.status(now) == EventRunning && slices.Contains(ev.Slugs, slug)
+	})
+}
+
+// running reports whether any event is running.
+func (e *Events) running() bool {
+	if e == nil {
+		return false
+	}
+
+	now := e.now()
+	return slices.ContainsFunc(e.events, func(ev *Event) bool { return ev.status(now) == EventRunning })
+}
+
+// record keeps a correct command of a session as a solve in the event,
+// commands that finish after the event ended aren't recorded.
+func (e *Events) record(ev *Event, sessionID, slug, cmd string) {
+	now := e.now()
+	if ev.status(now) != EventRunning {
+		e.log.Info("Not recording solve after the event ended", "event", ev.Name, "slug", slug)
+		return
+	}
+
+	err := e.storer.RecordEventSolve(ev.Name, sessionID, &store.EventSolve{
+		Slug:      slug,
+		Cmd:       cmd,
+		SolveTime: now,
+	})
+	if err != nil {
+		e.log.Error("Unable to record event solve", "event", ev.Name, "slug", slug, "err", err)
+	}
+}
+
+// ListHandler returns the configured events, without their tokens.
+func (e *Events) ListHandler() http.Handler {
+	return http.HandlerFunc(e.listHandler)
+}
+
+func (e *Events) listHandler(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Cache-Control", "public, max-age=10, s-maxage=10")
+
+	if req.Method != http.MethodGet {
+		e.log.Error("expected GET", "method", req.Method)
+		e.httpError(w, ErrServerInvalidMethod)
+		return
+	}
+
+	now := e.now()
+	resp := jsonEvents{Events: make([]jsonEvent, 0, len(e.events))}
+	for _, ev := range e.events {
+		resp.Events = append(resp.Events, ev.json(now))
+	}
+	writeJSON(w, &resp)
+}
+
+// ScoreboardHandler returns the ranking of the event of the name route
+// variable, players are ranked by the scoring rules of the event in order.
+func (e *Events) ScoreboardHandler() http.Handler {
+	return http.HandlerFunc(e.scoreboardHandler)
+}
+
+func (e *Events) scoreboardHandler(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		e.log.Error("expected GET", "method", req.Method)
+		e.httpError(w, ErrServerInvalidMethod)
+		return
+	}
+
+	name := mux.Vars(req)["name"]
+	i := slices.IndexFunc(e.events, func(ev *Event) bool { return ev.Name == name })
+	if i < 0 {
+		e.httpError(w, ErrEventNotFound)
+		return
+	}
+	ev := e.events[i]
+
+	solves, err := e.storer.EventSolves(ev.Name)
+	if err != nil {
+		e.log.Error("Unable to query event solves", "event", ev.Name, "err", err)
+		e.httpError(w, ErrEventStore)
+		return
+	}
+
+	now := e.now()
+	resp := jsonScoreboard{
+		jsonEvent: ev.json(now),
+		Scoring:   ev.Scoring,
+		Frozen:    ev.status(now) == EventEnded,
+		Entries:   scoreboard(ev, solves),
+	}
+
+	// Scoreboards don't change once the event ended
+	if resp.Frozen {
+		w.Header().Set("Cache-Control", "public, max-age=3600, s-maxage=3600")
+	} else {
+		w.Header().Set("Cache-Control", "public, max-age=5, s-maxage=5")
+	}
+	writeJSON(w, &resp)
+}
+
+func (ev *Event) json(now time.Time) jsonEvent {
+	return jsonEvent{
+		Name:   ev.Name,
+		Title:  ev.Title,
+		Start:  ev.Start.UTC(),
+		End:    ev.End.UTC(),
+		Slugs:  ev.Slugs,
+		Status: ev.status(now),
+	}
+}
+
+// scoreboard totals the solves of each player. Time is the sum of the time
+// from the start of the event to each solve.
+func scoreboard(ev *Event, solves []store.EventSolve) []jsonScoreboardEntry {
+	byHandle := make(map[string]*jsonScoreboardEntry)
+	for _, s := range solves {
+		if !slices.Contains(ev.Slugs, s.Slug) {
+			continue
+		}
+		entry, ok := byHandle[s.Handle]
+		if !ok {
+			entry = &jsonScoreboardEntry{Handle: s.Handle}
+			byHandle[s.Handle] = entry
+		}
+		entry.Solved++
+		entry.TimeSeconds += int64(s.SolveTime.Sub(ev.Start).Seconds())
+		entry.TotalLength += len(s.Cmd)
+	}
+
+	entries := make([]jsonScoreboardEntry, 0, len(byHandle))
+	for _, entry := range byHandle {
+		entries = append(entries, *entry)
+	}
+
+	slices.SortFunc(entries, func(a, b jsonScoreboardEntry) int {
+		for _, rule := range ev.Scoring {
+			var c int
+			switch rule {
+			case ScoreSolves:
+				c = cmp.Compare(b.Solved, a.Solved)
+			case ScoreTime:
+				c = cmp.Compare(a.TimeSeconds, b.TimeSeconds)
+			case ScoreLength:
+				c = cmp.Compare(a.TotalLength, b.TotalLength)
+			}
+			if c != 0 {
+				return c
+			}
+		}
+		return cmp.Compare(a.Handle, b.Handle)
+	})
+
+	for i := range entries {
+		entries[i].Rank = i + 1
+	}
+	return entries
+}
+
+func hasToken(got, token string) bool {
+	return subtle.ConstantTimeCompare([]byte(got), []byte(token)) == 1
+}
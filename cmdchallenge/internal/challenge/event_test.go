@@ -0,0 +1,182 @@
+package challenge
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gitlab.com/jarv/cmdchallenge/internal/metrics"
+	"gitlab.com/jarv/cmdchallenge/internal/store"
+)
+
+var eventStart = time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+func testEvent() *Event {
+	return &Event{
+		Name:    "ctf",
+		Start:   eventStart,
+		End:     eventStart.Add(time.Hour),
+		Slugs:   []string{"hello_world"},
+		Scoring: defaultScoring,
+		Token:   "secret",
+	}
+}
+
+func getScoreboard(e *Events, name string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(http.MethodGet, "/c/events/"+name+"/scoreboard", http.NoBody)
+	req = mux.SetURLVars(req, map[string]string{"name": name})
+	resp := httptest.NewRecorder()
+	e.ScoreboardHandler().ServeHTTP(resp, req)
+	return resp
+}
+
+func TestLoadEvents(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "events.yaml")
+	require.NoError(t, os.WriteFile(fname, []byte(`
+- name: ctf
+  title: CTF
+  start: 2026-01-01T12:00:00Z
+  end: 2026-01-01T13:00:00Z
+  slugs: [hello_world]
+  token: secret
+`), 0o600))
+
+	events, err := LoadEvents(fname)
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.Equal(t, eventStart, events[0].Start)
+	assert.Equal(t, defaultScoring, events[0].Scoring)
+
+	for _, body := range []string{
+		"- {name: ctf, start: 2026-01-01T12:00:00Z, end: 2026-01-01T13:00:00Z, slugs: [hello_world]}",
+		"- {name: ctf, start: 2026-01-01T13:00:00Z, end: 2026-01-01T12:00:00Z, slugs: [hello_world], token: a}",
+		"- {name: ctf, start: 2026-01-01T12:00:00Z, end: 2026-01-01T13:00:00Z, slugs: [nope], token: a}",
+		"- {name: ctf, start: 2026-01-01T12:00:00Z, end: 2026-01-01T13:00:00Z, slugs: [hello_world], token: a, scoring: [luck]}",
+	} {
+		require.NoError(t, os.WriteFile(fname, []byte(body), 0o600))
+		_, err := LoadEvents(fname)
+		assert.ErrorIs(t, err, ErrEventConfig, body)
+	}
+}
+
+func TestEventSubmit(t *testing.T) {
+	stubStore := &StubStor{}
+	stubStore.On("GetResult", "echo hello world", "hello_world", 5).Return(&fakeStore, nil)
+	stubStore.On("IncrementResult", "echo hello world", "hello_world", 5).Return(nil)
+
+	m := metrics.New(testLogger(t))
+	ss := store.NewMemSessionStore()
+	sessions := NewSessions(testLogger(t), cfg, m, ss, stubStore, nil)
+	events := NewEvents(testLogger(t), cfg, m, ss, []*Event{testEvent()})
+	now := eventStart.Add(10 * time.Minute)
+	events.now = func() time.Time { return now }
+	s := NewServer(testLogger(t), cfg, m, &StubRunnerExecutor{}, stubStore, ServerOptions{Sessions: sessions, Events: events})
+
+	token := newTestSession(t, sessions)
+	require.NoError(t, ss.SetHandle(sessionID(token), "alice"))
+
+	submit := func(sessionToken, eventToken string) *httptest.ResponseRecorder {
+		req, resp := createTestRequest()
+		if sessionToken != "" {
+			req.Header.Set(SessionHeader, sessionToken)
+		}
+		req.Header.Set(EventHeader, eventToken)
+		s.runHandler(resp, req)
+		return resp
+	}
+
+	assert.Equal(t, 401, submit(token, "wrong").Code)
+	assert.Equal(t, 401, submit("", "secret").Code)
+	require.Equal(t, 200, submit(token, "secret").Code)
+
+	resp := getScoreboard(events, "ctf")
+	assert.Equal(t, 200, resp.Code)
+	assert.Contains(t, resp.Body.String(), `"frozen":false`)
+	assert.Contains(t, resp.Body.String(),
+		`"entries":[{"rank":1,"handle":"alice","solved":1,"time_seconds":600,"total_length":16}]`)
+
+	// Results are frozen once the event ended
+	now = eventStart.Add(2 * time.Hour)
+	resp = submit(token, "secret")
+	assert.Equal(t, 403, resp.Code)
+	assert.Contains(t, resp.Body.String(), `"code":"event_closed"`)
+
+	resp = getScoreboard(events, "ctf")
+	assert.Contains(t, resp.Body.String(), `"status":"ended","scoring":["solves","time","length"],"frozen":true`)
+	assert.Equal(t, 404, getScoreboard(events, "nope").Code)
+}
+
+func TestEventScoreboard(t *testing.T) {
+	solve := func(handle string, minutes int, cmd string) store.EventSolve {
+		return store.EventSolve{
+			Handle:    handle,
+			Slug:      "hello_world",
+			Cmd:       cmd,
+			SolveTime: eventStart.Add(time.Duration(minutes) * time.Minute),
+		}
+	}
+	solves := []store.EventSolve{
+		solve("alice", 10, "echo hello world"),
+		solve("bob", 5, "echo hello    world"),
+		solve("carol", 5, "echo hello world"),
+		{Handle: "dave", Slug: "current_working_directory", Cmd: "pwd", SolveTime: eventStart},
+	}
+
+	ev := testEvent()
+	var handles []string
+	for _, e := range scoreboard(ev, solves) {
+		handles = append(handles, e.Handle)
+	}
+	// Solves of challenges outside the event don't count
+	assert.Equal(t, []string{"carol", "bob", "alice"}, handles)
+
+	ev.Scoring = []string{ScoreLength, ScoreTime}
+	handles = nil
+	for _, e := range scoreboard(ev, solves) {
+		handles = append(handles, e.Handle)
+	}
+	assert.Equal(t, []string{"carol", "alice", "bob"}, handles)
+}
+
+func TestEventHidesSolutionsAndStats(t *testing.T) {
+	m := metrics.New(testLogger(t))
+	events := NewEvents(testLogger(t), cfg, m, store.NewMemSessionStore(), []*Event{testEvent()})
+	now := eventStart.Add(10 * time.Minute)
+	events.now = func() time.Time { return now }
+
+	stubStore := &StubStor{}
+	solutions := NewSolutions(testLogger(t), cfg, m, stubStore, nil, events)
+	stats := NewStats(testLogger(t), cfg, m, stubStore, events)
+
+	req, resp := createSolutionsRequest("slug=hello_world")
+	solutions.runHandler(resp, req)
+	assert.Equal(t, 403, resp.Code)
+	assert.Contains(t, resp.Body.String(), `"code":"event_running"`)
+	assert.Equal(t, "no-store", resp.Header().Get("Cache-Control"))
+
+	req, resp = createStatsRequest("hello_world")
+	stats.runHandler(resp, req)
+	assert.Equal(t, 403, resp.Code)
+	assert.Contains(t, resp.Body.String(), `"code":"event_running"`)
+
+	// Challenges that aren't in the event are still published
+	stubStore.On("StatsForSlug", "current_working_directory", 5).Return(&store.SlugStats{}, nil).Once()
+	req, resp = createStatsRequest("current_working_directory")
+	stats.runHandler(resp, req)
+	assert.Equal(t, 200, resp.Code)
+
+	// Everything is published once the event ends
+	now = eventStart.Add(2 * time.Hour)
+	stubStore.On("TopCmdsForSlug", store.CmdsQuery{Slug: "hello_world", Sort: store.SortPopular, Limit: defaultSolutionsLimit + 1}).
+		Return(fakeSolutions, nil).Once()
+	req, resp = createSolutionsRequest("slug=hello_world")
+	solutions.runHandler(resp, req)
+	assert.Equal(t, 200, resp.Code)
+	stubStore.AssertExpectations(t)
+}
@@ -0,0 +1,125 @@
+package challenge
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sync/atomic"
+
+	"gitlab.com/jarv/cmdchallenge/internal/config"
+	"gitlab.com/jarv/cmdchallenge/internal/store"
+)
+
+const (
+	healthOK          = "ok"
+	healthUnavailable = "unavailable"
+)
+
+// RunnerChecker is implemented by runners that can report whether they are
+// able to run commands.
+type RunnerChecker interface {
+	Ping(ctx context.Context) error
+	CheckImages(ctx context.Context) error
+}
+
+type jsonHealth struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+type Health struct {
+	log       *slog.Logger
+	cfg       *config.Config
+	runner    RunnerChecker
+	cmdStorer store.CmdStorer
+
+	// Set while the command images are pulled on startup
+	pulling atomic.Bool
+}
+
+func NewHealth(
+	log *slog.Logger,
+	cfg *config.Config,
+	r RunnerChecker,
+	s store.CmdStorer,
+) *Health {
+	return &Health{
+		log:       log,
+		cfg:       cfg,
+		runner:    r,
+		cmdStorer: s,
+	}
+}
+
+// PullImages runs pull in the background, readiness fails until it returns
+// so that traffic isn't sent to a server that is still pulling images.
+func (h *Health) PullImages(pull func() error) {
+	h.pulling.Store(true)
+	go func() {
+		defer h.pulling.Store(false)
+		if err := pull(); err != nil {
+			h.log.Error("Unable to pull images", "err", err)
+		}
+	}()
+}
+
+func (h *Health) checkImages(ctx context.Context) error {
+	if h.pulling.Load() {
+		return ErrHealthPulling
+	}
+	return h.runner.CheckImages(ctx)
+}
+
+// LiveHandler reports that the process is up, it doesn't check dependencies.
+func (h *Health) LiveHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		writeHealth(w, http.StatusOK, &jsonHealth{Status: healthOK})
+	})
+}
+
+// ReadyHandler reports whether commands can be served, the Docker daemon
+// must be reachable, the command images pulled and present and the store
+// responding.
+func (h *Health) ReadyHandler() http.Handler {
+	return http.HandlerFunc(h.readyHandler)
+}
+
+func (h *Health) readyHandler(w http.ResponseWriter, req *http.Request) {
+	ctx, cancel := context.WithTimeout(req.Context(), h.cfg.ReadyTimeout)
+	defer cancel()
+
+	checks := []struct {
+		name  string
+		check func(context.Context) error
+	}{
+		{"docker", h.runner.Ping},
+		{"images", h.checkImages},
+		{"store", h.cmdStorer.Ping},
+	}
+
+	resp := jsonHealth{Status: healthOK, Checks: make(map[string]string)}
+	status := http.StatusOK
+
+	for _, c := range checks {
+		if err := c.check(ctx); err != nil {
+			h.log.Warn("Readiness check failed", "check", c.name, "err", err)
+			resp.Checks[c.name] = err.Error()
+			resp.Status = healthUnavailable
+			status = http.StatusServiceUnavailable
+			continue
+		}
+		resp.Checks[c.name] = healthOK
+	}
+
+	writeHealth(w, status, &resp)
+}
+
+func writeHealth(w http.ResponseWriter, status int, resp *jsonHealth) {
+	b, _ := json.Marshal(resp)
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store, max-age=0")
+	w.WriteHeader(status)
+	_, _ = w.Write(b)
+}
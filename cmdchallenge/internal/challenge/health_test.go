@@ -0,0 +1,113 @@
+package challenge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type StubRunnerChecker struct {
+	mock.Mock
+}
+
+func (s *StubRunnerChecker) Ping(ctx context.Context) error {
+	args := s.Called()
+
+	return args.Error(0)
+}
+
+func (s *StubRunnerChecker) CheckImages(ctx context.Context) error {
+	args := s.Called()
+
+	return args.Error(0)
+}
+
+func TestHealthz(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodGet, "/healthz", http.NoBody)
+	resp := httptest.NewRecorder()
+
+	NewHealth(testLogger(t), cfg, &StubRunnerChecker{}, &StubStor{}).LiveHandler().ServeHTTP(resp, req)
+
+	assert.Equal(t, `{"status":"ok"}`, resp.Body.String())
+	assert.Equal(t, 200, resp.Code)
+}
+
+func TestReadyz(t *testing.T) {
+	runner := &StubRunnerChecker{}
+	runner.On("Ping").Return(nil).Once()
+	runner.On("CheckImages").Return(nil).Once()
+
+	stubStore := &StubStor{}
+	stubStore.On("Ping").Return(nil).Once()
+
+	req, _ := http.NewRequest(http.MethodGet, "/readyz", http.NoBody)
+	resp := httptest.NewRecorder()
+	NewHealth(testLogger(t), cfg, runner, stubStore).ReadyHandler().ServeHTTP(resp, req)
+
+	runner.AssertExpectations(t)
+	stubStore.AssertExpectations(t)
+	assert.Equal(t, `{"status":"ok","checks":{"docker":"ok","images":"ok","store":"ok"}}`, resp.Body.String())
+	assert.Equal(t, 200, resp.Code)
+}
+
+func TestReadyzImagesMissing(t *testing.T) {
+	runner := &StubRunnerChecker{}
+	runner.On("Ping").Return(nil).Once()
+	runner.On("CheckImages").Return(fmt.Errorf("%w: %s", ErrRunnerImageMissing, "cmd:amd64")).Once()
+
+	stubStore := &StubStor{}
+	stubStore.On("Ping").Return(errors.New("db gone")).Once()
+
+	req, _ := http.NewRequest(http.MethodGet, "/readyz", http.NoBody)
+	resp := httptest.NewRecorder()
+	NewHealth(testLogger(t), cfg, runner, stubStore).ReadyHandler().ServeHTTP(resp, req)
+
+	runner.AssertExpectations(t)
+	stubStore.AssertExpectations(t)
+	assert.Equal(t, `{"status":"unavailable","checks":{"docker":"ok","images":"image is not present: cmd:amd64","store":"db gone"}}`,
+		resp.Body.String())
+	assert.Equal(t, 503, resp.Code)
+}
+
+func TestReadyzPullingImages(t *testing.T) {
+	runner := &StubRunnerChecker{}
+	runner.On("Ping").Return(nil).Twice()
+	runner.On("CheckImages").Return(nil).Once()
+
+	stubStore := &StubStor{}
+	stubStore.On("Ping").Return(nil).Twice()
+
+	health := NewHealth(testLogger(t), cfg, runner, stubStore)
+	pulled := make(chan error)
+	done := make(chan struct{})
+	health.PullImages(func() error {
+		defer close(done)
+		return <-pulled
+	})
+
+	req, _ := http.NewRequest(http.MethodGet, "/readyz", http.NoBody)
+	resp := httptest.NewRecorder()
+	health.ReadyHandler().ServeHTTP(resp, req)
+	assert.Equal(t, `{"status":"unavailable","checks":{"docker":"ok","images":"pulling images","store":"ok"}}`, resp.Body.String())
+	assert.Equal(t, 503, resp.Code)
+
+	// A failed pull still lets the images check report what is missing
+	pulled <- errors.New("registry gone")
+	<-done
+	assert.Eventually(t, func() bool { return !health.pulling.Load() }, time.Second, time.Millisecond)
+
+	resp = httptest.NewRecorder()
+	health.ReadyHandler().ServeHTTP(resp, req)
+	assert.Equal(t, `{"status":"ok","checks":{"docker":"ok","images":"ok","store":"ok"}}`, resp.Body.String())
+	assert.Equal(t, 200, resp.Code)
+
+	runner.AssertExpectations(t)
+	stubStore.AssertExpectations(t)
+}
@@ -0,0 +1,86 @@
+package challenge
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+type jsonHint struct {
+	Slug  string `json:"slug"`
+	N     int    `json:"n"`
+	Total int    `json:"total"`
+	Hint  string `json:"hint"`
+}
+
+// HintHandler reveals hint n of the challenge of the slug route variable to
+// the session of the request. Hints are revealed in order, the number used
+// is recorded for the current challenge version and counts against the
+// session on leaderboards. Hints already revealed can be requested again.
+func (s *Sessions) HintHandler() http.Handler {
+	return http.HandlerFunc(s.hintHandler)
+}
+
+func (s *Sessions) hintHandler(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Cache-Control", "no-store, max-age=0")
+
+	if req.Method != http.MethodGet {
+		s.log.Error("expect GET", "method", req.Method)
+		s.httpError(w, ErrServerInvalidMethod)
+		return
+	}
+
+	id, ok := s.requireSession(w, req)
+	if !ok {
+		return
+	}
+
+	slug := mux.Vars(req)["slug"]
+	ch, err := NewChallenge(ChallengeOptions{Slug: slug})
+	if err != nil || ch.Slug() != slug {
+		s.httpError(w, ErrServerInvalidChallenge)
+		return
+	}
+
+	if err := s.checkUnlocked(id, ch); err != nil {
+		s.httpError(w, err)
+		return
+	}
+
+	hints := ch.Hints()
+	n := 1
+	if v := req.URL.Query().Get("n"); v != "" {
+		if n, err = strconv.Atoi(v); err != nil || n < 1 || n > len(hints) {
+			s.httpError(w, ErrHintInvalid)
+			return
+		}
+	}
+	if len(hints) == 0 {
+		s.httpError(w, ErrHintInvalid)
+		return
+	}
+
+	used, err := s.sessionStorer.HintsUsed(id, ch.Slug(), ch.Version())
+	if err != nil {
+		s.log.Error("Unable to query hints used", "err", err)
+		s.httpError(w, ErrSessionStore)
+		return
+	}
+	if n > used+1 {
+		s.httpError(w, ErrHintLocked)
+		return
+	}
+
+	if n > used {
+		if err := s.sessionStorer.RecordHintsUsed(id, ch.Slug(), ch.Version(), n, time.Now()); err != nil {
+			s.log.Error("Unable to record hint used", "err", err)
+			s.httpError(w, ErrSessionStore)
+			return
+		}
+		s.metrics.HintsRevealed.WithLabelValues(ch.Slug()).Inc()
+	}
+
+	writeJSON(w, &jsonHint{Slug: ch.Slug(), N: n, Total: len(hints), Hint: hints[n-1]})
+}
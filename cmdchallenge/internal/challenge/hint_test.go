@@ -0,0 +1,51 @@
+package challenge
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gitlab.com/jarv/cmdchallenge/internal/metrics"
+	"gitlab.com/jarv/cmdchallenge/internal/store"
+)
+
+func getHint(sessions *Sessions, token, slug, n string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(http.MethodGet, "/c/hint/"+slug+"?n="+n, http.NoBody)
+	req = mux.SetURLVars(req, map[string]string{"slug": slug})
+	if token != "" {
+		req.Header.Set(SessionHeader, token)
+	}
+	resp := httptest.NewRecorder()
+	sessions.HintHandler().ServeHTTP(resp, req)
+	return resp
+}
+
+func TestHints(t *testing.T) {
+	ss := store.NewMemSessionStore()
+	sessions := NewSessions(testLogger(t), cfg, metrics.New(testLogger(t)), ss, &StubStor{}, nil)
+	token := newTestSession(t, sessions)
+
+	assert.Equal(t, 401, getHint(sessions, "", "current_working_directory", "1").Code)
+	assert.Equal(t, 400, getHint(sessions, token, "does_not_exist", "1").Code)
+	assert.Equal(t, 400, getHint(sessions, token, "hello_world", "1").Code)
+	assert.Equal(t, 400, getHint(sessions, token, "current_working_directory", "4").Code)
+
+	// Hints are revealed in order
+	resp := getHint(sessions, token, "current_working_directory", "2")
+	assert.Equal(t, 403, resp.Code)
+	assert.Contains(t, resp.Body.String(), `"code":"hint_locked"`)
+
+	resp = getHint(sessions, token, "current_working_directory", "")
+	require.Equal(t, 200, resp.Code)
+	assert.Equal(t, `{"slug":"current_working_directory","n":1,"total":3,`+
+		`"hint":"The working directory is the directory the command runs in."}`, resp.Body.String())
+	assert.Equal(t, 200, getHint(sessions, token, "current_working_directory", "2").Code)
+	assert.Equal(t, 200, getHint(sessions, token, "current_working_directory", "1").Code)
+
+	n, err := ss.HintsUsed(sessionID(token), "current_working_directory", 5)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+}
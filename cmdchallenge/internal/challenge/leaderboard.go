@@ -0,0 +1,234 @@
+package challenge
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"gitlab.com/jarv/cmdchallenge/internal/config"
+	"gitlab.com/jarv/cmdchallenge/internal/metrics"
+	"gitlab.com/jarv/cmdchallenge/internal/store"
+)
+
+type jsonLeaderboardEntry struct {
+	Rank     int       `json:"rank"`
+	Handle   string    `json:"handle"`
+	Cmd      string    `json:"cmd"`
+	Length   int       `json:"length"`
+	Hints    int       `json:"hints"`
+	Score    int       `json:"score"`
+	SolvedAt time.Time `json:"solved_at"`
+}
+
+type jsonLeaderboard struct {
+	Slug    string                 `json:"slug"`
+	Version int                    `json:"version"`
+	Entries []jsonLeaderboardEntry `json:"entries"`
+}
+
+type jsonOverallEntry struct {
+	Rank        int    `json:"rank"`
+	Handle      string `json:"handle"`
+	Solved      int    `json:"solved"`
+	TotalLength int    `json:"total_length"`
+	Hints       int    `json:"hints"`
+	Score       int    `json:"score"`
+}
+
+type jsonOverall struct {
+	Entries []jsonOverallEntry `json:"entries"`
+}
+
+type cachedLeaderboard struct {
+	body    []byte
+	expires time.Time
+}
+
+// Leaderboard ranks players with a handle by the shortest correct command
+// they sent for each challenge, each hint they used adds HintPenalty to its
+// length. The first to send a command of the same score ranks higher.
+// Commands matching the blocklist aren't shown, leaderboards are cached for
+// LeaderboardCacheTTL. Challenges of running events are hidden until the
+// event ends.
+type Leaderboard struct {
+	log       *slog.Logger
+	cfg       *config.Config
+	metrics   *metrics.Metrics
+	storer    store.LeaderboardStorer
+	blocklist *Blocklist
+	events    *Events
+
+	mu    sync.Mutex
+	cache map[string]cachedLeaderboard
+}
+
+func NewLeaderboard(
+	log *slog.Logger,
+	cfg *config.Config,
+	m *metrics.Metrics,
+	s store.LeaderboardStorer,
+	bl *Blocklist,
+	events *Events,
+) *Leaderboard {
+	return &Leaderboard{
+		log:       log,
+		cfg:       cfg,
+		metrics:   m,
+		storer:    s,
+		blocklist: bl,
+		events:    events,
+		cache:     make(map[string]cachedLeaderboard),
+	}
+}
+
+func (l *Leaderboard) httpError(w http.ResponseWriter, e error) {
+	l.metrics.CmdErrors.WithLabelValues(errorLabel(e), TypeServer).Inc()
+	writeError(w, e)
+}
+
+// Handler serves the leaderboard of the slug route variable, or the overall
+// leaderboard when there is none.
+func (l *Leaderboard) Handler() http.Handler {
+	return http.HandlerFunc(l.runHandler)
+}
+
+func (l *Leaderboard) runHandler(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	if req.Method != http.MethodGet {
+		l.log.Error("expected GET", "method", req.Method)
+		l.httpError(w, ErrServerInvalidMethod)
+		return
+	}
+
+	slug := mux.Vars(req)["slug"]
+
+	if l.events.inRunningEvent(slug) {
+		l.log.Info("Leaderboard hidden during an event", "slug", slug)
+		w.Header().Set("Cache-Control", "no-store")
+		l.httpError(w, ErrSolutionsEventRunning)
+		return
+	}
+
+	var (
+		b   []byte
+		err error
+	)
+	maxAge := int(l.cfg.LeaderboardCacheTTL.Seconds())
+	cacheControl := fmt.Sprintf("public, max-age=%d, s-maxage=%d", maxAge, maxAge)
+	switch {
+	case slug != "":
+		b, err = l.cached(slug, func() ([]byte, error) { return l.forSlug(slug) })
+	case l.events.running():
+		// Challenges of running events are left out, the leaderboard
+		// changes when they end so it isn't cached
+		cacheControl = "no-store"
+		b, err = l.overall()
+	default:
+		b, err = l.cached(slug, l.overall)
+	}
+	if err != nil {
+		l.httpError(w, err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", cacheControl)
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	_, _ = w.Write(b)
+}
+
+// cached returns the leaderboard for key from the cache, building it with
+// build if it is missing or expired.
+func (l *Leaderboard) cached(key string, build func() ([]byte, error)) ([]byte, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if c, ok := l.cache[key]; ok && now.Before(c.expires) {
+		return c.body, nil
+	}
+
+	b, err := build()
+	if err != nil {
+		return nil, err
+	}
+
+	l.cache[key] = cachedLeaderboard{body: b, expires: now.Add(l.cfg.LeaderboardCacheTTL)}
+	return b, nil
+}
+
+func (l *Leaderboard) forSlug(slug string) ([]byte, error) {
+	ch, err := NewChallenge(ChallengeOptions{Slug: slug})
+	if err != nil || ch.Slug() != slug {
+		return nil, ErrServerInvalidChallenge
+	}
+
+	entries, err := l.storer.SlugLeaderboard(ch.Slug(), ch.Version(), l.cfg.HintPenalty, l.cfg.LeaderboardSize)
+	if err != nil {
+		l.log.Error("Unable to query leaderboard", "slug", slug, "err", err)
+		return nil, ErrLeaderboardStore
+	}
+
+	resp := jsonLeaderboard{
+		Slug:    ch.Slug(),
+		Version: ch.Version(),
+		Entries: make([]jsonLeaderboardEntry, 0, len(entries)),
+	}
+	for _, e := range entries {
+		if l.blocklist.Matches(e.Cmd) {
+			continue
+		}
+		resp.Entries = append(resp.Entries, jsonLeaderboardEntry{
+			Rank:     len(resp.Entries) + 1,
+			Handle:   e.Handle,
+			Cmd:      e.Cmd,
+			Length:   e.Length,
+			Hints:    e.Hints,
+			Score:    e.Score,
+			SolvedAt: e.SolvedTime.UTC(),
+		})
+	}
+
+	return json.Marshal(&resp)
+}
+
+// overall ranks players by their progress for the current version of every
+// challenge that isn't part of a running event.
+func (l *Leaderboard) overall() ([]byte, error) {
+	chs, err := AllChallenges()
+	if err != nil {
+		return nil, err
+	}
+
+	versions := make([]store.SlugVersion, 0, len(chs))
+	for _, ch := range chs {
+		if l.events.inRunningEvent(ch.Slug()) {
+			continue
+		}
+		versions = append(versions, store.SlugVersion{Slug: ch.Slug(), Version: ch.Version()})
+	}
+
+	entries, err := l.storer.OverallLeaderboard(versions, l.cfg.HintPenalty, l.cfg.LeaderboardSize)
+	if err != nil {
+		l.log.Error("Unable to query overall leaderboard", "err", err)
+		return nil, ErrLeaderboardStore
+	}
+
+	resp := jsonOverall{Entries: make([]jsonOverallEntry, 0, len(entries))}
+	for i, e := range entries {
+		resp.Entries = append(resp.Entries, jsonOverallEntry{
+			Rank:        i + 1,
+			Handle:      e.Handle,
+			Solved:      e.Solved,
+			TotalLength: e.TotalLength,
+			Hints:       e.Hints,
+			Score:       e.Score,
+		})
+	}
+
+	return json.Marshal(&resp)
+}
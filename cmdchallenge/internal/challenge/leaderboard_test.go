@@ -0,0 +1,115 @@
+package challenge
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"gitlab.com/jarv/cmdchallenge/internal/metrics"
+	"gitlab.com/jarv/cmdchallenge/internal/store"
+)
+
+type StubLeaderboardStor struct {
+	mock.Mock
+}
+
+func (s *StubLeaderboardStor) SlugLeaderboard(slug string, version, hintPenalty, limit int) ([]store.LeaderboardEntry, error) {
+	args := s.Called(slug, version, hintPenalty, limit)
+
+	return args.Get(0).([]store.LeaderboardEntry), args.Error(1)
+}
+
+func (s *StubLeaderboardStor) OverallLeaderboard(versions []store.SlugVersion, hintPenalty, limit int) ([]store.OverallEntry, error) {
+	args := s.Called(versions, hintPenalty, limit)
+
+	return args.Get(0).([]store.OverallEntry), args.Error(1)
+}
+
+func TestLeaderboard(t *testing.T) {
+	solved := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	stubStore := &StubLeaderboardStor{}
+	stubStore.On("SlugLeaderboard", "hello_world", 5, cfg.HintPenalty, cfg.LeaderboardSize).Return([]store.LeaderboardEntry{
+		{Handle: "bob", Cmd: "echo badword", Length: 12, Score: 12, SolvedTime: solved},
+		{Handle: "alice", Cmd: "echo hello world", Length: 16, Hints: 1, Score: 26, SolvedTime: solved},
+	}, nil).Once()
+
+	bl, err := NewBlocklist([]string{"badword"})
+	require.NoError(t, err)
+	l := NewLeaderboard(testLogger(t), cfg, metrics.New(testLogger(t)), stubStore, bl, nil)
+
+	// The second request is served from the cache
+	for range 2 {
+		resp := createLeaderboardRequest(l, "hello_world")
+		assert.Equal(t, 200, resp.Code)
+		assert.Equal(t, `{"slug":"hello_world","version":5,"entries":[`+
+			`{"rank":1,"handle":"alice","cmd":"echo hello world","length":16,"hints":1,"score":26,"solved_at":"2024-01-02T03:04:05Z"}]}`,
+			resp.Body.String())
+		assert.Equal(t, "public, max-age=30, s-maxage=30", resp.Header().Get("Cache-Control"))
+	}
+	stubStore.AssertExpectations(t)
+}
+
+func TestLeaderboardOverall(t *testing.T) {
+	stubStore := &StubLeaderboardStor{}
+	stubStore.On("OverallLeaderboard", mock.Anything, cfg.HintPenalty, cfg.LeaderboardSize).Return([]store.OverallEntry{
+		{Handle: "alice", Solved: 2, TotalLength: 19, Score: 19},
+		{Handle: "bob", Solved: 1, TotalLength: 16, Hints: 1, Score: 26},
+	}, nil).Once()
+
+	l := NewLeaderboard(testLogger(t), cfg, metrics.New(testLogger(t)), stubStore, nil, nil)
+	resp := createLeaderboardRequest(l, "")
+
+	stubStore.AssertExpectations(t)
+	assert.Equal(t, `{"entries":[{"rank":1,"handle":"alice","solved":2,"total_length":19,"hints":0,"score":19},`+
+		`{"rank":2,"handle":"bob","solved":1,"total_length":16,"hints":1,"score":26}]}`, resp.Body.String())
+}
+
+func TestLeaderboardEventRunning(t *testing.T) {
+	m := metrics.New(testLogger(t))
+	events := NewEvents(testLogger(t), cfg, m, store.NewMemSessionStore(), []*Event{testEvent()})
+	events.now = func() time.Time { return eventStart.Add(10 * time.Minute) }
+
+	// The overall leaderboard leaves out the challenges of the event and
+	// isn't cached
+	stubStore := &StubLeaderboardStor{}
+	stubStore.On("OverallLeaderboard", mock.MatchedBy(func(versions []store.SlugVersion) bool {
+		return len(versions) > 0 && !slices.ContainsFunc(versions, func(v store.SlugVersion) bool { return v.Slug == "hello_world" })
+	}), cfg.HintPenalty, cfg.LeaderboardSize).Return([]store.OverallEntry{}, nil).Twice()
+
+	l := NewLeaderboard(testLogger(t), cfg, m, stubStore, nil, events)
+	for range 2 {
+		resp := createLeaderboardRequest(l, "")
+		assert.Equal(t, 200, resp.Code)
+		assert.Equal(t, "no-store", resp.Header().Get("Cache-Control"))
+	}
+
+	resp := createLeaderboardRequest(l, "hello_world")
+	assert.Equal(t, 403, resp.Code)
+	assert.Contains(t, resp.Body.String(), `"code":"event_running"`)
+	assert.Equal(t, "no-store", resp.Header().Get("Cache-Control"))
+	stubStore.AssertExpectations(t)
+}
+
+func TestLeaderboardInvalidSlug(t *testing.T) {
+	l := NewLeaderboard(testLogger(t), cfg, metrics.New(testLogger(t)), &StubLeaderboardStor{}, nil, nil)
+	resp := createLeaderboardRequest(l, "does_not_exist")
+
+	assert.Equal(t, 400, resp.Code)
+	assert.Contains(t, resp.Body.String(), `"code":"invalid_challenge"`)
+}
+
+func createLeaderboardRequest(l *Leaderboard, slug string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(http.MethodGet, "/c/leaderboard/"+slug, http.NoBody)
+	if slug != "" {
+		req = mux.SetURLVars(req, map[string]string{"slug": slug})
+	}
+	resp := httptest.NewRecorder()
+	l.Handler().ServeHTTP(resp, req)
+	return resp
+}
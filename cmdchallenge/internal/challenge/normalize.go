@@ -0,0 +1,28 @@
+package challenge
+
+import (
+	"strings"
+
+	"mvdan.cc/sh/v3/syntax"
+)
+
+// NormalizeCmd returns the canonical form of a command that is used as the
+// result cache key. The command is parsed as bash and printed back, which
+// trims it, collapses whitespace between words and drops trailing
+// semicolons while leaving quoted strings, heredocs and comments alone.
+// Commands that don't parse are only trimmed, they will fail the same way
+// no matter how they are spaced.
+func NormalizeCmd(cmd string) string {
+	parser := syntax.NewParser(syntax.Variant(syntax.LangBash), syntax.KeepComments(true))
+	f, err := parser.Parse(strings.NewReader(cmd), "")
+	if err != nil {
+		return strings.TrimSpace(cmd)
+	}
+
+	var b strings.Builder
+	if err := syntax.NewPrinter(syntax.SingleLine(true)).Print(&b, f); err != nil {
+		return strings.TrimSpace(cmd)
+	}
+
+	return strings.TrimSpace(b.String())
+}
@@ -0,0 +1,33 @@
+package challenge
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeCmd(t *testing.T) {
+	testCases := []struct {
+		cmd  string
+		want string
+	}{
+		{cmd: "ls", want: "ls"},
+		{cmd: "ls ", want: "ls"},
+		{cmd: "  ls  -la ;", want: "ls -la"},
+		{cmd: "ls;pwd", want: "ls; pwd"},
+		{cmd: "ls |wc   -l", want: "ls | wc -l"},
+		{cmd: `echo 'a  b'   "c  d"`, want: `echo 'a  b' "c  d"`},
+		{cmd: "cat <<EOF\nhi  there\nEOF", want: "cat <<EOF\nhi  there\nEOF"},
+		{cmd: "echo hi   # a  comment", want: "echo hi # a  comment"},
+		{cmd: `find . -name '*.txt' -exec rm {} \;`, want: `find . -name '*.txt' -exec rm {} \;`},
+		{cmd: ` echo "unterminated `, want: `echo "unterminated`},
+	}
+
+	for _, tt := range testCases {
+		tt := tt
+		t.Run(tt.cmd, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, tt.want, NormalizeCmd(tt.cmd))
+		})
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"os"
 	"path"
 	"strconv"
+	"time"
 )
 
 var ErrRandomizerNotExist = errors.New("randomizer does not exist")
@@ -16,6 +17,7 @@ var ErrRandomizerNotImplemented = errors.New("randomizer not implemented")
 type Randomizer struct {
 	log *slog.Logger
 	ch  *Challenge
+	rnd *rand.Rand
 }
 
 type RandomizerFuncType func(*Randomizer) ([]string, error)
@@ -33,8 +35,14 @@ var rndTable = map[string]RandomizerFuncType{
 	"oops_list_files":                      (*Randomizer).rndOopsListFiles,
 }
 
+// NewRandomizer generates the data of the challenge from its seed, or from
+// a random one if the challenge has none.
 func NewRandomizer(log *slog.Logger, ch *Challenge) *Randomizer {
-	return &Randomizer{log, ch}
+	seed := ch.Seed()
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	return &Randomizer{log, ch, rand.New(rand.NewSource(seed))} //#nosec G404
 }
 
 func (r *Randomizer) RunRandomizer() ([]string, error) {
@@ -59,12 +67,12 @@ const (
 	randMin = 10
 )
 
-func rndNum(randMax int) int {
+func (r *Randomizer) rndNum(randMax int) int {
 	if randMax <= randMin {
 		panic("invalid randmax")
 	}
 
-	return rand.Intn(randMax-randMin) + randMin //#nosec G404
+	return r.rnd.Intn(randMax-randMin) + randMin
 }
 
 func touchFile(fname string) error {
@@ -119,7 +127,7 @@ func (r *Randomizer) strFromFirstLine() string {
 }
 
 func (r *Randomizer) rndCountFiles() ([]string, error) {
-	numNewFiles := rndNum(20)
+	numNewFiles := r.rndNum(20)
 
 	for i := 0; i < numNewFiles; i++ {
 		if err := touchFile(fmt.Sprintf("rand-%d", i)); err != nil {
@@ -130,7 +138,7 @@ func (r *Randomizer) rndCountFiles() ([]string, error) {
 }
 
 func (r *Randomizer) rndCountStringInLine() ([]string, error) {
-	numLines := rndNum(20)
+	numLines := r.rndNum(20)
 
 	for i := 0; i < numLines; i++ {
 		if err := appendLine("access.log", "GET"); err != nil {
@@ -145,7 +153,7 @@ func (r *Randomizer) rndDirsContainingFilesWithExtension() ([]string, error) {
 	var newExpectedLines = make([]string, len(r.ch.ExpectedLines()))
 	copy(newExpectedLines, r.ch.ExpectedLines())
 
-	for i := 0; i < rndNum(30); i++ {
+	for i := 0; i < r.rndNum(30); i++ {
 		dname := fmt.Sprintf("a/b/c/%d", i)
 		fname := path.Join(dname, "some-file.tf")
 		if err := os.MkdirAll(dname, os.ModePerm); err != nil {
@@ -166,7 +174,7 @@ func (r *Randomizer) rndFindPrimes() ([]string, error) {
 		61, 67, 71, 73, 79, 83, 89, 97, 101, 103, 107, 109, 113, 127, 131, 137,
 		139, 149, 151, 157, 163, 167, 173, 179, 181, 191, 193, 197, 199}
 
-	rnd := rndNum(len(primes))
+	rnd := r.rndNum(len(primes))
 	for i := 0; i < rnd; i++ {
 		if err := appendLine("random-numbers.txt", strconv.Itoa(primes[i])); err != nil {
 			return nil, err
@@ -177,7 +185,7 @@ func (r *Randomizer) rndFindPrimes() ([]string, error) {
 }
 
 func (r *Randomizer) rndFindTabsInAFile() ([]string, error) {
-	rnd := rndNum(20)
+	rnd := r.rndNum(20)
 
 	for i := 0; i < rnd; i++ {
 		if err := appendLine("file-with-tabs.txt", "\t"); err != nil {
@@ -191,7 +199,7 @@ func (r *Randomizer) rndFindTabsInAFile() ([]string, error) {
 func (r *Randomizer) rndListFiles() ([]string, error) {
 	var newExpectedLines = make([]string, len(r.ch.ExpectedLines()))
 	copy(newExpectedLines, r.ch.ExpectedLines())
-	numNewFiles := rndNum(20)
+	numNewFiles := r.rndNum(20)
 
 	for i := 0; i < numNewFiles; i++ {
 		fname := fmt.Sprintf("rand-%d", i)
@@ -205,7 +213,7 @@ func (r *Randomizer) rndListFiles() ([]string, error) {
 }
 
 func (r *Randomizer) rndNestedDirs() ([]string, error) {
-	rnd := strconv.Itoa(rndNum(1000))
+	rnd := strconv.Itoa(r.rndNum(1000))
 
 	if err := writeLine(".../  /. .the flag.txt", rnd); err != nil {
 		return nil, err
@@ -216,7 +224,7 @@ func (r *Randomizer) rndNestedDirs() ([]string, error) {
 
 func (r *Randomizer) rndSumAllNumbers() ([]string, error) {
 	sum := r.intFromFirstLine()
-	rnd := rndNum(1000)
+	rnd := r.rndNum(1000)
 
 	if err := appendLine("sum-me.txt", strconv.Itoa(rnd)); err != nil {
 		return nil, err
@@ -229,7 +237,7 @@ func (r *Randomizer) rndSearchForFilescontainingString() ([]string, error) {
 	var newExpectedLines = make([]string, len(r.ch.ExpectedLines()))
 	copy(newExpectedLines, r.ch.ExpectedLines())
 
-	numNewFiles := rndNum(20)
+	numNewFiles := r.rndNum(20)
 
 	for i := 0; i < numNewFiles; i++ {
 		fname := fmt.Sprintf("rand-%d", i)
@@ -244,7 +252,7 @@ func (r *Randomizer) rndSearchForFilescontainingString() ([]string, error) {
 
 func (r *Randomizer) rndOopsListFiles() ([]string, error) {
 	newLine := r.strFromFirstLine()
-	fname := fmt.Sprintf("zzz-%d", rndNum(1000))
+	fname := fmt.Sprintf("zzz-%d", r.rndNum(1000))
 	if err := touchFile(fname); err != nil {
 		return nil, err
 	}
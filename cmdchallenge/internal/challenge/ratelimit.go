@@ -0,0 +1,135 @@
+package challenge
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/didip/tollbooth/v7"
+	"github.com/didip/tollbooth/v7/limiter"
+	"gitlab.com/jarv/cmdchallenge/internal/config"
+	"gitlab.com/jarv/cmdchallenge/internal/metrics"
+	"gitlab.com/jarv/cmdchallenge/internal/store"
+)
+
+// Buckets are full again long before this, removing them resets nothing
+const rateLimitPruneInterval = time.Hour
+
+// RateLimitBackend decides whether the client identified by key may make
+// another request under the rate limit rl.
+type RateLimitBackend interface {
+	Allow(key string, rl config.RateLimit) (bool, error)
+}
+
+// MemoryRateLimiter keeps buckets in process memory, each server replica
+// limits clients independently.
+type MemoryRateLimiter struct {
+	mu       sync.Mutex
+	limiters map[config.RateLimit]*limiter.Limiter
+}
+
+func NewMemoryRateLimiter() *MemoryRateLimiter {
+	return &MemoryRateLimiter{limiters: make(map[config.RateLimit]*limiter.Limiter)}
+}
+
+func (m *MemoryRateLimiter) Allow(key string, rl config.RateLimit) (bool, error) {
+	m.mu.Lock()
+	lmt, ok := m.limiters[rl]
+	if !ok {
+		lmt = tollbooth.NewLimiter(rl.PerSec, nil)
+		lmt.SetBurst(rl.Burst)
+		m.limiters[rl] = lmt
+	}
+	m.mu.Unlock()
+
+	return !lmt.LimitReached(key), nil
+}
+
+// StoreRateLimiter keeps buckets in the store so that every server replica
+// using the same db shares them.
+type StoreRateLimiter struct {
+	log    *slog.Logger
+	storer store.RateLimitStorer
+}
+
+func NewStoreRateLimiter(log *slog.Logger, s store.RateLimitStorer) *StoreRateLimiter {
+	return &StoreRateLimiter{log: log, storer: s}
+}
+
+func (s *StoreRateLimiter) Allow(key string, rl config.RateLimit) (bool, error) {
+	return s.storer.TakeToken(key, rl.PerSec, rl.Burst, time.Now())
+}
+
+// Run removes unused buckets until ctx is cancelled.
+func (s *StoreRateLimiter) Run(ctx context.Context) {
+	ticker := time.NewTicker(rateLimitPruneInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n, err := s.storer.PruneRateLimits(time.Now().Add(-rateLimitPruneInterval))
+			if err != nil {
+				s.log.Error("Unable to prune rate limits", "err", err)
+				continue
+			}
+			s.log.Debug("Pruned rate limits", "count", n)
+		}
+	}
+}
+
+// RateLimit limits requests by the remote address, which is the client
+// address set by ClientIP.
+type RateLimit struct {
+	log     *slog.Logger
+	metrics *metrics.Metrics
+	backend RateLimitBackend
+}
+
+func NewRateLimit(log *slog.Logger, m *metrics.Metrics, b RateLimitBackend) *RateLimit {
+	return &RateLimit{
+		log:     log,
+		metrics: m,
+		backend: b,
+	}
+}
+
+// Handler limits requests to next, handlers with the same name share the
+// limit. Requests are allowed when the backend fails so that an unavailable
+// store doesn't take the site down with it.
+func (l *RateLimit) Handler(name string, rl config.RateLimit, msg string, next http.Handler) http.Handler {
+	l.log.Info("Setting rate limit", "endpoint", name, "reqPerSec", rl.PerSec, "burst", rl.Burst)
+	body := []byte(jsonErrorMessage(rateLimitedCode, msg))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		ok, err := l.backend.Allow(name+":"+remoteIP(req), rl)
+		if err != nil {
+			l.log.Error("Unable to check rate limit", "endpoint", name, "err", err)
+			ok = true
+		}
+
+		if !ok {
+			l.log.Info("Rate limit reached", "RemoteAddr", req.RemoteAddr, "RequestURI", req.RequestURI)
+			l.metrics.ResponseStatus.WithLabelValues(strconv.Itoa(http.StatusTooManyRequests), req.RequestURI).Inc()
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			w.WriteHeader(http.StatusTooManyRequests)
+			_, _ = w.Write(body)
+			return
+		}
+
+		next.ServeHTTP(w, req)
+	})
+}
+
+func remoteIP(req *http.Request) string {
+	if host, _, err := net.SplitHostPort(req.RemoteAddr); err == nil {
+		return host
+	}
+	return req.RemoteAddr
+}
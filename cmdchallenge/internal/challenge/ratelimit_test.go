@@ -0,0 +1,80 @@
+package challenge
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gitlab.com/jarv/cmdchallenge/internal/config"
+	"gitlab.com/jarv/cmdchallenge/internal/metrics"
+	"gitlab.com/jarv/cmdchallenge/internal/store"
+)
+
+var testRateLimit = config.RateLimit{PerSec: 0.001, Burst: 1}
+
+type failingRateLimitStorer struct{}
+
+func (failingRateLimitStorer) TakeToken(string, float64, int, time.Time) (bool, error) {
+	return false, errors.New("db gone")
+}
+
+func (failingRateLimitStorer) PruneRateLimits(time.Time) (int64, error) {
+	return 0, errors.New("db gone")
+}
+
+func okHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {})
+}
+
+func requestFrom(h http.Handler, remoteAddr string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(http.MethodGet, "/c/r", http.NoBody)
+	req.RemoteAddr = remoteAddr
+	resp := httptest.NewRecorder()
+	h.ServeHTTP(resp, req)
+	return resp
+}
+
+func TestRateLimitMemory(t *testing.T) {
+	l := NewRateLimit(testLogger(t), metrics.New(testLogger(t)), NewMemoryRateLimiter())
+	run := l.Handler("run", testRateLimit, "slow down", okHandler())
+	stream := l.Handler("run", testRateLimit, "slow down", okHandler())
+	stats := l.Handler("stats", testRateLimit, "slow down", okHandler())
+
+	assert.Equal(t, 200, requestFrom(run, "1.1.1.1").Code)
+
+	// Handlers with the same name share the limit
+	resp := requestFrom(stream, "1.1.1.1")
+	assert.Equal(t, 429, resp.Code)
+	assert.Equal(t, `{"error":{"code":"rate_limited","message":"slow down"}}`, resp.Body.String())
+
+	assert.Equal(t, 200, requestFrom(stats, "1.1.1.1").Code)
+	assert.Equal(t, 200, requestFrom(run, "2.2.2.2:80").Code)
+}
+
+func TestRateLimitStoreShared(t *testing.T) {
+	log := testLogger(t)
+	m := metrics.New(log)
+	db, err := store.NewSQLStore(log, m, filepath.Join(t.TempDir(), "db.sqlite3"))
+	require.NoError(t, err)
+
+	// Two servers using the same db
+	first := NewRateLimit(log, m, NewStoreRateLimiter(log, db)).Handler("run", testRateLimit, "slow down", okHandler())
+	second := NewRateLimit(log, m, NewStoreRateLimiter(log, db)).Handler("run", testRateLimit, "slow down", okHandler())
+
+	assert.Equal(t, 200, requestFrom(first, "1.1.1.1").Code)
+	assert.Equal(t, 429, requestFrom(second, "1.1.1.1").Code)
+	assert.Equal(t, 200, requestFrom(second, "2.2.2.2").Code)
+}
+
+func TestRateLimitStoreFailsOpen(t *testing.T) {
+	l := NewRateLimit(testLogger(t), metrics.New(testLogger(t)), NewStoreRateLimiter(testLogger(t), failingRateLimitStorer{}))
+	h := l.Handler("run", testRateLimit, "slow down", okHandler())
+
+	assert.Equal(t, 200, requestFrom(h, "1.1.1.1").Code)
+	assert.Equal(t, 200, requestFrom(h, "1.1.1.1").Code)
+}
@@ -0,0 +1,87 @@
+package challenge
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"mime"
+	"net/http"
+)
+
+const (
+	EncodingPlain  = "plain"
+	EncodingBase64 = "base64"
+
+	// Large enough for a base64 encoded command of MaxCMDLength plus the
+	// other fields of a JSON request.
+	maxRequestBodyBytes = 4096
+)
+
+// CmdRequest is the JSON body accepted by the command endpoint. Unlike form
+// posts the encoding of the command is explicit, it defaults to plain.
+type CmdRequest struct {
+	Slug     string `json:"slug"`
+	Cmd      string `json:"cmd"`
+	Encoding string `json:"encoding,omitempty"`
+}
+
+// parseCmdRequest returns the slug and decoded command of a request. JSON
+// bodies are selected with the Content-Type header, anything else that is
+// a form post keeps the legacy behaviour of guessing whether the command
+// is base64 encoded.
+func parseCmdRequest(w http.ResponseWriter, req *http.Request) (string, string, error) {
+	mediaType := ""
+	if ct := req.Header.Get("Content-Type"); ct != "" {
+		var err error
+		if mediaType, _, err = mime.ParseMediaType(ct); err != nil {
+			return "", "", ErrServerContentType
+		}
+	}
+
+	switch mediaType {
+	case "application/json":
+		return parseJSONCmdRequest(w, req)
+	case "", "application/x-www-form-urlencoded", "multipart/form-data":
+		slug := req.PostFormValue("slug")
+		cmd := req.PostFormValue("cmd")
+		if err := isValidRequest(slug, cmd); err != nil {
+			return slug, cmd, err
+		}
+		return slug, decodeCmd(cmd), nil
+	default:
+		return "", "", ErrServerContentType
+	}
+}
+
+func parseJSONCmdRequest(w http.ResponseWriter, req *http.Request) (string, string, error) {
+	var cmdReq CmdRequest
+
+	dec := json.NewDecoder(http.MaxBytesReader(w, req.Body, maxRequestBodyBytes))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&cmdReq); err != nil {
+		return "", "", ErrServerInvalidBody
+	}
+
+	cmd, err := cmdReq.decodedCmd()
+	return cmdReq.Slug, cmd, err
+}
+
+// decodedCmd validates the request and returns the command decoded with the
+// requested encoding.
+func (r *CmdRequest) decodedCmd() (string, error) {
+	if err := isValidRequest(r.Slug, r.Cmd); err != nil {
+		return r.Cmd, err
+	}
+
+	switch r.Encoding {
+	case "", EncodingPlain:
+		return r.Cmd, nil
+	case EncodingBase64:
+		decoded, err := base64.StdEncoding.DecodeString(r.Cmd)
+		if err != nil {
+			return r.Cmd, ErrServerInvalidEncoding
+		}
+		return string(decoded), nil
+	default:
+		return r.Cmd, ErrServerInvalidEncoding
+	}
+}
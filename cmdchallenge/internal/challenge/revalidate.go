@@ -0,0 +1,136 @@
+package challenge
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+
+	"gitlab.com/jarv/cmdchallenge/internal/config"
+	"gitlab.com/jarv/cmdchallenge/internal/metrics"
+	"gitlab.com/jarv/cmdchallenge/internal/store"
+)
+
+// RevalidationReport describes the outcome of replaying the correct commands
+// of a previous challenge version against the current one.
+type RevalidationReport struct {
+	Slug        string
+	FromVersion int
+	ToVersion   int
+	Replayed    int
+	Skipped     int
+	Failed      []string
+}
+
+// Revalidator seeds the result cache after a challenge version is bumped by
+// running the most popular correct commands of the previous version against
+// the new definition, so that solutions don't disappear until users resubmit.
+type Revalidator struct {
+	log            *slog.Logger
+	cfg            *config.Config
+	metrics        *metrics.Metrics
+	runnerExecutor RunnerExecutor
+	cmdStorer      store.CmdStorer
+}
+
+func NewRevalidator(
+	log *slog.Logger,
+	cfg *config.Config,
+	m *metrics.Metrics,
+	r RunnerExecutor,
+	s store.CmdStorer,
+) *Revalidator {
+	return &Revalidator{
+		log:            log,
+		cfg:            cfg,
+		metrics:        m,
+		runnerExecutor: r,
+		cmdStorer:      s,
+	}
+}
+
+// Run revalidates every challenge that has results for an older version,
+// commands that already have a result for the current version are skipped so
+// it is safe to run on every start.
+func (r *Revalidator) Run(ctx context.Context, chs []*Challenge) ([]RevalidationReport, error) {
+	reports := make([]RevalidationReport, 0)
+
+	for _, ch := range chs {
+		prev, err := r.cmdStorer.PreviousVersion(ch.Slug(), ch.Version())
+		if errors.Is(err, store.ErrResultNotFound) {
+			continue
+		}
+		if err != nil {
+			return reports, err
+		}
+
+		report, err := r.revalidate(ctx, ch, prev)
+		if err != nil {
+			return reports, err
+		}
+
+		if report.Replayed > 0 {
+			r.log.Info("Revalidated challenge",
+				"slug", report.Slug,
+				"fromVersion", report.FromVersion,
+				"toVersion", report.ToVersion,
+				"replayed", report.Replayed,
+				"skipped", report.Skipped,
+				"failed", report.Failed,
+			)
+		}
+		reports = append(reports, report)
+	}
+
+	return reports, nil
+}
+
+func (r *Revalidator) revalidate(ctx context.Context, ch *Challenge, prev int) (RevalidationReport, error) {
+	report := RevalidationReport{
+		Slug:        ch.Slug(),
+		FromVersion: prev,
+		ToVersion:   ch.Version(),
+		Failed:      make([]string, 0),
+	}
+
+	cmds, err := r.cmdStorer.CorrectCmdsForVersion(ch.Slug(), prev, r.cfg.RevalidateLimit)
+	if err != nil {
+		return report, err
+	}
+
+	for _, cmd := range cmds {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+
+		_, err := r.cmdStorer.GetResult(NormalizeCmd(cmd), ch.Slug(), ch.Version())
+		if err == nil {
+			report.Skipped++
+			continue
+		}
+		if !errors.Is(err, store.ErrResultNotFound) {
+			return report, err
+		}
+
+		cmdStore, _, err := runResult(r.log, r.runnerExecutor, cmd, ch, nil)
+		if err != nil {
+			// Runner errors and timeouts aren't cached, leave it for
+			// the next user that submits the command
+			r.log.Error("Unable to revalidate command", "slug", ch.Slug(), "cmd", cmd, "err", err)
+			continue
+		}
+
+		if err = r.cmdStorer.CreateResult(cmdStore); err != nil {
+			return report, err
+		}
+
+		report.Replayed++
+		result := "pass"
+		if !*cmdStore.Correct {
+			report.Failed = append(report.Failed, cmd)
+			result = "fail"
+		}
+		r.metrics.CmdRevalidated.WithLabelValues(ch.Slug(), result).Inc()
+	}
+
+	return report, nil
+}
@@ -0,0 +1,65 @@
+package challenge
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"gitlab.com/jarv/cmdchallenge/internal/metrics"
+	"gitlab.com/jarv/cmdchallenge/internal/store"
+)
+
+func TestRevalidate(t *testing.T) {
+	ch := helloWorldCh(t)
+	stubStore := &StubStor{}
+	stubRunnerExecutor := &StubRunnerExecutor{}
+
+	stubStore.On("PreviousVersion", "hello_world", 5).Return(4, nil).Once()
+	stubStore.On("CorrectCmdsForVersion", "hello_world", 4, cfg.RevalidateLimit).
+		Return([]string{"echo hello world", "echo hello", "echo 'hello world'"}, nil).Once()
+
+	stubStore.On("GetResult", "echo hello world", "hello_world", 5).Return(nil, store.ErrResultNotFound).Once()
+	stubStore.On("GetResult", "echo hello", "hello_world", 5).Return(nil, store.ErrResultNotFound).Once()
+	stubStore.On("GetResult", "echo 'hello world'", "hello_world", 5).Return(&fakeStore, nil).Once()
+	stubStore.On("CreateResult", mock.Anything).Return(nil).Twice()
+
+	stubRunnerExecutor.On("RunContainer", "echo hello world", ch).Return(&fakeResponse, nil).Once()
+	stubRunnerExecutor.On("RunContainer", "echo hello", ch).Return(&CmdResponse{
+		Correct:  toPtr(false),
+		ExitCode: toPtr(0),
+		Output:   toPtr("hello"),
+		Error:    toPtr("Output does not match expected lines"),
+	}, nil).Once()
+
+	r := NewRevalidator(testLogger(t), cfg, metrics.New(testLogger(t)), stubRunnerExecutor, stubStore)
+	reports, err := r.Run(context.Background(), []*Challenge{ch})
+	require.NoError(t, err)
+
+	stubStore.AssertExpectations(t)
+	stubRunnerExecutor.AssertExpectations(t)
+
+	assert.Equal(t, []RevalidationReport{{
+		Slug:        "hello_world",
+		FromVersion: 4,
+		ToVersion:   5,
+		Replayed:    2,
+		Skipped:     1,
+		Failed:      []string{"echo hello"},
+	}}, reports)
+}
+
+func TestRevalidateNoPreviousVersion(t *testing.T) {
+	stubStore := &StubStor{}
+	stubRunnerExecutor := &StubRunnerExecutor{}
+
+	stubStore.On("PreviousVersion", "hello_world", 5).Return(0, store.ErrResultNotFound).Once()
+
+	r := NewRevalidator(testLogger(t), cfg, metrics.New(testLogger(t)), stubRunnerExecutor, stubStore)
+	reports, err := r.Run(context.Background(), []*Challenge{helloWorldCh(t)})
+	require.NoError(t, err)
+
+	stubStore.AssertExpectations(t)
+	assert.Empty(t, reports)
+}
@@ -4,9 +4,14 @@ import (
 	"context"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"log/slog"
 	"path"
+	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/image"
@@ -18,17 +23,29 @@ import (
 
 const (
 	BaseWorkingDir string = "/var/challenges"
+
+	// runcmd cuts the output in its response to MaxOutputLength, the
+	// response can be larger than the output when every byte is escaped
+	maxResponseLength = 6*MaxOutputLength + 4096
 )
 
 type RunnerExecutor interface {
 	PullImages() error
 	RunContainer(cmd string, ch *Challenge) (*CmdResponse, error)
+	RunContainerStream(cmd string, ch *Challenge, out io.Writer) (*CmdResponse, error)
 }
 
 type Runner struct {
 	log *slog.Logger
 	cfg *config.Config
 	cli *client.Client
+
+	// Containers of runs in progress, removed on shutdown if they don't
+	// finish in time
+	mu         sync.Mutex
+	containers map[string]struct{}
+	closed     bool
+	wg         sync.WaitGroup
 }
 
 func NewRunner(log *slog.Logger, cfg *config.Config) *Runner {
@@ -37,10 +54,68 @@ func NewRunner(log *slog.Logger, cfg *config.Config) *Runner {
 		panic(err)
 	}
 
-	r := Runner{log, cfg, cli}
+	r := Runner{log: log, cfg: cfg, cli: cli, containers: make(map[string]struct{})}
 	return &r
 }
 
+// Shutdown stops new runs and waits for the ones in progress until ctx is
+// done, containers of runs that are still in progress are then removed.
+func (r *Runner) Shutdown(ctx context.Context) error {
+	r.mu.Lock()
+	r.closed = true
+	r.mu.Unlock()
+
+	finished := make(chan struct{})
+	go func() {
+		r.wg.Wait()
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+		return nil
+	case <-ctx.Done():
+	}
+
+	r.mu.Lock()
+	ids := make([]string, 0, len(r.containers))
+	for id := range r.containers {
+		ids = append(ids, id)
+	}
+	r.mu.Unlock()
+
+	var errs []error
+	for _, id := range ids {
+		r.log.Info("Removing container of unfinished run", "id", id)
+		errs = append(errs, r.removeImage(id))
+	}
+
+	return errors.Join(errs...)
+}
+
+func (r *Runner) start() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed {
+		return ErrRunnerClosed
+	}
+	r.wg.Add(1)
+	return nil
+}
+
+func (r *Runner) track(id string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.containers[id] = struct{}{}
+}
+
+func (r *Runner) untrack(id string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.containers, id)
+}
+
 func (r *Runner) PullImages() error {
 	ctx, cancel := context.WithTimeout(context.Background(), r.cfg.PullImageTimeout)
 	defer cancel()
@@ -55,7 +130,13 @@ func (r *Runner) PullImages() error {
 		}
 
 		r.log.Info("Starting image pull", "imgURI", imgURI)
-		_, err = r.cli.ImagePull(ctx, imgURI, opts)
+		progress, err := r.cli.ImagePull(ctx, imgURI, opts)
+		if err != nil {
+			return err
+		}
+		// The pull only completes once the progress is read to the end
+		_, err = io.Copy(io.Discard, progress)
+		progress.Close()
 		if err != nil {
 			return err
 		}
@@ -65,7 +146,35 @@ func (r *Runner) PullImages() error {
 	return nil
 }
 
-func (r *Runner) containerLogs(ctx context.Context, id string, showStdout, showStderr bool) string {
+// Ping checks that the Docker daemon is reachable.
+func (r *Runner) Ping(ctx context.Context) error {
+	_, err := r.cli.Ping(ctx)
+	return err
+}
+
+// CheckImages checks that the images commands run in are present locally.
+func (r *Runner) CheckImages(ctx context.Context) error {
+	for _, imgName := range r.cfg.CMDImgNames {
+		imgURI, err := r.cfg.RegistryImgURI(imgName)
+		if err != nil {
+			return err
+		}
+
+		if _, _, err := r.cli.ImageInspectWithRaw(ctx, imgURI); err != nil {
+			if client.IsErrNotFound(err) {
+				return fmt.Errorf("%w: %s", ErrRunnerImageMissing, imgURI)
+			}
+			return err
+		}
+	}
+
+	return nil
+}
+
+// containerLogs returns the logs of the container, reading at most limit
+// bytes of the log stream so a command can't make the server buffer all of
+// its output.
+func (r *Runner) containerLogs(ctx context.Context, id string, showStdout, showStderr bool, limit int64) string {
 	ioCloser, err := r.cli.ContainerLogs(
 		ctx,
 		id,
@@ -77,12 +186,52 @@ func (r *Runner) containerLogs(ctx context.Context, id string, showStdout, showS
 	defer ioCloser.Close()
 
 	buf := new(strings.Builder)
-	_, _ = stdcopy.StdCopy(buf, buf, ioCloser)
+	_, _ = stdcopy.StdCopy(buf, buf, io.LimitReader(ioCloser, limit))
 
 	return buf.String()
 }
 
 func (r *Runner) RunContainer(cmd string, ch *Challenge) (*CmdResponse, error) {
+	return r.runContainer(cmd, ch, nil)
+}
+
+// RunContainerStream is like RunContainer but copies the output of the
+// command to out while it runs.
+func (r *Runner) RunContainerStream(cmd string, ch *Challenge, out io.Writer) (*CmdResponse, error) {
+	return r.runContainer(cmd, ch, out)
+}
+
+// followStderr copies stderr of the container to out until the container
+// exits, runcmd writes the command output there when it is run with -stream.
+func (r *Runner) followStderr(ctx context.Context, id string, out io.Writer) <-chan struct{} {
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		ioCloser, err := r.cli.ContainerLogs(
+			ctx,
+			id,
+			container.LogsOptions{ShowStderr: true, Follow: true},
+		)
+		if err != nil {
+			r.log.Error("Unable to follow container logs", "id", id, "err", err)
+			return
+		}
+		defer ioCloser.Close()
+
+		_, _ = stdcopy.StdCopy(io.Discard, out, ioCloser)
+	}()
+
+	return done
+}
+
+func (r *Runner) runContainer(cmd string, ch *Challenge, out io.Writer) (*CmdResponse, error) {
+	if err := r.start(); err != nil {
+		return nil, err
+	}
+	defer r.wg.Done()
+
 	ctx, cancel := context.WithTimeout(context.Background(), r.cfg.RunCmdTimeout)
 	defer cancel()
 
@@ -98,8 +247,14 @@ func (r *Runner) RunContainer(cmd string, ch *Challenge) (*CmdResponse, error) {
 		"-cmd",
 		"-slug",
 		ch.Slug(),
-		base64.StdEncoding.EncodeToString([]byte(cmd)),
 	}
+	if out != nil {
+		runCmd = append(runCmd, "-stream")
+	}
+	if ch.Seed() != 0 {
+		runCmd = append(runCmd, "-seed", strconv.FormatInt(ch.Seed(), 10))
+	}
+	runCmd = append(runCmd, base64.StdEncoding.EncodeToString([]byte(cmd)))
 
 	registryImgURI, err := r.cfg.RegistryImgURI(ch.Img())
 	if err != nil {
@@ -117,10 +272,24 @@ func (r *Runner) RunContainer(cmd string, ch *Challenge) (*CmdResponse, error) {
 		return nil, err
 	}
 
+	r.track(resp.ID)
+	defer r.untrack(resp.ID)
+
 	if err := r.cli.ContainerStart(ctx, resp.ID, container.StartOptions{}); err != nil {
 		return nil, err
 	}
 
+	var streamDone <-chan struct{}
+	if out != nil {
+		streamDone = r.followStderr(ctx, resp.ID, out)
+		// out belongs to the caller again once this returns, stop the
+		// stream and wait for it on every return
+		defer func() {
+			cancel()
+			<-streamDone
+		}()
+	}
+
 	statusCh, errCh := r.cli.ContainerWait(ctx, resp.ID, container.WaitConditionNotRunning)
 	select {
 	case err := <-errCh:
@@ -128,10 +297,16 @@ func (r *Runner) RunContainer(cmd string, ch *Challenge) (*CmdResponse, error) {
 			return nil, err
 		}
 	case status := <-statusCh:
-		stdout := r.containerLogs(ctx, resp.ID, true, false)
-		stderr := r.containerLogs(ctx, resp.ID, false, true)
+		stdout := r.containerLogs(ctx, resp.ID, true, false, maxResponseLength)
 
-		if stderr != "" {
+		if out != nil {
+			// stderr is the streamed output of the command, wait for the
+			// rest of it before the result is returned
+			select {
+			case <-streamDone:
+			case <-ctx.Done():
+			}
+		} else if stderr := r.containerLogs(ctx, resp.ID, false, true, MaxOutputLength+1); stderr != "" {
 			r.log.Error("Container logs:\n" + "--------------\n" + stderr + "--------------")
 		}
 
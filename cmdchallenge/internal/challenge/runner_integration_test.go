@@ -3,7 +3,6 @@ package challenge
 import (
 	"testing"
 
-	"github.com/go-logr/logr/testr"
 	"github.com/stretchr/testify/require"
 	"gitlab.com/jarv/cmdchallenge/internal/config"
 	"gopkg.in/yaml.v3"
@@ -39,7 +38,7 @@ func TestChallengesExpectPass(t *testing.T) {
 
 		t.Run(slug, func(t *testing.T) {
 			t.Parallel()
-			runner := NewRunner(testr.New(t), cfg)
+			runner := NewRunner(testLogger(t), cfg)
 			result, err := runner.RunContainer(ch.Example(), ch)
 			ass.NoError(err)
 			ass.NotNil(result.Correct)
@@ -66,7 +65,7 @@ func TestChallengesExpectFailure(t *testing.T) {
 
 		t.Run(slug, func(t *testing.T) {
 			t.Parallel()
-			runner := NewRunner(testr.New(t), cfg)
+			runner := NewRunner(testLogger(t), cfg)
 			for _, failure := range ch.ExpectedFailures() {
 				result, err := runner.RunContainer(failure, ch)
 				req.NoError(err)
@@ -0,0 +1,99 @@
+package challenge
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/client"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gitlab.com/jarv/cmdchallenge/internal/config"
+)
+
+func TestRunnerShutdown(t *testing.T) {
+	r := NewRunner(testLogger(t), cfg)
+
+	// Nothing is running so this doesn't need a Docker daemon
+	require.NoError(t, r.Shutdown(context.Background()))
+
+	_, err := r.RunContainer("echo hello world", helloWorldCh(t))
+	assert.ErrorIs(t, err, ErrRunnerClosed)
+}
+
+// streamingDaemon is a Docker API that runs containers forever while their
+// stderr streams output.
+func streamingDaemon(t *testing.T) *client.Client {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1.41/containers/create", func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"Id":"abc","Warnings":[]}`))
+	})
+	mux.HandleFunc("POST /v1.41/containers/abc/start", func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("POST /v1.41/containers/abc/wait", func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		<-req.Context().Done()
+	})
+	mux.HandleFunc("GET /v1.41/containers/abc/logs", func(w http.ResponseWriter, req *http.Request) {
+		frame := []byte{2, 0, 0, 0, 0, 0, 0, 2, 'y', '\n'}
+		for {
+			select {
+			case <-req.Context().Done():
+				return
+			case <-time.After(time.Millisecond):
+			}
+			if _, err := w.Write(frame); err != nil {
+				return
+			}
+			w.(http.Flusher).Flush()
+		}
+	})
+	mux.HandleFunc("DELETE /v1.41/containers/abc", func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	cli, err := client.NewClientWithOpts(client.WithHost("tcp://"+srv.Listener.Addr().String()), client.WithVersion("1.41"))
+	require.NoError(t, err)
+	return cli
+}
+
+// closableWriter fails the test when it is written to after it is closed.
+type closableWriter struct {
+	t      *testing.T
+	closed atomic.Bool
+	n      int
+}
+
+func (w *closableWriter) Write(p []byte) (int, error) {
+	if w.closed.Load() {
+		w.t.Error("write after the run returned")
+	}
+	w.n += len(p)
+	return len(p), nil
+}
+
+func TestRunnerStreamTimeout(t *testing.T) {
+	timeoutCfg := config.New(config.ConfigOpts{})
+	timeoutCfg.RunCmdTimeout = 100 * time.Millisecond
+	r := &Runner{log: testLogger(t), cfg: timeoutCfg, cli: streamingDaemon(t), containers: make(map[string]struct{})}
+
+	out := &closableWriter{t: t}
+	_, err := r.RunContainerStream("yes", helloWorldCh(t), out)
+	require.Error(t, err)
+	out.closed.Store(true)
+
+	// The stream must not outlive the run
+	time.Sleep(50 * time.Millisecond)
+	assert.Positive(t, out.n)
+}
@@ -4,23 +4,25 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"errors"
-	"fmt"
+	"io"
 	"log/slog"
 	"net/http"
 	"regexp"
-	"strconv"
+	"strings"
+	"time"
 
 	// "github.com/gdexlab/go-render/render"
-	"github.com/didip/tollbooth/v7"
 	"gitlab.com/jarv/cmdchallenge/internal/config"
 	"gitlab.com/jarv/cmdchallenge/internal/metrics"
 	"gitlab.com/jarv/cmdchallenge/internal/store"
 )
 
 const (
-	MaxCMDLength         = 300
-	maxServerRequestsSec = 0.5
-	burst                = 2
+	MaxCMDLength = 300
+	// Longer outputs are cut before they are stored and returned
+	MaxOutputLength = 64 * 1024
+
+	outputTruncatedSuffix = "\n[output truncated]"
 )
 
 type Server struct {
@@ -29,6 +31,19 @@ type Server struct {
 	metrics        *metrics.Metrics
 	runnerExecutor RunnerExecutor
 	cmdStorer      store.CmdStorer
+	submissions    *submissionLog
+	abuse          *AbuseTracker
+	sessions       *Sessions
+	events         *Events
+	classes        *Classes
+	daily          *Daily
+}
+
+// player is who sent a command, commands are recorded as progress of the
+// session and as a solve in the event when they are set.
+type player struct {
+	sessionID string
+	event     *Event
 }
 
 type CmdResponse struct {
@@ -38,6 +53,26 @@ type CmdResponse struct {
 	ErrorInternal *string `json:",omitempty"` // Internal errors that will never be cached
 	ExitCode      *int    `json:",omitempty"`
 	Output        *string `json:",omitempty"`
+	Truncated     *bool   `json:",omitempty"` // Output was cut at MaxOutputLength, only set for commands that were run
+}
+
+// TruncateOutput cuts output longer than MaxOutputLength, marking that it
+// was cut.
+func (c *CmdResponse) TruncateOutput() {
+	if c.Output == nil || len(*c.Output) <= MaxOutputLength {
+		return
+	}
+	c.Output = toPtr(truncateOutput(*c.Output))
+	c.Truncated = toPtr(true)
+}
+
+// ServerOptions are the optional features of the server, features that are
+// nil are disabled.
+type ServerOptions struct {
+	Sessions *Sessions
+	Events   *Events
+	Classes  *Classes
+	Daily    *Daily
 }
 
 func NewServer(
@@ -46,6 +81,7 @@ func NewServer(
 	m *metrics.Metrics,
 	r RunnerExecutor,
 	s store.CmdStorer,
+	opts ServerOptions,
 ) *Server {
 	return &Server{
 		log:            log,
@@ -53,34 +89,48 @@ func NewServer(
 		metrics:        m,
 		runnerExecutor: r,
 		cmdStorer:      s,
+		submissions:    newSubmissionLog(log, cfg, m, s),
+		abuse:          NewAbuseTracker(log, cfg, m),
+		sessions:       opts.Sessions,
+		events:         opts.Events,
+		classes:        opts.Classes,
+		daily:          opts.Daily,
 	}
 }
 
-func (c *Server) httpError(w http.ResponseWriter, e error, statusCode int) {
+// Abuse returns the tracker that bans clients sending pathological commands.
+func (c *Server) Abuse() *AbuseTracker {
+	return c.abuse
+}
+
+// Close writes the submissions that are still queued, it must be called
+// after the HTTP server has stopped.
+func (c *Server) Close() {
+	c.submissions.close()
+}
+
+func (c *Server) countError(e error) {
 	var chError *ChallengeError
 	if errors.As(e, &chError) {
 		c.metrics.CmdErrors.WithLabelValues(chError.Error(), chError.typ).Inc()
 	} else {
-		c.metrics.CmdErrors.WithLabelValues(e.Error(), TypeServer).Inc()
+		c.metrics.CmdErrors.WithLabelValues(errorLabel(e), TypeServer).Inc()
 	}
-	http.Error(w, e.Error(), statusCode)
+}
+
+func (c *Server) httpError(w http.ResponseWriter, e error) {
+	c.countError(e)
+	writeError(w, e)
 }
 
 func (c *Server) Handler() http.Handler {
-	if c.cfg.RateLimit {
-		lmt := tollbooth.NewLimiter(float64(maxServerRequestsSec), nil)
-		c.log.Info(fmt.Sprintf("Setting rate limit req/sec: %f burst: %d", maxServerRequestsSec, burst))
-		lmt.SetIPLookups([]string{"RemoteAddr"})
-		lmt.SetBurst(burst)
-		lmt.SetMessage("Your are sending command too fast, slow down!")
-		lmt.SetOnLimitReached(func(w http.ResponseWriter, r *http.Request) {
-			c.log.Info("Rate limit reached", "RemoteAddr", r.RemoteAddr, "RequestURI", r.RequestURI)
-			c.metrics.ResponseStatus.WithLabelValues(strconv.Itoa(lmt.GetStatusCode()), r.RequestURI).Inc()
-		})
-		return tollbooth.LimitHandler(lmt, http.HandlerFunc(c.runHandler))
-	} else {
-		return http.HandlerFunc(c.runHandler)
-	}
+	return http.HandlerFunc(c.runHandler)
+}
+
+// StreamHandler runs commands like Handler but sends the output as
+// Server-Sent Events while the command runs.
+func (c *Server) StreamHandler() http.Handler {
+	return http.HandlerFunc(c.streamHandler)
 }
 
 func (c *Server) runHandler(w http.ResponseWriter, req *http.Request) {
@@ -95,78 +145,204 @@ func (c *Server) runHandler(w http.ResponseWriter, req *http.Request) {
 
 	if req.Method != http.MethodPost {
 		c.log.Error("expect POST", "method", req.Method)
-		c.httpError(w, ErrServerInvalidMethod, http.StatusMethodNotAllowed)
+		c.httpError(w, ErrServerInvalidMethod)
+		return
+	}
+
+	if err := c.abuse.Check(remoteIP(req)); err != nil {
+		c.log.Info("Rejecting command from banned client", "Addr", req.RemoteAddr)
+		c.httpError(w, err)
+		return
+	}
+
+	slug, cmd, err := parseCmdRequest(w, req)
+	if err != nil {
+		c.log.Error("Invalid request", "slug", slug, "cmd", cmd, "err", err)
+		c.httpError(w, err)
+		return
+	}
+
+	p, err := c.player(req, slug)
+	if err != nil {
+		c.httpError(w, err)
 		return
 	}
 
-	slug := req.PostFormValue("slug")
-	cmd := req.PostFormValue("cmd")
+	resp, err := c.submit(slug, cmd, req.RemoteAddr, p)
+	c.abuse.Record(remoteIP(req), resp, err)
+	if err != nil {
+		c.httpError(w, err)
+		return
+	}
 
-	if err := isValidRequest(slug, cmd); err != nil {
-		c.log.Error("Invalid request", "slug", slug, "cmd", cmd)
-		c.httpError(w, err, http.StatusInternalServerError)
+	b, err := json.Marshal(resp)
+	if err != nil {
+		c.httpError(w, ErrServerDecode)
 		return
 	}
 
-	cmd = decodeCmd(cmd)
+	_, _ = w.Write(b)
+}
+
+// submit checks a decoded command against a challenge, returning the cached
+// result or running it. Correct commands are recorded for the player.
+func (c *Server) submit(slug, cmd, remoteAddr string, p player) (*CmdResponse, error) {
+	ch, err := c.challengeForCmd(slug, cmd, remoteAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.runCmd(cmd, ch, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	c.recordProgress(p, ch, cmd, resp)
+	return resp, nil
+}
+
+// player returns who sent a command for slug. The session is empty when
+// sessions aren't enabled or the request has no session token, commands
+// sent to an event need a session. Sessions can only send commands for
+// challenges they unlocked, anonymous commands have no progress to check.
+func (c *Server) player(req *http.Request, slug string) (player, error) {
+	var p player
+	if c.sessions == nil {
+		return p, nil
+	}
 
+	var err error
+	if p.sessionID, err = c.sessions.fromRequest(req); err != nil {
+		return p, err
+	}
+
+	if ch, chErr := NewChallenge(ChallengeOptions{Slug: slug}); chErr == nil && p.sessionID != "" {
+		if err := c.sessions.checkUnlocked(p.sessionID, ch); err != nil {
+			return p, err
+		}
+	}
+
+	if c.events == nil {
+		return p, nil
+	}
+	if p.event, err = c.events.fromRequest(req, slug); err != nil {
+		return p, err
+	}
+	if p.event != nil && p.sessionID == "" {
+		return p, ErrSessionRequired
+	}
+	return p, nil
+}
+
+// recordProgress records a command for the player, every command counts as
+// an attempt in classes but only correct unseeded ones are progress.
+func (c *Server) recordProgress(p player, ch *Challenge, cmd string, resp *CmdResponse) {
+	if p.sessionID == "" {
+		return
+	}
+
+	correct := resp.Correct != nil && *resp.Correct
+	if c.classes != nil {
+		c.classes.record(p.sessionID, ch.Slug(), cmd, correct)
+	}
+	// Seeded results aren't stored, a solve without a result couldn't be
+	// moderated or imported so it isn't progress
+	if !correct || ch.Seed() != 0 {
+		return
+	}
+	c.sessions.record(p.sessionID, ch.Slug(), ch.Version(), cmd)
+	if p.event != nil {
+		c.events.record(p.event, p.sessionID, ch.Slug(), cmd)
+	}
+}
+
+func (c *Server) challengeForCmd(slug, cmd, remoteAddr string) (*Challenge, error) {
 	if len(cmd) > MaxCMDLength {
 		c.log.Error("Command is too long", "len", len(cmd))
-		c.httpError(w, ErrServerCmdTooLong, http.StatusForbidden)
-		return
+		return nil, ErrServerCmdTooLong
 	}
 
 	ch, err := NewChallenge(ChallengeOptions{Slug: slug})
 	if err != nil {
 		c.log.Error("Unable to parse challenge", "slug", slug)
-		c.httpError(w, ErrServerInvalidChallenge, http.StatusInternalServerError)
-		return
+		return nil, ErrServerInvalidChallenge
 	}
 
 	if slug != ch.Slug() {
 		c.log.Error("Challenge slug doesn't match config", "slug", slug, "config", ch.Slug())
-		c.httpError(w, ErrServerUnknown, http.StatusInternalServerError)
-		return
+		return nil, ErrServerUnknown
 	}
 
 	c.log.Info("Got command",
 		"cmd", cmd,
-		"remoteAddr", req.RemoteAddr,
+		"remoteAddr", remoteAddr,
 		"chDir", ch.Dir(),
 		"slug", ch.Slug(),
 	)
 
-	jsonResp, err := c.runCmd(cmd, ch)
+	if c.daily != nil {
+		ch = c.daily.variant(ch)
+	}
+	return ch, nil
+}
+
+func (c *Server) runAndStoreCmd(cmd string, ch *Challenge, out io.Writer) (*store.CmdStore, bool, error) {
+	cmdStore, truncated, err := runResult(c.log, c.runnerExecutor, cmd, ch, out)
 	if err != nil {
-		c.httpError(w, err, http.StatusInternalServerError)
-		return
+		return nil, false, err
 	}
 
-	fmt.Fprint(w, jsonResp)
+	// Seeded runs are checked against data that anyone can generate from
+	// the published seed, their results would share the row of the
+	// randomized challenge so they are never stored
+	if ch.Seed() != 0 {
+		return cmdStore, truncated, nil
+	}
+
+	if err = c.cmdStorer.CreateResult(cmdStore); err != nil {
+		c.log.Error("Unable to create result", "err", err)
+		return nil, false, &ChallengeError{msg: StoreError, typ: TypeStore}
+	}
+
+	return cmdStore, truncated, nil
 }
 
-func (c *Server) runAndStoreCmd(cmd string, ch *Challenge) (*store.CmdStore, error) {
-	cmdResp, err := c.runnerExecutor.RunContainer(cmd, ch)
+// runResult runs a command in a container and converts the response from the
+// runner into a result that can be stored. The output of the command is
+// copied to out while it runs if it isn't nil. It also reports whether the
+// output was cut at MaxOutputLength.
+//
+//nolint:gocritic // unnamedResult
+func runResult(log *slog.Logger, r RunnerExecutor, cmd string, ch *Challenge, out io.Writer) (*store.CmdStore, bool, error) {
+	var cmdResp *CmdResponse
+	var err error
+	if out != nil {
+		cmdResp, err = r.RunContainerStream(cmd, ch, out)
+	} else {
+		cmdResp, err = r.RunContainer(cmd, ch)
+	}
 	if err == ErrRunnerTimeout {
-		c.log.Error("Timeout running command", "err", err)
-		return nil, &ChallengeError{msg: RunnerTimeout, typ: TypeRunner}
+		log.Error("Timeout running command", "err", err)
+		return nil, false, &ChallengeError{msg: RunnerTimeout, typ: TypeRunner}
 	}
 	if err != nil {
-		c.log.Error("Runner error", "err", err)
-		return nil, &ChallengeError{msg: RunnerError, typ: TypeRunner}
+		log.Error("Runner error", "err", err)
+		return nil, false, &ChallengeError{msg: RunnerError, typ: TypeRunner}
 	}
 
 	if cmdResp.ErrorInternal != nil {
-		return nil, &ChallengeError{msg: *cmdResp.ErrorInternal, typ: TypeRunCmd}
+		return nil, false, &ChallengeError{msg: *cmdResp.ErrorInternal, typ: TypeRunCmd}
 	}
 
 	if cmdResp.Correct == nil || cmdResp.ExitCode == nil {
-		c.log.Error("Invalid response from runner, `Correct`, `ExitCode` must be set for responses that aren't internal errors")
-		return nil, &ChallengeError{msg: RunCmdInvalid, typ: TypeRunCmd}
+		log.Error("Invalid response from runner, `Correct`, `ExitCode` must be set for responses that aren't internal errors")
+		return nil, false, &ChallengeError{msg: RunCmdInvalid, typ: TypeRunCmd}
 	}
 
+	cmdResp.TruncateOutput()
 	cmdStore := &store.CmdStore{
 		Cmd:      toPtr(cmd),
+		CmdKey:   toPtr(NormalizeCmd(cmd)),
 		Slug:     toPtr(ch.Slug()),
 		Version:  toPtr(ch.Version()),
 		Correct:  cmdResp.Correct,
@@ -178,16 +354,28 @@ func (c *Server) runAndStoreCmd(cmd string, ch *Challenge) (*store.CmdStore, err
 		cmdStore.Error = cmdResp.Error
 	}
 
-	if err = c.cmdStorer.CreateResult(cmdStore); err != nil {
-		c.log.Error("Unable to create result", "err", err)
-		return nil, &ChallengeError{msg: StoreError, typ: TypeStore}
+	return cmdStore, cmdResp.Truncated != nil && *cmdResp.Truncated, nil
+}
+
+// submissionError is the failed check of an incorrect result.
+func submissionError(s *store.CmdStore) string {
+	if s.Error == nil || (s.Correct != nil && *s.Correct) {
+		return ""
 	}
+	return *s.Error
+}
 
-	return cmdStore, nil
+// truncateOutput cuts output to MaxOutputLength, marking that it was cut.
+func truncateOutput(output string) string {
+	return strings.ToValidUTF8(output[:MaxOutputLength-len(outputTruncatedSuffix)], "") + outputTruncatedSuffix
 }
 
-func (c *Server) runCmd(cmd string, ch *Challenge) (string, error) {
+// runCmd returns the result of a command, running it if it isn't cached.
+// Output of commands that are run is copied to out if it isn't nil.
+func (c *Server) runCmd(cmd string, ch *Challenge, out io.Writer) (*CmdResponse, error) {
+	start := time.Now()
 	resultCached := true
+	truncated := false
 
 	labels := metrics.CmdProcessedLabels{
 		Slug:    ch.Slug(),
@@ -195,31 +383,43 @@ func (c *Server) runCmd(cmd string, ch *Challenge) (string, error) {
 		Correct: "false",
 	}
 
-	cmdStore, err := c.cmdStorer.GetResult(cmd, ch.Slug(), ch.Version())
+	// Commands that only differ by insignificant whitespace share a result
+	cmdKey := NormalizeCmd(cmd)
+
+	// Results of seeded runs aren't cached, they are always run
+	seeded := ch.Seed() != 0
+	var cmdStore *store.CmdStore
+	err := store.ErrResultNotFound
+	if !seeded {
+		cmdStore, err = c.cmdStorer.GetResult(cmdKey, ch.Slug(), ch.Version())
+	}
 	if err == store.ErrResultNotFound {
 		c.log.Info("No result found in cache, executing cmd",
 			"cmd", cmd,
 			"chDir", ch.Dir(),
 			"slug", ch.Slug(),
+			"seeded", seeded,
 		)
 		// Run a new command and store it
 		resultCached = false
 		labels.Cached = "false"
-		cmdStore, err = c.runAndStoreCmd(cmd, ch)
+		cmdStore, truncated, err = c.runAndStoreCmd(cmd, ch, out)
 		if err != nil {
-			return "", err
+			return nil, err
 		}
 	}
 
 	if err != nil {
 		c.log.Error("Unable to query result", "err", err)
-		return "", &ChallengeError{msg: StoreQueryError, typ: TypeStore}
+		return nil, &ChallengeError{msg: StoreQueryError, typ: TypeStore}
 	}
 
-	c.log.Info("Incrementing result", "cmd", cmd, "version", ch.Version())
-	if err = c.cmdStorer.IncrementResult(cmd, ch.Slug(), ch.Version()); err != nil {
-		c.log.Error("Unable to increment result counter", "err", err)
-		return "", &ChallengeError{msg: StoreQueryError, typ: TypeStore}
+	if !seeded {
+		c.log.Info("Incrementing result", "cmd", cmd, "version", ch.Version())
+		if err = c.cmdStorer.IncrementResult(cmdKey, ch.Slug(), ch.Version()); err != nil {
+			c.log.Error("Unable to increment result counter", "err", err)
+			return nil, &ChallengeError{msg: StoreQueryError, typ: TypeStore}
+		}
 	}
 
 	resp := CmdResponse{
@@ -230,10 +430,8 @@ func (c *Server) runCmd(cmd string, ch *Challenge) (string, error) {
 	}
 
 	resp.Cached = toPtr(resultCached)
-
-	b, err := json.Marshal(resp)
-	if err != nil {
-		return "", ErrServerDecode
+	if truncated {
+		resp.Truncated = toPtr(true)
 	}
 
 	if *cmdStore.Correct {
@@ -242,7 +440,19 @@ func (c *Server) runCmd(cmd string, ch *Challenge) (string, error) {
 
 	c.metrics.CmdProcessed.WithLabelValues(labels.Cached, labels.Slug, labels.Correct).Inc()
 
-	return string(b), nil
+	c.submissions.record(&store.Submission{
+		Slug:       ch.Slug(),
+		Version:    ch.Version(),
+		CmdHash:    cmdHash(cmdKey),
+		CmdLength:  len(cmdKey),
+		Correct:    *cmdStore.Correct,
+		Cached:     resultCached,
+		Error:      submissionError(cmdStore),
+		Latency:    time.Since(start),
+		CreateTime: start,
+	})
+
+	return &resp, nil
 }
 
 func isValidRequest(slug, cmd string) error {
@@ -1,14 +1,17 @@
 package challenge
 
 import (
+	"context"
 	"encoding/json"
+	"io"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"strings"
 	"testing"
+	"time"
 
-	"github.com/go-logr/logr/testr"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
@@ -25,6 +28,7 @@ var (
 	}
 	fakeStore = store.CmdStore{
 		Cmd:      toPtr("echo hello world"),
+		CmdKey:   toPtr("echo hello world"),
 		Slug:     toPtr("hello_world"),
 		Version:  toPtr(5),
 		Correct:  toPtr(true),
@@ -59,8 +63,72 @@ func (c *StubStor) IncrementResult(cmd, slug string, version int) error {
 	return args.Error(0)
 }
 
-func (c *StubStor) TopCmdsForSlug(slug string) ([]string, error) {
-	return make([]string, 0), nil
+func (c *StubStor) TopCmdsForSlug(q store.CmdsQuery) ([]store.Solution, error) {
+	args := c.Called(q)
+
+	if args[0] == nil {
+		return nil, args.Error(1)
+	}
+
+	return args.Get(0).([]store.Solution), args.Error(1)
+}
+
+func (c *StubStor) StatsForSlug(slug string, version int) (*store.SlugStats, error) {
+	args := c.Called(slug, version)
+
+	if args[0] == nil {
+		return nil, args.Error(1)
+	}
+
+	return args.Get(0).(*store.SlugStats), args.Error(1)
+}
+
+func (c *StubStor) DailyStatsForSlug(slug string, version int, start, end time.Time) (*store.DailyStats, error) {
+	args := c.Called(slug, version, start, end)
+
+	if args[0] == nil {
+		return nil, args.Error(1)
+	}
+
+	return args.Get(0).(*store.DailyStats), args.Error(1)
+}
+
+func (c *StubStor) ModerateResult(cmd, slug string, version int, m store.Moderation) error {
+	args := c.Called(cmd, slug, version, m)
+	return args.Error(0)
+}
+
+func (c *StubStor) PreviousVersion(slug string, version int) (int, error) {
+	args := c.Called(slug, version)
+	return args.Int(0), args.Error(1)
+}
+
+func (c *StubStor) CorrectCmdsForVersion(slug string, version, limit int) ([]string, error) {
+	args := c.Called(slug, version, limit)
+
+	if args[0] == nil {
+		return nil, args.Error(1)
+	}
+
+	return args.Get(0).([]string), args.Error(1)
+}
+
+func (c *StubStor) CreateSubmission(s *store.Submission) error {
+	return nil
+}
+
+func (c *StubStor) PruneSubmissions(before time.Time) (int64, error) {
+	return 0, nil
+}
+
+func (c *StubStor) Ping(ctx context.Context) error {
+	args := c.Called()
+
+	return args.Error(0)
+}
+
+func (c *StubStor) Close() error {
+	return nil
 }
 
 type StubRunnerExecutor struct {
@@ -79,6 +147,19 @@ func (s *StubRunnerExecutor) RunContainer(cmd string, ch *Challenge) (*CmdRespon
 	return args.Get(0).(*CmdResponse), args.Error(1)
 }
 
+// RunContainerStream writes the output of the response to out before
+// returning it
+func (s *StubRunnerExecutor) RunContainerStream(cmd string, ch *Challenge, out io.Writer) (*CmdResponse, error) {
+	args := s.Called(cmd, ch)
+
+	resp := args.Get(0).(*CmdResponse)
+	if resp != nil && resp.Output != nil {
+		_, _ = io.WriteString(out, *resp.Output)
+	}
+
+	return resp, args.Error(1)
+}
+
 func TestRequestNoCache(t *testing.T) {
 	req, resp := createTestRequest()
 	stubStore := &StubStor{}
@@ -111,7 +192,7 @@ func TestRequestNoCache(t *testing.T) {
 		helloWorldCh(t),
 	).Return(&fakeResponse, nil)
 
-	s := NewServer(testr.New(t), cfg, metrics.New(testr.New(t)), stubRunnerExecutor, stubStore)
+	s := NewServer(testLogger(t), cfg, metrics.New(testLogger(t)), stubRunnerExecutor, stubStore, ServerOptions{})
 	s.runHandler(resp, req)
 
 	stubStore.AssertExpectations(t)
@@ -127,6 +208,35 @@ func TestRequestNoCache(t *testing.T) {
 	assert.Equal(t, 200, resp.Code)
 }
 
+func TestRequestTruncated(t *testing.T) {
+	req, resp := createTestRequest()
+	stubStore := &StubStor{}
+	stubStore.On("GetResult", "echo hello world", "hello_world", 5).Return(nil, store.ErrResultNotFound).Once()
+	stubStore.On("CreateResult", mock.MatchedBy(func(s *store.CmdStore) bool {
+		return len(*s.Output) <= MaxOutputLength
+	})).Return(nil).Once()
+	stubStore.On("IncrementResult", "echo hello world", "hello_world", 5).Return(nil).Once()
+
+	stubRunnerExecutor := &StubRunnerExecutor{}
+	stubRunnerExecutor.On("RunContainer", "echo hello world", helloWorldCh(t)).Return(&CmdResponse{
+		Correct:  toPtr(false),
+		ExitCode: toPtr(0),
+		Output:   toPtr(strings.Repeat("y", MaxOutputLength+1)),
+	}, nil)
+
+	s := NewServer(testLogger(t), cfg, metrics.New(testLogger(t)), stubRunnerExecutor, stubStore, ServerOptions{})
+	s.runHandler(resp, req)
+
+	stubStore.AssertExpectations(t)
+	require.Equal(t, 200, resp.Code)
+
+	result := CmdResponse{}
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &result))
+	assert.True(t, *result.Truncated)
+	assert.True(t, strings.HasSuffix(*result.Output, outputTruncatedSuffix))
+	assert.Equal(t, AbuseTruncated, abuseKind(&result, nil))
+}
+
 func TestRequestCached(t *testing.T) {
 	req, resp := createTestRequest()
 
@@ -150,7 +260,7 @@ func TestRequestCached(t *testing.T) {
 	// Expectation for Runner Executor
 	stubRunnerExecutor := &StubRunnerExecutor{}
 
-	s := NewServer(testr.New(t), cfg, metrics.New(testr.New(t)), stubRunnerExecutor, stubStore)
+	s := NewServer(testLogger(t), cfg, metrics.New(testLogger(t)), stubRunnerExecutor, stubStore, ServerOptions{})
 	s.runHandler(resp, req)
 
 	stubStore.AssertExpectations(t)
@@ -166,9 +276,192 @@ func TestRequestCached(t *testing.T) {
 	assert.Equal(t, 200, resp.Code)
 }
 
+func TestRequestNormalizedCached(t *testing.T) {
+	req, resp := createTestRequestCmd("  echo   hello world ;")
+
+	stubStore := &StubStor{}
+
+	stubStore.On(
+		"GetResult",
+		"echo hello world",
+		"hello_world",
+		5,
+	).Return(&fakeStore, nil).Once()
+
+	stubStore.On(
+		"IncrementResult",
+		"echo hello world",
+		"hello_world",
+		5,
+	).Once().Return(nil)
+
+	stubRunnerExecutor := &StubRunnerExecutor{}
+
+	s := NewServer(testLogger(t), cfg, metrics.New(testLogger(t)), stubRunnerExecutor, stubStore, ServerOptions{})
+	s.runHandler(resp, req)
+
+	stubStore.AssertExpectations(t)
+	stubRunnerExecutor.AssertExpectations(t)
+
+	expectedResp := `{"Cached":true,"Correct":true,"ExitCode":0,"Output":"hello world"}`
+	assert.Equal(t, expectedResp, resp.Body.String())
+}
+
+func TestRequestInvalid(t *testing.T) {
+	data := url.Values{}
+	data.Set("slug", "hello_world")
+	req, _ := http.NewRequest(http.MethodPost, "/c/r", strings.NewReader(data.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp := httptest.NewRecorder()
+
+	s := NewServer(testLogger(t), cfg, metrics.New(testLogger(t)), &StubRunnerExecutor{}, &StubStor{}, ServerOptions{})
+	s.runHandler(resp, req)
+
+	expectedResp := `{"error":{"code":"invalid_request","message":"request must include slug and cmd"}}`
+	assert.Equal(t, expectedResp, resp.Body.String())
+	assert.Equal(t, "application/json; charset=utf-8", resp.Header().Get("Content-Type"))
+	assert.Equal(t, 400, resp.Code)
+}
+
+func TestRequestRunnerTimeout(t *testing.T) {
+	req, resp := createTestRequest()
+	stubStore := &StubStor{}
+
+	stubStore.On(
+		"GetResult",
+		"echo hello world",
+		"hello_world",
+		5,
+	).Return(nil, store.ErrResultNotFound).Once()
+
+	stubRunnerExecutor := &StubRunnerExecutor{}
+	stubRunnerExecutor.On(
+		"RunContainer",
+		"echo hello world",
+		helloWorldCh(t),
+	).Return((*CmdResponse)(nil), ErrRunnerTimeout)
+
+	s := NewServer(testLogger(t), cfg, metrics.New(testLogger(t)), stubRunnerExecutor, stubStore, ServerOptions{})
+	s.runHandler(resp, req)
+
+	stubStore.AssertExpectations(t)
+	stubRunnerExecutor.AssertExpectations(t)
+
+	expectedResp := `{"error":{"code":"runner_timeout","message":"timed out executing command"}}`
+	assert.Equal(t, expectedResp, resp.Body.String())
+	assert.Equal(t, 504, resp.Code)
+}
+
+func TestRequestJSON(t *testing.T) {
+	tests := []struct {
+		body string
+	}{
+		{`{"slug":"hello_world","cmd":"echo hello world"}`},
+		{`{"slug":"hello_world","cmd":"echo hello world","encoding":"plain"}`},
+		{`{"slug":"hello_world","cmd":"ZWNobyBoZWxsbyB3b3JsZA==","encoding":"base64"}`},
+	}
+
+	for _, tt := range tests {
+		req, resp := createTestRequestJSON(tt.body)
+		stubStore := &StubStor{}
+
+		stubStore.On(
+			"GetResult",
+			"echo hello world",
+			"hello_world",
+			5,
+		).Return(&fakeStore, nil).Once()
+
+		stubStore.On(
+			"IncrementResult",
+			"echo hello world",
+			"hello_world",
+			5,
+		).Once().Return(nil)
+
+		s := NewServer(testLogger(t), cfg, metrics.New(testLogger(t)), &StubRunnerExecutor{}, stubStore, ServerOptions{})
+		s.runHandler(resp, req)
+
+		stubStore.AssertExpectations(t)
+		assert.Equal(t, 200, resp.Code, tt.body)
+	}
+}
+
+func TestRequestJSONPlainNotDecoded(t *testing.T) {
+	// "true" is valid base64, a form post would decode it
+	req, resp := createTestRequestJSON(`{"slug":"hello_world","cmd":"true"}`)
+	stubStore := &StubStor{}
+
+	stubStore.On(
+		"GetResult",
+		"true",
+		"hello_world",
+		5,
+	).Return(&fakeStore, nil).Once()
+
+	stubStore.On(
+		"IncrementResult",
+		"true",
+		"hello_world",
+		5,
+	).Once().Return(nil)
+
+	s := NewServer(testLogger(t), cfg, metrics.New(testLogger(t)), &StubRunnerExecutor{}, stubStore, ServerOptions{})
+	s.runHandler(resp, req)
+
+	stubStore.AssertExpectations(t)
+	assert.Equal(t, 200, resp.Code)
+}
+
+func TestRequestJSONInvalid(t *testing.T) {
+	tests := []struct {
+		body   string
+		code   string
+		status int
+	}{
+		{`{"slug":"hello_world"`, "invalid_request", 400},
+		{`{"slug":"hello_world","cmd":"ls","extra":1}`, "invalid_request", 400},
+		{`{"slug":"hello_world"}`, "invalid_request", 400},
+		{`{"slug":"hello_world","cmd":"ls","encoding":"hex"}`, "invalid_encoding", 400},
+		{`{"slug":"hello_world","cmd":"not base64!","encoding":"base64"}`, "invalid_encoding", 400},
+	}
+
+	for _, tt := range tests {
+		req, resp := createTestRequestJSON(tt.body)
+
+		s := NewServer(testLogger(t), cfg, metrics.New(testLogger(t)), &StubRunnerExecutor{}, &StubStor{}, ServerOptions{})
+		s.runHandler(resp, req)
+
+		assert.Contains(t, resp.Body.String(), `"code":"`+tt.code+`"`, tt.body)
+		assert.Equal(t, tt.status, resp.Code, tt.body)
+	}
+}
+
+func TestRequestContentType(t *testing.T) {
+	req, resp := createTestRequestJSON("echo hello world")
+	req.Header.Set("Content-Type", "text/plain")
+
+	s := NewServer(testLogger(t), cfg, metrics.New(testLogger(t)), &StubRunnerExecutor{}, &StubStor{}, ServerOptions{})
+	s.runHandler(resp, req)
+
+	assert.Equal(t, 415, resp.Code)
+}
+
+func createTestRequestJSON(body string) (*http.Request, *httptest.ResponseRecorder) {
+	req, _ := http.NewRequest(http.MethodPost, "/c/r", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.RemoteAddr = "1.1.1.1:80"
+
+	return req, httptest.NewRecorder()
+}
+
 func createTestRequest() (*http.Request, *httptest.ResponseRecorder) {
+	return createTestRequestCmd("echo hello world")
+}
+
+func createTestRequestCmd(cmd string) (*http.Request, *httptest.ResponseRecorder) {
 	data := url.Values{}
-	data.Set("cmd", "echo hello world")
+	data.Set("cmd", cmd)
 	data.Set("slug", "hello_world")
 	req, _ := http.NewRequest(http.MethodPost, "/c/r", strings.NewReader(data.Encode()))
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
@@ -177,6 +470,10 @@ func createTestRequest() (*http.Request, *httptest.ResponseRecorder) {
 	return req, httptest.NewRecorder()
 }
 
+func testLogger(t *testing.T) *slog.Logger {
+	return slog.New(slog.NewTextHandler(t.Output(), nil))
+}
+
 func helloWorldCh(t *testing.T) *Challenge {
 	ch, err := NewChallenge(ChallengeOptions{Slug: "hello_world"})
 	require.NoError(t, err)
@@ -0,0 +1,461 @@
+package challenge
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"gitlab.com/jarv/cmdchallenge/internal/config"
+	"gitlab.com/jarv/cmdchallenge/internal/metrics"
+	"gitlab.com/jarv/cmdchallenge/internal/store"
+)
+
+const (
+	// SessionHeader carries the session token, requests without it are
+	// anonymous and their progress isn't recorded
+	SessionHeader = "X-Session-Token"
+
+	sessionTokenBytes = 32
+	maxImportItems    = 500
+)
+
+// Handles are shown on leaderboards
+var handleRe = regexp.MustCompile(`^[A-Za-z0-9_-]{3,20}$`)
+
+type jsonSession struct {
+	Token string `json:"token"`
+}
+
+type jsonHandle struct {
+	Handle string `json:"handle"`
+}
+
+type jsonProgressItem struct {
+	Slug    string `json:"slug"`
+	Version int    `json:"version"`
+	Cmd     string `json:"cmd"`
+}
+
+type jsonProgress struct {
+	Progress []jsonProgressItem `json:"progress"`
+}
+
+type jsonImport struct {
+	Imported int `json:"imported"`
+	Rejected int `json:"rejected"`
+}
+
+// Sessions issues anonymous session tokens and keeps the challenges solved
+// by each session so progress can move between browsers.
+type Sessions struct {
+	log           *slog.Logger
+	cfg           *config.Config
+	metrics       *metrics.Metrics
+	sessionStorer store.SessionStorer
+	cmdStorer     store.CmdStorer
+	blocklist     *Blocklist
+}
+
+func NewSessions(
+	log *slog.Logger,
+	cfg *config.Config,
+	m *metrics.Metrics,
+	ss store.SessionStorer,
+	cs store.CmdStorer,
+	bl *Blocklist,
+) *Sessions {
+	return &Sessions{
+		log:           log,
+		cfg:           cfg,
+		metrics:       m,
+		sessionStorer: ss,
+		cmdStorer:     cs,
+		blocklist:     bl,
+	}
+}
+
+func (s *Sessions) httpError(w http.ResponseWriter, e error) {
+	s.metrics.CmdErrors.WithLabelValues(errorLabel(e), TypeServer).Inc()
+	writeError(w, e)
+}
+
+// PruneIdle removes idle sessions without progress every prune interval
+// until ctx is done, a session is created for every visit so most of them
+// are never used again.
+func (s *Sessions) PruneIdle(ctx context.Context) {
+	ticker := time.NewTicker(s.cfg.SessionPruneInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.prune()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (s *Sessions) prune() {
+	before := time.Now().Add(-s.cfg.SessionRetention)
+	pruned, err := s.sessionStorer.PruneSessions(before)
+	if err != nil {
+		s.log.Error("Unable to prune sessions", "err", err)
+		return
+	}
+	s.log.Info("Pruned sessions", "count", pruned, "before", before)
+	s.metrics.SessionsPruned.Add(float64(pruned))
+}
+
+// fromRequest returns the id of the session of the request, or an empty
+// string for requests without a session token.
+func (s *Sessions) fromRequest(req *http.Request) (string, error) {
+	token := req.Header.Get(SessionHeader)
+	if token == "" {
+		return "", nil
+	}
+
+	id := sessionID(token)
+	err := s.sessionStorer.TouchSession(id, time.Now())
+	if errors.Is(err, store.ErrSessionNotFound) {
+		return "", ErrSessionInvalid
+	}
+	if err != nil {
+		s.log.Error("Unable to look up session", "err", err)
+		return "", ErrSessionStore
+	}
+	return id, nil
+}
+
+// checkUnlocked returns ErrServerChallengeLocked unless the session has
+// solved every challenge ch requires, in any version.
+func (s *Sessions) checkUnlocked(id string, ch *Challenge) error {
+	if len(ch.Requires()) == 0 {
+		return nil
+	}
+
+	solved, err := s.solvedSlugs(id)
+	if err != nil {
+		return err
+	}
+
+	if missing := missingRequires(ch, solved); len(missing) > 0 {
+		return fmt.Errorf("%w, solve %s first", ErrServerChallengeLocked, strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// solvedSlugs returns the challenges the session solved in any version.
+func (s *Sessions) solvedSlugs(id string) (map[string]bool, error) {
+	progress, err := s.sessionStorer.ProgressForSession(id)
+	if err != nil {
+		s.log.Error("Unable to query progress", "err", err)
+		return nil, ErrSessionStore
+	}
+
+	solved := make(map[string]bool, len(progress))
+	for _, p := range progress {
+		solved[p.Slug] = true
+	}
+	return solved, nil
+}
+
+// missingRequires returns the challenges ch requires that aren't solved.
+func missingRequires(ch *Challenge, solved map[string]bool) []string {
+	var missing []string
+	for _, slug := range ch.Requires() {
+		if !solved[slug] {
+			missing = append(missing, slug)
+		}
+	}
+	return missing
+}
+
+// record keeps cmd as progress of the session if it is the shortest correct
+// command the session sent for the challenge version.
+func (s *Sessions) record(id, slug string, version int, cmd string) {
+	err := s.sessionStorer.RecordProgress(id, &store.Progress{
+		Slug:       slug,
+		Version:    version,
+		Cmd:        cmd,
+		CmdKey:     NormalizeCmd(cmd),
+		UpdateTime: time.Now(),
+	})
+	if err != nil {
+		s.log.Error("Unable to record progress", "slug", slug, "version", version, "err", err)
+	}
+}
+
+// SessionHandler issues a new session token.
+func (s *Sessions) SessionHandler() http.Handler {
+	return http.HandlerFunc(s.sessionHandler)
+}
+
+func (s *Sessions) sessionHandler(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Cache-Control", "no-store, max-age=0")
+
+	if req.Method != http.MethodPost {
+		s.log.Error("expect POST", "method", req.Method)
+		s.httpError(w, ErrServerInvalidMethod)
+		return
+	}
+
+	token, err := newSessionToken()
+	if err != nil {
+		s.log.Error("Unable to generate session token", "err", err)
+		s.httpError(w, ErrServerUnknown)
+		return
+	}
+
+	if err := s.sessionStorer.CreateSession(sessionID(token), time.Now()); err != nil {
+		s.log.Error("Unable to create session", "err", err)
+		s.httpError(w, ErrSessionStore)
+		return
+	}
+
+	s.log.Info("Session created", "Addr", req.RemoteAddr)
+	writeJSON(w, &jsonSession{Token: token})
+}
+
+// HandleHandler sets the handle the session of the request is shown with on
+// leaderboards, sessions without a handle aren't ranked.
+func (s *Sessions) HandleHandler() http.Handler {
+	return http.HandlerFunc(s.handleHandler)
+}
+
+func (s *Sessions) handleHandler(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Cache-Control", "no-store, max-age=0")
+
+	if req.Method != http.MethodPost {
+		s.log.Error("expect POST", "method", req.Method)
+		s.httpError(w, ErrServerInvalidMethod)
+		return
+	}
+
+	id, ok := s.requireSession(w, req)
+	if !ok {
+		return
+	}
+
+	var handleReq jsonHandle
+	dec := json.NewDecoder(http.MaxBytesReader(w, req.Body, maxRequestBodyBytes))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&handleReq); err != nil {
+		s.httpError(w, ErrServerInvalidBody)
+		return
+	}
+
+	if !handleRe.MatchString(handleReq.Handle) {
+		s.httpError(w, ErrSessionInvalidHandle)
+		return
+	}
+	if s.blocklist.Matches(handleReq.Handle) {
+		s.log.Info("Rejected blocklisted handle", "handle", handleReq.Handle, "Addr", req.RemoteAddr)
+		s.httpError(w, ErrSessionHandleBlocked)
+		return
+	}
+
+	err := s.sessionStorer.SetHandle(id, handleReq.Handle)
+	if errors.Is(err, store.ErrHandleTaken) {
+		s.httpError(w, err)
+		return
+	}
+	if err != nil {
+		s.log.Error("Unable to set handle", "err", err)
+		s.httpError(w, ErrSessionStore)
+		return
+	}
+
+	writeJSON(w, &handleReq)
+}
+
+// ProgressHandler returns the progress of the session of the request.
+func (s *Sessions) ProgressHandler() http.Handler {
+	return http.HandlerFunc(s.progressHandler)
+}
+
+func (s *Sessions) progressHandler(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Cache-Control", "no-store, max-age=0")
+
+	if req.Method != http.MethodGet {
+		s.log.Error("expect GET", "method", req.Method)
+		s.httpError(w, ErrServerInvalidMethod)
+		return
+	}
+
+	id, ok := s.requireSession(w, req)
+	if !ok {
+		return
+	}
+
+	progress, err := s.sessionStorer.ProgressForSession(id)
+	if err != nil {
+		s.log.Error("Unable to query progress", "err", err)
+		s.httpError(w, ErrSessionStore)
+		return
+	}
+
+	resp := jsonProgress{Progress: make([]jsonProgressItem, 0, len(progress))}
+	for _, p := range progress {
+		resp.Progress = append(resp.Progress, jsonProgressItem{Slug: p.Slug, Version: p.Version, Cmd: p.Cmd})
+	}
+	writeJSON(w, &resp)
+}
+
+// ImportHandler adds progress exported from another session to the session
+// of the request. Only commands with a stored correct result are imported.
+func (s *Sessions) ImportHandler() http.Handler {
+	return http.HandlerFunc(s.importHandler)
+}
+
+func (s *Sessions) importHandler(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Cache-Control", "no-store, max-age=0")
+
+	if req.Method != http.MethodPost {
+		s.log.Error("expect POST", "method", req.Method)
+		s.httpError(w, ErrServerInvalidMethod)
+		return
+	}
+
+	id, ok := s.requireSession(w, req)
+	if !ok {
+		return
+	}
+
+	var importReq jsonProgress
+	dec := json.NewDecoder(http.MaxBytesReader(w, req.Body, maxRequestBodyBytes*maxImportItems))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&importReq); err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			s.httpError(w, ErrSessionImportTooLarge)
+			return
+		}
+		s.httpError(w, ErrServerInvalidBody)
+		return
+	}
+
+	if len(importReq.Progress) > maxImportItems {
+		s.httpError(w, ErrSessionImportTooLarge)
+		return
+	}
+
+	var (
+		resp     jsonImport
+		verified []verifiedItem
+	)
+	for _, item := range importReq.Progress {
+		v, err := s.verify(item)
+		if err != nil {
+			resp.Rejected++
+			continue
+		}
+		verified = append(verified, v)
+	}
+
+	solved, err := s.solvedSlugs(id)
+	if err != nil {
+		s.httpError(w, err)
+		return
+	}
+
+	// Items may unlock each other in any order, keep recording the ones that
+	// are unlocked until none are left to unlock. The rest stay locked.
+	for recorded := true; recorded; {
+		recorded = false
+		locked := verified[:0]
+		for _, v := range verified {
+			if len(missingRequires(v.ch, solved)) > 0 {
+				locked = append(locked, v)
+				continue
+			}
+			s.record(id, v.ch.Slug(), v.version, v.cmd)
+			solved[v.ch.Slug()] = true
+			resp.Imported++
+			recorded = true
+		}
+		verified = locked
+	}
+	resp.Rejected += len(verified)
+
+	s.log.Info("Progress imported", "imported", resp.Imported, "rejected", resp.Rejected, "Addr", req.RemoteAddr)
+	writeJSON(w, &resp)
+}
+
+// verifiedItem is a progress item with a stored correct result.
+type verifiedItem struct {
+	ch      *Challenge
+	version int
+	cmd     string
+}
+
+// verify returns the challenge and version of a progress item if its
+// command has a stored correct result, items without a version are for the
+// current version.
+func (s *Sessions) verify(item jsonProgressItem) (verifiedItem, error) {
+	if err := isValidRequest(item.Slug, item.Cmd); err != nil {
+		return verifiedItem{}, err
+	}
+
+	ch, err := NewChallenge(ChallengeOptions{Slug: item.Slug})
+	if err != nil {
+		return verifiedItem{}, ErrServerInvalidChallenge
+	}
+
+	version := item.Version
+	if version == 0 {
+		version = ch.Version()
+	}
+
+	result, err := s.cmdStorer.GetResult(NormalizeCmd(item.Cmd), ch.Slug(), version)
+	if err != nil {
+		return verifiedItem{}, err
+	}
+	if result.Correct == nil || !*result.Correct {
+		return verifiedItem{}, ErrSessionNotSolved
+	}
+	return verifiedItem{ch: ch, version: version, cmd: item.Cmd}, nil
+}
+
+func (s *Sessions) requireSession(w http.ResponseWriter, req *http.Request) (string, bool) {
+	id, err := s.fromRequest(req)
+	if err == nil && id == "" {
+		err = ErrSessionRequired
+	}
+	if err != nil {
+		s.httpError(w, err)
+		return "", false
+	}
+	return id, true
+}
+
+func newSessionToken() (string, error) {
+	b := make([]byte, sessionTokenBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// sessionID is the id sessions are stored under, tokens aren't stored so
+// they can't be recovered from the db.
+func sessionID(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	b, _ := json.Marshal(v)
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	_, _ = w.Write(b)
+}
@@ -0,0 +1,241 @@
+package challenge
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gitlab.com/jarv/cmdchallenge/internal/metrics"
+	"gitlab.com/jarv/cmdchallenge/internal/store"
+)
+
+func newTestSession(t *testing.T, sessions *Sessions) string {
+	req, _ := http.NewRequest(http.MethodPost, "/c/session", http.NoBody)
+	resp := httptest.NewRecorder()
+	sessions.SessionHandler().ServeHTTP(resp, req)
+	require.Equal(t, 200, resp.Code)
+
+	var session jsonSession
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &session))
+	require.NotEmpty(t, session.Token)
+	return session.Token
+}
+
+func getProgress(sessions *Sessions, token string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(http.MethodGet, "/c/progress", http.NoBody)
+	if token != "" {
+		req.Header.Set(SessionHeader, token)
+	}
+	resp := httptest.NewRecorder()
+	sessions.ProgressHandler().ServeHTTP(resp, req)
+	return resp
+}
+
+func TestSessionProgress(t *testing.T) {
+	stubStore := &StubStor{}
+	stubStore.On(
+		"GetResult",
+		"echo hello world",
+		"hello_world",
+		5,
+	).Return(&fakeStore, nil).Once()
+
+	stubStore.On(
+		"IncrementResult",
+		"echo hello world",
+		"hello_world",
+		5,
+	).Return(nil).Once()
+
+	m := metrics.New(testLogger(t))
+	sessions := NewSessions(testLogger(t), cfg, m, store.NewMemSessionStore(), stubStore, nil)
+	token := newTestSession(t, sessions)
+
+	req, resp := createTestRequest()
+	req.Header.Set(SessionHeader, token)
+	NewServer(testLogger(t), cfg, m, &StubRunnerExecutor{}, stubStore, ServerOptions{Sessions: sessions}).runHandler(resp, req)
+	require.Equal(t, 200, resp.Code)
+	stubStore.AssertExpectations(t)
+
+	resp = getProgress(sessions, token)
+	assert.Equal(t, 200, resp.Code)
+	assert.Equal(t, `{"progress":[{"slug":"hello_world","version":5,"cmd":"echo hello world"}]}`, resp.Body.String())
+
+	// Sessions don't see each other's progress
+	assert.Equal(t, `{"progress":[]}`, getProgress(sessions, newTestSession(t, sessions)).Body.String())
+}
+
+func TestSessionInvalid(t *testing.T) {
+	m := metrics.New(testLogger(t))
+	sessions := NewSessions(testLogger(t), cfg, m, store.NewMemSessionStore(), &StubStor{}, nil)
+
+	resp := getProgress(sessions, "")
+	assert.Equal(t, 401, resp.Code)
+	assert.Contains(t, resp.Body.String(), `"code":"invalid_session"`)
+	assert.Equal(t, 401, getProgress(sessions, "does-not-exist").Code)
+
+	req, resp := createTestRequest()
+	req.Header.Set(SessionHeader, "does-not-exist")
+	NewServer(testLogger(t), cfg, m, &StubRunnerExecutor{}, &StubStor{}, ServerOptions{Sessions: sessions}).runHandler(resp, req)
+	assert.Equal(t, 401, resp.Code)
+}
+
+func TestSessionLockedChallenge(t *testing.T) {
+	stubStore := &StubStor{}
+	stubStore.On("GetResult", "ls", "12days_2", 1).Return(&fakeStore, nil).Once()
+	stubStore.On("IncrementResult", "ls", "12days_2", 1).Return(nil).Once()
+
+	m := metrics.New(testLogger(t))
+	ss := store.NewMemSessionStore()
+	sessions := NewSessions(testLogger(t), cfg, m, ss, stubStore, nil)
+	s := NewServer(testLogger(t), cfg, m, &StubRunnerExecutor{}, stubStore, ServerOptions{Sessions: sessions})
+	token := newTestSession(t, sessions)
+
+	submit := func(token string) *httptest.ResponseRecorder {
+		req, resp := createTestRequestJSON(`{"slug":"12days_2","cmd":"ls"}`)
+		if token != "" {
+			req.Header.Set(SessionHeader, token)
+		}
+		s.runHandler(resp, req)
+		return resp
+	}
+
+	resp := submit(token)
+	assert.Equal(t, 403, resp.Code)
+	assert.Equal(t, `{"error":{"code":"challenge_locked","message":"challenge is locked, solve 12days_1 first"}}`, resp.Body.String())
+
+	require.NoError(t, ss.RecordProgress(sessionID(token), &store.Progress{Slug: "12days_1", Version: 1, Cmd: "ls"}))
+	assert.Equal(t, 200, submit(token).Code)
+	stubStore.AssertExpectations(t)
+}
+
+func TestProgressImport(t *testing.T) {
+	stubStore := &StubStor{}
+	stubStore.On(
+		"GetResult",
+		"echo hello world",
+		"hello_world",
+		4,
+	).Return(&fakeStore, nil).Once()
+
+	stubStore.On(
+		"GetResult",
+		"echo hi",
+		"hello_world",
+		5,
+	).Return(nil, store.ErrResultNotFound).Once()
+
+	stubStore.On(
+		"GetResult",
+		"ls",
+		"hello_world",
+		5,
+	).Return(&store.CmdStore{Correct: toPtr(false)}, nil).Once()
+
+	sessions := NewSessions(testLogger(t), cfg, metrics.New(testLogger(t)), store.NewMemSessionStore(), stubStore, nil)
+	token := newTestSession(t, sessions)
+
+	body := `{"progress":[` +
+		`{"slug":"hello_world","version":4,"cmd":"echo hello  world"},` +
+		`{"slug":"hello_world","cmd":"echo hi"},` +
+		`{"slug":"hello_world","cmd":"ls"},` +
+		`{"slug":"does_not_exist","cmd":"ls"}` +
+		`]}`
+	req, _ := http.NewRequest(http.MethodPost, "/c/progress/import", strings.NewReader(body))
+	req.Header.Set(SessionHeader, token)
+	resp := httptest.NewRecorder()
+	sessions.ImportHandler().ServeHTTP(resp, req)
+
+	stubStore.AssertExpectations(t)
+	assert.Equal(t, 200, resp.Code)
+	assert.Equal(t, `{"imported":1,"rejected":3}`, resp.Body.String())
+	assert.Equal(t, `{"progress":[{"slug":"hello_world","version":4,"cmd":"echo hello  world"}]}`,
+		getProgress(sessions, token).Body.String())
+}
+
+func TestProgressImportLocked(t *testing.T) {
+	stubStore := &StubStor{}
+	for _, slug := range []string{"12days_4", "12days_2", "12days_1"} {
+		stubStore.On("GetResult", "ls", slug, 1).Return(&fakeStore, nil).Once()
+	}
+
+	sessions := NewSessions(testLogger(t), cfg, metrics.New(testLogger(t)), store.NewMemSessionStore(), stubStore, nil)
+	token := newTestSession(t, sessions)
+
+	// 12days_2 is unlocked by 12days_1 later in the import, 12days_3 which
+	// unlocks 12days_4 was never solved
+	body := `{"progress":[` +
+		`{"slug":"12days_4","cmd":"ls"},` +
+		`{"slug":"12days_2","cmd":"ls"},` +
+		`{"slug":"12days_1","cmd":"ls"}` +
+		`]}`
+	req, _ := http.NewRequest(http.MethodPost, "/c/progress/import", strings.NewReader(body))
+	req.Header.Set(SessionHeader, token)
+	resp := httptest.NewRecorder()
+	sessions.ImportHandler().ServeHTTP(resp, req)
+
+	stubStore.AssertExpectations(t)
+	assert.Equal(t, 200, resp.Code)
+	assert.Equal(t, `{"imported":2,"rejected":1}`, resp.Body.String())
+	assert.NotContains(t, getProgress(sessions, token).Body.String(), "12days_4")
+}
+
+func TestSessionHandle(t *testing.T) {
+	bl, err := NewBlocklist([]string{"badword"})
+	require.NoError(t, err)
+	sessions := NewSessions(testLogger(t), cfg, metrics.New(testLogger(t)), store.NewMemSessionStore(), &StubStor{}, bl)
+
+	setHandle := func(token, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(http.MethodPost, "/c/session/handle", strings.NewReader(body))
+		req.Header.Set(SessionHeader, token)
+		resp := httptest.NewRecorder()
+		sessions.HandleHandler().ServeHTTP(resp, req)
+		return resp
+	}
+
+	alice := newTestSession(t, sessions)
+	resp := setHandle(alice, `{"handle":"alice"}`)
+	assert.Equal(t, 200, resp.Code)
+	assert.Equal(t, `{"handle":"alice"}`, resp.Body.String())
+
+	tests := []struct {
+		body   string
+		status int
+		code   string
+	}{
+		{`{"handle":"Alice"}`, http.StatusConflict, "handle_taken"},
+		{`{"handle":"a"}`, http.StatusBadRequest, "invalid_handle"},
+		{`{"handle":"has space"}`, http.StatusBadRequest, "invalid_handle"},
+		{`{"handle":"xBadWordx"}`, http.StatusBadRequest, "invalid_handle"},
+		{`{"name":"bob"}`, http.StatusBadRequest, "invalid_request"},
+	}
+
+	bob := newTestSession(t, sessions)
+	for _, tt := range tests {
+		resp := setHandle(bob, tt.body)
+		assert.Equal(t, tt.status, resp.Code, tt.body)
+		assert.Contains(t, resp.Body.String(), `"code":"`+tt.code+`"`, tt.body)
+	}
+}
+
+func TestSessionPrune(t *testing.T) {
+	m := metrics.New(testLogger(t))
+	sessionStore := store.NewMemSessionStore()
+	sessions := NewSessions(testLogger(t), cfg, m, sessionStore, &StubStor{}, nil)
+
+	require.NoError(t, sessionStore.CreateSession("idle", time.Now().Add(-cfg.SessionRetention-time.Hour)))
+	require.NoError(t, sessionStore.CreateSession("recent", time.Now()))
+
+	before := testutil.ToFloat64(m.SessionsPruned)
+	sessions.prune()
+	assert.Equal(t, before+1, testutil.ToFloat64(m.SessionsPruned))
+
+	assert.ErrorIs(t, sessionStore.TouchSession("idle", time.Now()), store.ErrSessionNotFound)
+	assert.NoError(t, sessionStore.TouchSession("recent", time.Now()))
+}
@@ -1,24 +1,39 @@
 package challenge
 
 import (
+	"crypto/sha256"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
+	"net/url"
 	"strconv"
 
-	"github.com/didip/tollbooth/v7"
 	"gitlab.com/jarv/cmdchallenge/internal/config"
 	"gitlab.com/jarv/cmdchallenge/internal/metrics"
 	"gitlab.com/jarv/cmdchallenge/internal/store"
 )
 
 const (
-	maxSolutionsRequestsSec = 2
+	defaultSolutionsLimit = 50
+	maxSolutionsLimit     = 100
+
+	// Store queries for a page when commands are skipped by the blocklist
+	maxSolutionsFetches = 5
 )
 
+type jsonSolution struct {
+	Cmd    string `json:"cmd"`
+	Count  int    `json:"count"`
+	Length int    `json:"length"`
+}
+
 type jsonCmds struct {
-	Cmds []string `json:"cmds"`
+	Cmds       []string       `json:"cmds"`
+	Solutions  []jsonSolution `json:"solutions"`
+	NextCursor string         `json:"next_cursor,omitempty"`
 }
 
 type Solutions struct {
@@ -26,38 +41,35 @@ type Solutions struct {
 	cfg       *config.Config
 	metrics   *metrics.Metrics
 	cmdStorer store.CmdStorer
-	rateLimit bool
+	blocklist *Blocklist
+	events    *Events
 }
 
-func NewSolutions(log *slog.Logger, cfg *config.Config, m *metrics.Metrics, s store.CmdStorer) *Solutions {
+func NewSolutions(
+	log *slog.Logger,
+	cfg *config.Config,
+	m *metrics.Metrics,
+	s store.CmdStorer,
+	bl *Blocklist,
+	events *Events,
+) *Solutions {
 	return &Solutions{
 		log:       log,
 		cfg:       cfg,
 		metrics:   m,
 		cmdStorer: s,
-		rateLimit: cfg.RateLimit,
+		blocklist: bl,
+		events:    events,
 	}
 }
 
-func (s *Solutions) httpError(w http.ResponseWriter, e error, statusCode int) {
-	s.metrics.CmdErrors.WithLabelValues(e.Error()).Inc()
-	http.Error(w, e.Error(), statusCode)
+func (s *Solutions) httpError(w http.ResponseWriter, e error) {
+	s.metrics.CmdErrors.WithLabelValues(errorLabel(e), TypeServer).Inc()
+	writeError(w, e)
 }
 
 func (s *Solutions) Handler() http.Handler {
-	if s.rateLimit {
-		lmt := tollbooth.NewLimiter(float64(maxSolutionsRequestsSec), nil)
-		s.log.Info("Setting rate limit for solutions req/sec", "maxRequestsSec", maxSolutionsRequestsSec)
-		lmt.SetIPLookups([]string{"RemoteAddr"})
-		lmt.SetMessage("Your are sending requests too fast, slow down!")
-		lmt.SetOnLimitReached(func(w http.ResponseWriter, r *http.Request) {
-			s.log.Info("Rate limit reached", "RemoteAddr", r.RemoteAddr, "RequestURI", r.RequestURI)
-			s.metrics.ResponseStatus.WithLabelValues(strconv.Itoa(lmt.GetStatusCode()), r.RequestURI).Inc()
-		})
-		return tollbooth.LimitHandler(lmt, http.HandlerFunc(s.runHandler))
-	} else {
-		return http.HandlerFunc(s.runHandler)
-	}
+	return http.HandlerFunc(s.runHandler)
 }
 
 func (s *Solutions) runHandler(w http.ResponseWriter, req *http.Request) {
@@ -69,26 +81,144 @@ func (s *Solutions) runHandler(w http.ResponseWriter, req *http.Request) {
 
 	if req.Method != http.MethodGet {
 		s.log.Error("expected GET", "method", req.Method)
-		s.httpError(w, ErrSolutionsInvalidMethod, http.StatusMethodNotAllowed)
+		s.httpError(w, ErrSolutionsInvalidMethod)
 		return
 	}
 
-	slugs, ok := req.URL.Query()["slug"]
-	if !ok || len(slugs[0]) < 1 {
-		s.log.Error("Url Param 'slug' is missing")
-		s.httpError(w, ErrSolutionsInvalidParam, http.StatusInternalServerError)
+	q, err := parseCmdsQuery(req.URL.Query())
+	if err != nil {
+		s.log.Error("Invalid solutions query", "query", req.URL.RawQuery, "err", err)
+		s.httpError(w, ErrSolutionsInvalidParam)
 		return
 	}
 
-	cmds, err := s.cmdStorer.TopCmdsForSlug(slugs[0])
+	if s.events.inRunningEvent(q.Slug) {
+		s.log.Info("Solutions hidden during an event", "slug", q.Slug)
+		w.Header().Set("Cache-Control", "no-store")
+		s.httpError(w, ErrSolutionsEventRunning)
+		return
+	}
+
+	solutions, next, err := s.topCmds(q)
 	if err != nil {
-		s.log.Error("Unable to query top commands", "slug", slugs[0], "err", err)
-		s.httpError(w, ErrSolutionsStore, http.StatusInternalServerError)
+		s.log.Error("Unable to query top commands", "slug", q.Slug, "err", err)
+		s.httpError(w, ErrSolutionsStore)
+		return
+	}
+
+	resp := jsonCmds{
+		Cmds:      make([]string, 0, len(solutions)),
+		Solutions: make([]jsonSolution, 0, len(solutions)),
+	}
+	if next > 0 {
+		resp.NextCursor = encodeCursor(next)
+	}
+
+	for _, sol := range solutions {
+		resp.Cmds = append(resp.Cmds, sol.Cmd)
+		resp.Solutions = append(resp.Solutions, jsonSolution{Cmd: sol.Cmd, Count: sol.Count, Length: sol.Length})
+	}
+
+	b, _ := json.Marshal(&resp)
+
+	etag := fmt.Sprintf(`"%x"`, sha256.Sum256(b))
+	w.Header().Set("ETag", etag)
+	if match := req.Header.Get("If-None-Match"); match != "" && match == etag {
+		w.WriteHeader(http.StatusNotModified)
 		return
 	}
 
-	b, _ := json.Marshal(&jsonCmds{
-		Cmds: cmds,
-	})
 	fmt.Fprint(w, string(b))
 }
+
+// topCmds returns a page of up to q.Limit commands that don't match the
+// blocklist and the offset of the next page, or 0 for the last page. Blocked
+// commands are skipped by fetching more from the store so that only the last
+// page is short.
+func (s *Solutions) topCmds(q store.CmdsQuery) ([]store.Solution, int, error) {
+	limit := q.Limit
+	solutions := make([]store.Solution, 0, limit)
+
+	// Fetch one extra result to find out whether there is another page
+	q.Limit++
+	for fetches := 0; fetches < maxSolutionsFetches; fetches++ {
+		batch, err := s.cmdStorer.TopCmdsForSlug(q)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		for i, sol := range batch {
+			if s.blocklist.Matches(sol.Cmd) {
+				continue
+			}
+			if len(solutions) == limit {
+				return solutions, q.Offset + i, nil
+			}
+			solutions = append(solutions, sol)
+		}
+
+		if len(batch) < q.Limit {
+			return solutions, 0, nil
+		}
+		q.Offset += len(batch)
+	}
+
+	// Mostly blocked commands, the next page starts after what was read
+	return solutions, q.Offset, nil
+}
+
+func parseCmdsQuery(v url.Values) (store.CmdsQuery, error) {
+	q := store.CmdsQuery{
+		Slug:  v.Get("slug"),
+		Sort:  store.SortPopular,
+		Limit: defaultSolutionsLimit,
+	}
+
+	if !slugRe.MatchString(q.Slug) {
+		return q, errors.New("slug is missing or invalid")
+	}
+
+	if sort := v.Get("sort"); sort != "" {
+		switch store.CmdsSort(sort) {
+		case store.SortPopular, store.SortShortest, store.SortNewest:
+			q.Sort = store.CmdsSort(sort)
+		default:
+			return q, fmt.Errorf("unknown sort %q", sort)
+		}
+	}
+
+	if limit := v.Get("limit"); limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil || l < 1 || l > maxSolutionsLimit {
+			return q, fmt.Errorf("limit must be between 1 and %d", maxSolutionsLimit)
+		}
+		q.Limit = l
+	}
+
+	if cursor := v.Get("cursor"); cursor != "" {
+		offset, err := decodeCursor(cursor)
+		if err != nil {
+			return q, err
+		}
+		q.Offset = offset
+	}
+
+	return q, nil
+}
+
+// Cursors are opaque to clients, they encode the offset of the next page.
+func encodeCursor(offset int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(offset)))
+}
+
+func decodeCursor(cursor string) (int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, errors.New("invalid cursor")
+	}
+	offset, err := strconv.Atoi(string(b))
+	if err != nil || offset < 0 {
+		return 0, errors.New("invalid cursor")
+	}
+	return offset, nil
+}
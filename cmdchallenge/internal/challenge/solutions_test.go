@@ -0,0 +1,131 @@
+package challenge
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gitlab.com/jarv/cmdchallenge/internal/metrics"
+	"gitlab.com/jarv/cmdchallenge/internal/store"
+)
+
+var fakeSolutions = []store.Solution{
+	{Cmd: "echo hello world", Count: 10, Length: 16},
+	{Cmd: "echo 'hello world'", Count: 4, Length: 18},
+	{Cmd: "echo badword; echo hello world", Count: 2, Length: 30},
+}
+
+func TestSolutions(t *testing.T) {
+	stubStore := &StubStor{}
+	stubStore.On("TopCmdsForSlug", store.CmdsQuery{
+		Slug:  "hello_world",
+		Sort:  store.SortPopular,
+		Limit: defaultSolutionsLimit + 1,
+	}).Return(fakeSolutions, nil).Once()
+
+	bl, err := NewBlocklist([]string{"badword"})
+	require.NoError(t, err)
+
+	req, resp := createSolutionsRequest("slug=hello_world")
+	NewSolutions(testLogger(t), cfg, metrics.New(testLogger(t)), stubStore, bl, nil).runHandler(resp, req)
+
+	stubStore.AssertExpectations(t)
+	expectedResp := `{"cmds":["echo hello world","echo 'hello world'"],` +
+		`"solutions":[{"cmd":"echo hello world","count":10,"length":16},{"cmd":"echo 'hello world'","count":4,"length":18}]}`
+	assert.Equal(t, expectedResp, resp.Body.String())
+	assert.Equal(t, 200, resp.Code)
+	assert.NotEmpty(t, resp.Header().Get("ETag"))
+}
+
+func TestSolutionsPagination(t *testing.T) {
+	stubStore := &StubStor{}
+	stubStore.On("TopCmdsForSlug", store.CmdsQuery{
+		Slug:   "hello_world",
+		Sort:   store.SortShortest,
+		Limit:  2,
+		Offset: 2,
+	}).Return(fakeSolutions[:2], nil).Once()
+
+	req, resp := createSolutionsRequest("slug=hello_world&sort=shortest&limit=1&cursor=" + encodeCursor(2))
+	NewSolutions(testLogger(t), cfg, metrics.New(testLogger(t)), stubStore, nil, nil).runHandler(resp, req)
+
+	stubStore.AssertExpectations(t)
+	expectedResp := `{"cmds":["echo hello world"],"solutions":[{"cmd":"echo hello world","count":10,"length":16}],` +
+		`"next_cursor":"` + encodeCursor(3) + `"}`
+	assert.Equal(t, expectedResp, resp.Body.String())
+}
+
+func TestSolutionsBlockedPage(t *testing.T) {
+	stubStore := &StubStor{}
+	stubStore.On("TopCmdsForSlug", store.CmdsQuery{Slug: "hello_world", Sort: store.SortPopular, Limit: 3}).
+		Return([]store.Solution{fakeSolutions[1], fakeSolutions[2], {Cmd: "echo hello  world", Count: 1, Length: 17}}, nil).Once()
+	stubStore.On("TopCmdsForSlug", store.CmdsQuery{Slug: "hello_world", Sort: store.SortPopular, Limit: 3, Offset: 3}).
+		Return([]store.Solution{{Cmd: "pwd", Count: 1, Length: 3}}, nil).Once()
+
+	bl, err := NewBlocklist([]string{"badword"})
+	require.NoError(t, err)
+
+	// The blocked command in the middle of the page doesn't make it short,
+	// more commands are fetched to find out whether there is another page
+	req, resp := createSolutionsRequest("slug=hello_world&limit=2")
+	NewSolutions(testLogger(t), cfg, metrics.New(testLogger(t)), stubStore, bl, nil).runHandler(resp, req)
+
+	stubStore.AssertExpectations(t)
+	expectedResp := `{"cmds":["echo 'hello world'","echo hello  world"],` +
+		`"solutions":[{"cmd":"echo 'hello world'","count":4,"length":18},{"cmd":"echo hello  world","count":1,"length":17}],` +
+		`"next_cursor":"` + encodeCursor(3) + `"}`
+	assert.Equal(t, expectedResp, resp.Body.String())
+}
+
+func TestSolutionsNotModified(t *testing.T) {
+	stubStore := &StubStor{}
+	stubStore.On("TopCmdsForSlug", store.CmdsQuery{
+		Slug:  "hello_world",
+		Sort:  store.SortPopular,
+		Limit: defaultSolutionsLimit + 1,
+	}).Return(fakeSolutions, nil).Twice()
+
+	s := NewSolutions(testLogger(t), cfg, metrics.New(testLogger(t)), stubStore, nil, nil)
+
+	req, resp := createSolutionsRequest("slug=hello_world")
+	s.runHandler(resp, req)
+	etag := resp.Header().Get("ETag")
+
+	req, resp = createSolutionsRequest("slug=hello_world")
+	req.Header.Set("If-None-Match", etag)
+	s.runHandler(resp, req)
+
+	stubStore.AssertExpectations(t)
+	assert.Equal(t, http.StatusNotModified, resp.Code)
+	assert.Empty(t, resp.Body.String())
+}
+
+func TestSolutionsInvalidParams(t *testing.T) {
+	for _, query := range []string{
+		"",
+		"slug=../etc",
+		"slug=hello_world&sort=random",
+		"slug=hello_world&limit=0",
+		"slug=hello_world&limit=1000",
+		"slug=hello_world&cursor=nope",
+	} {
+		query := query
+		t.Run(query, func(t *testing.T) {
+			stubStore := &StubStor{}
+			req, resp := createSolutionsRequest(query)
+			NewSolutions(testLogger(t), cfg, metrics.New(testLogger(t)), stubStore, nil, nil).runHandler(resp, req)
+
+			stubStore.AssertExpectations(t)
+			assert.Equal(t, http.StatusBadRequest, resp.Code)
+		})
+	}
+}
+
+func createSolutionsRequest(query string) (*http.Request, *httptest.ResponseRecorder) {
+	req, _ := http.NewRequest(http.MethodGet, "/c/s?"+query, http.NoBody)
+	req.RemoteAddr = "1.1.1.1:80"
+
+	return req, httptest.NewRecorder()
+}
@@ -0,0 +1,115 @@
+package challenge
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"regexp"
+
+	"github.com/gorilla/mux"
+	"gitlab.com/jarv/cmdchallenge/internal/config"
+	"gitlab.com/jarv/cmdchallenge/internal/metrics"
+	"gitlab.com/jarv/cmdchallenge/internal/store"
+)
+
+var slugRe = regexp.MustCompile(`^\w+$`)
+
+type jsonErrorCount struct {
+	Error string `json:"error"`
+	Count int    `json:"count"`
+}
+
+type jsonStats struct {
+	Slug            string           `json:"slug"`
+	Version         int              `json:"version"`
+	Attempts        int              `json:"attempts"`
+	UniqueCmds      int              `json:"unique_cmds"`
+	CorrectRate     float64          `json:"correct_rate"`
+	MedianCmdLength int              `json:"median_cmd_length"`
+	TopErrors       []jsonErrorCount `json:"top_errors"`
+}
+
+type Stats struct {
+	log       *slog.Logger
+	cfg       *config.Config
+	metrics   *metrics.Metrics
+	cmdStorer store.CmdStorer
+	events    *Events
+}
+
+func NewStats(log *slog.Logger, cfg *config.Config, m *metrics.Metrics, s store.CmdStorer, events *Events) *Stats {
+	return &Stats{
+		log:       log,
+		cfg:       cfg,
+		metrics:   m,
+		cmdStorer: s,
+		events:    events,
+	}
+}
+
+func (s *Stats) httpError(w http.ResponseWriter, e error) {
+	s.metrics.CmdErrors.WithLabelValues(errorLabel(e), TypeServer).Inc()
+	writeError(w, e)
+}
+
+func (s *Stats) Handler() http.Handler {
+	return http.HandlerFunc(s.runHandler)
+}
+
+func (s *Stats) runHandler(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Cache-Control", "public, max-age=300, s-maxage=300")
+
+	s.log.Info("Stats request received", "URI", req.RequestURI, "Addr", req.RemoteAddr)
+
+	if req.Method != http.MethodGet {
+		s.log.Error("expected GET", "method", req.Method)
+		s.httpError(w, ErrStatsInvalidMethod)
+		return
+	}
+
+	slug := mux.Vars(req)["slug"]
+	if !slugRe.MatchString(slug) {
+		s.log.Error("Invalid slug for stats", "slug", slug)
+		s.httpError(w, ErrStatsInvalidParam)
+		return
+	}
+
+	ch, err := NewChallenge(ChallengeOptions{Slug: slug})
+	if err != nil {
+		s.log.Error("Unknown challenge for stats", "slug", slug)
+		s.httpError(w, ErrStatsNotFound)
+		return
+	}
+
+	if s.events.inRunningEvent(ch.Slug()) {
+		s.log.Info("Stats hidden during an event", "slug", slug)
+		w.Header().Set("Cache-Control", "no-store")
+		s.httpError(w, ErrStatsEventRunning)
+		return
+	}
+
+	stats, err := s.cmdStorer.StatsForSlug(ch.Slug(), ch.Version())
+	if err != nil {
+		s.log.Error("Unable to query stats", "slug", slug, "err", err)
+		s.httpError(w, ErrStatsStore)
+		return
+	}
+
+	resp := jsonStats{
+		Slug:            stats.Slug,
+		Version:         stats.Version,
+		Attempts:        stats.Attempts,
+		UniqueCmds:      stats.UniqueCmds,
+		CorrectRate:     stats.CorrectRate,
+		MedianCmdLength: stats.MedianCmdLength,
+		TopErrors:       make([]jsonErrorCount, 0, len(stats.TopErrors)),
+	}
+	for _, e := range stats.TopErrors {
+		resp.TopErrors = append(resp.TopErrors, jsonErrorCount{Error: e.Error, Count: e.Count})
+	}
+
+	b, _ := json.Marshal(&resp)
+	fmt.Fprint(w, string(b))
+}
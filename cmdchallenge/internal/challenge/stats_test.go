@@ -0,0 +1,75 @@
+package challenge
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/jarv/cmdchallenge/internal/metrics"
+	"gitlab.com/jarv/cmdchallenge/internal/store"
+)
+
+func TestStats(t *testing.T) {
+	stubStore := &StubStor{}
+	stubStore.On("StatsForSlug", "hello_world", 5).Return(&store.SlugStats{
+		Slug:            "hello_world",
+		Version:         5,
+		Attempts:        4,
+		UniqueCmds:      2,
+		CorrectRate:     0.75,
+		MedianCmdLength: 16,
+		TopErrors:       []store.ErrorCount{{Error: "Output does not match expected lines", Count: 1}},
+	}, nil).Once()
+
+	req, resp := createStatsRequest("hello_world")
+	NewStats(testLogger(t), cfg, metrics.New(testLogger(t)), stubStore, nil).runHandler(resp, req)
+
+	stubStore.AssertExpectations(t)
+	expectedResp := `{"slug":"hello_world","version":5,"attempts":4,"unique_cmds":2,"correct_rate":0.75,` +
+		`"median_cmd_length":16,"top_errors":[{"error":"Output does not match expected lines","count":1}]}`
+	assert.Equal(t, expectedResp, resp.Body.String())
+	assert.Equal(t, 200, resp.Code)
+}
+
+func TestStatsInvalidSlug(t *testing.T) {
+	stubStore := &StubStor{}
+
+	req, resp := createStatsRequest("../etc")
+	NewStats(testLogger(t), cfg, metrics.New(testLogger(t)), stubStore, nil).runHandler(resp, req)
+
+	stubStore.AssertExpectations(t)
+	assert.Equal(t, 400, resp.Code)
+}
+
+func TestStatsUnknownSlug(t *testing.T) {
+	stubStore := &StubStor{}
+
+	req, resp := createStatsRequest("does_not_exist")
+	NewStats(testLogger(t), cfg, metrics.New(testLogger(t)), stubStore, nil).runHandler(resp, req)
+
+	stubStore.AssertExpectations(t)
+	assert.Equal(t, 404, resp.Code)
+	assert.Contains(t, resp.Body.String(), `"code":"not_found"`)
+}
+
+func TestStatsStoreError(t *testing.T) {
+	stubStore := &StubStor{}
+	stubStore.On("StatsForSlug", "hello_world", 5).Return(nil, errors.New("db gone")).Once()
+
+	req, resp := createStatsRequest("hello_world")
+	NewStats(testLogger(t), cfg, metrics.New(testLogger(t)), stubStore, nil).runHandler(resp, req)
+
+	stubStore.AssertExpectations(t)
+	assert.Equal(t, 500, resp.Code)
+}
+
+func createStatsRequest(slug string) (*http.Request, *httptest.ResponseRecorder) {
+	req, _ := http.NewRequest(http.MethodGet, "/c/stats/"+slug, http.NoBody)
+	req = mux.SetURLVars(req, map[string]string{"slug": slug})
+	req.RemoteAddr = "1.1.1.1:80"
+
+	return req, httptest.NewRecorder()
+}
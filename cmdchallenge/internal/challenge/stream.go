@@ -0,0 +1,184 @@
+package challenge
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"unicode/utf8"
+)
+
+type jsonStreamOutput struct {
+	Output string `json:"output"`
+}
+
+type jsonStreamTruncated struct {
+	Limit int `json:"limit"`
+}
+
+// sseWriter sends everything written to it as "output" events, it is passed
+// to the runner so output is relayed while the command runs. Output past
+// MaxOutputLength bytes is dropped after a single "truncated" event.
+type sseWriter struct {
+	mu        sync.Mutex
+	w         http.ResponseWriter
+	rc        *http.ResponseController
+	partial   []byte
+	sent      int
+	truncated bool
+}
+
+func newSSEWriter(w http.ResponseWriter) *sseWriter {
+	return &sseWriter{w: w, rc: http.NewResponseController(w)}
+}
+
+func (s *sseWriter) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.truncated {
+		return len(p), nil
+	}
+
+	buf := append(s.partial, p...)
+
+	// Hold back a multi-byte character that is split across writes until
+	// the rest of it arrives
+	n := len(buf)
+	for i := len(buf) - 1; i >= 0 && i >= len(buf)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(buf[i]) {
+			if !utf8.FullRune(buf[i:]) {
+				n = i
+			}
+			break
+		}
+	}
+	s.partial = append([]byte(nil), buf[n:]...)
+
+	if n == 0 {
+		return len(p), nil
+	}
+
+	out := buf[:n]
+	if remaining := MaxOutputLength - s.sent; len(out) > remaining {
+		// Cut before the character that doesn't fit
+		for remaining > 0 && !utf8.RuneStart(out[remaining]) {
+			remaining--
+		}
+		out = out[:remaining]
+		s.truncated = true
+		s.partial = nil
+	}
+
+	if len(out) > 0 {
+		b, err := json.Marshal(&jsonStreamOutput{Output: string(out)})
+		if err != nil {
+			return 0, err
+		}
+		if err := s.event("output", b); err != nil {
+			return 0, err
+		}
+		s.sent += len(out)
+	}
+
+	if s.truncated {
+		b, err := json.Marshal(&jsonStreamTruncated{Limit: MaxOutputLength})
+		if err != nil {
+			return 0, err
+		}
+		if err := s.event("truncated", b); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(p), nil
+}
+
+func (s *sseWriter) send(name string, v any) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.event(name, b)
+}
+
+func (s *sseWriter) event(name string, data []byte) error {
+	if _, err := fmt.Fprintf(s.w, "event: %s\ndata: %s\n\n", name, data); err != nil {
+		return err
+	}
+	return s.rc.Flush()
+}
+
+func (c *Server) streamHandler(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Cache-Control", "no-store, max-age=0")
+
+	c.log.Info("Stream request received",
+		"URI", req.RequestURI,
+		"Addr", req.RemoteAddr,
+	)
+
+	var slug, cmd string
+	var err error
+
+	switch req.Method {
+	case http.MethodGet:
+		// EventSource can only send GET requests
+		q := req.URL.Query()
+		cmdReq := CmdRequest{Slug: q.Get("slug"), Cmd: q.Get("cmd"), Encoding: q.Get("encoding")}
+		slug = cmdReq.Slug
+		cmd, err = cmdReq.decodedCmd()
+	case http.MethodPost:
+		slug, cmd, err = parseCmdRequest(w, req)
+	default:
+		c.log.Error("expect GET or POST", "method", req.Method)
+		err = ErrServerInvalidMethod
+	}
+	if err != nil {
+		c.httpError(w, err)
+		return
+	}
+
+	if err := c.abuse.Check(remoteIP(req)); err != nil {
+		c.log.Info("Rejecting command from banned client", "Addr", req.RemoteAddr)
+		c.httpError(w, err)
+		return
+	}
+
+	p, err := c.player(req, slug)
+	if err != nil {
+		c.httpError(w, err)
+		return
+	}
+
+	ch, err := c.challengeForCmd(slug, cmd, req.RemoteAddr)
+	if err != nil {
+		c.httpError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	sse := newSSEWriter(w)
+
+	// Once the stream has started the status can't change, errors are sent
+	// as an event instead
+	resp, err := c.runCmd(cmd, ch, sse)
+	c.abuse.Record(remoteIP(req), resp, err)
+	if err != nil {
+		c.countError(err)
+		code, _ := codeForError(err)
+		err = sse.send("error", &jsonErrorBody{Code: code, Message: err.Error()})
+	} else {
+		c.recordProgress(p, ch, cmd, resp)
+		err = sse.send("result", resp)
+	}
+	if err != nil {
+		c.log.Info("Unable to finish stream", "err", err)
+	}
+}
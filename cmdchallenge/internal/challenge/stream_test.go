@@ -0,0 +1,154 @@
+package challenge
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gitlab.com/jarv/cmdchallenge/internal/metrics"
+	"gitlab.com/jarv/cmdchallenge/internal/store"
+)
+
+func TestStream(t *testing.T) {
+	stubStore := &StubStor{}
+	stubStore.On(
+		"GetResult",
+		"echo hello world",
+		"hello_world",
+		5,
+	).Return(nil, store.ErrResultNotFound).Once()
+
+	stubStore.On("CreateResult", &fakeStore).Return(nil).Once()
+
+	stubStore.On(
+		"IncrementResult",
+		"echo hello world",
+		"hello_world",
+		5,
+	).Return(nil).Once()
+
+	stubRunnerExecutor := &StubRunnerExecutor{}
+	stubRunnerExecutor.On(
+		"RunContainerStream",
+		"echo hello world",
+		helloWorldCh(t),
+	).Return(&fakeResponse, nil).Once()
+
+	req, resp := createStreamRequest("hello_world", "echo hello world")
+	s := NewServer(testLogger(t), cfg, metrics.New(testLogger(t)), stubRunnerExecutor, stubStore, ServerOptions{})
+	s.streamHandler(resp, req)
+
+	stubStore.AssertExpectations(t)
+	stubRunnerExecutor.AssertExpectations(t)
+
+	expectedResp := "event: output\ndata: {\"output\":\"hello world\"}\n\n" +
+		"event: result\ndata: {\"Cached\":false,\"Correct\":true,\"ExitCode\":0,\"Output\":\"hello world\"}\n\n"
+	assert.Equal(t, expectedResp, resp.Body.String())
+	assert.Equal(t, "text/event-stream", resp.Header().Get("Content-Type"))
+	assert.Equal(t, 200, resp.Code)
+}
+
+func TestStreamCached(t *testing.T) {
+	stubStore := &StubStor{}
+	stubStore.On(
+		"GetResult",
+		"echo hello world",
+		"hello_world",
+		5,
+	).Return(&fakeStore, nil).Once()
+
+	stubStore.On(
+		"IncrementResult",
+		"echo hello world",
+		"hello_world",
+		5,
+	).Return(nil).Once()
+
+	req, resp := createStreamRequest("hello_world", "echo hello world")
+	s := NewServer(testLogger(t), cfg, metrics.New(testLogger(t)), &StubRunnerExecutor{}, stubStore, ServerOptions{})
+	s.streamHandler(resp, req)
+
+	stubStore.AssertExpectations(t)
+
+	expectedResp := "event: result\ndata: {\"Cached\":true,\"Correct\":true,\"ExitCode\":0,\"Output\":\"hello world\"}\n\n"
+	assert.Equal(t, expectedResp, resp.Body.String())
+}
+
+func TestStreamRunnerTimeout(t *testing.T) {
+	stubStore := &StubStor{}
+	stubStore.On(
+		"GetResult",
+		"echo hello world",
+		"hello_world",
+		5,
+	).Return(nil, store.ErrResultNotFound).Once()
+
+	stubRunnerExecutor := &StubRunnerExecutor{}
+	stubRunnerExecutor.On(
+		"RunContainerStream",
+		"echo hello world",
+		helloWorldCh(t),
+	).Return((*CmdResponse)(nil), ErrRunnerTimeout).Once()
+
+	req, resp := createStreamRequest("hello_world", "echo hello world")
+	s := NewServer(testLogger(t), cfg, metrics.New(testLogger(t)), stubRunnerExecutor, stubStore, ServerOptions{})
+	s.streamHandler(resp, req)
+
+	expectedResp := "event: error\ndata: {\"code\":\"runner_timeout\",\"message\":\"timed out executing command\"}\n\n"
+	assert.Equal(t, expectedResp, resp.Body.String())
+	assert.Equal(t, 200, resp.Code)
+}
+
+func TestStreamInvalid(t *testing.T) {
+	req, resp := createStreamRequest("does_not_exist", "ls")
+	s := NewServer(testLogger(t), cfg, metrics.New(testLogger(t)), &StubRunnerExecutor{}, &StubStor{}, ServerOptions{})
+	s.streamHandler(resp, req)
+
+	assert.Equal(t, 400, resp.Code)
+	assert.Contains(t, resp.Body.String(), `"code":"invalid_challenge"`)
+}
+
+func TestSSEWriterSplitRune(t *testing.T) {
+	resp := httptest.NewRecorder()
+	sse := newSSEWriter(resp)
+
+	b := []byte("héllo")
+	_, _ = sse.Write(b[:2])
+	_, _ = sse.Write(b[2:])
+
+	expectedResp := "event: output\ndata: {\"output\":\"h\"}\n\n" +
+		"event: output\ndata: {\"output\":\"éllo\"}\n\n"
+	assert.Equal(t, expectedResp, resp.Body.String())
+}
+
+func TestSSEWriterTruncated(t *testing.T) {
+	resp := httptest.NewRecorder()
+	sse := newSSEWriter(resp)
+
+	_, _ = sse.Write([]byte(strings.Repeat("y", MaxOutputLength-1)))
+	n, err := sse.Write([]byte("éé"))
+	require.NoError(t, err)
+	assert.Equal(t, 4, n)
+	_, _ = sse.Write([]byte("more"))
+
+	// The character that doesn't fit isn't split, nothing is sent after
+	// the truncated event
+	events := strings.Split(strings.TrimSuffix(resp.Body.String(), "\n\n"), "\n\n")
+	require.Len(t, events, 2)
+	assert.Equal(t, `event: truncated`+"\n"+`data: {"limit":65536}`, events[1])
+	assert.Equal(t, `event: output`+"\n"+`data: {"output":"`+strings.Repeat("y", MaxOutputLength-1)+`"}`, events[0])
+}
+
+func createStreamRequest(slug, cmd string) (*http.Request, *httptest.ResponseRecorder) {
+	q := url.Values{}
+	q.Set("slug", slug)
+	q.Set("cmd", cmd)
+	req, _ := http.NewRequest(http.MethodGet, "/c/stream?"+q.Encode(), http.NoBody)
+	req.RemoteAddr = "1.1.1.1:80"
+
+	return req, httptest.NewRecorder()
+}
@@ -0,0 +1,101 @@
+package challenge
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"log/slog"
+	"time"
+
+	"gitlab.com/jarv/cmdchallenge/internal/config"
+	"gitlab.com/jarv/cmdchallenge/internal/metrics"
+	"gitlab.com/jarv/cmdchallenge/internal/store"
+)
+
+// submissionLog writes submissions to the store in the background so that
+// recording an attempt never delays the response to the user. It also
+// prunes entries older than the configured retention.
+type submissionLog struct {
+	log       *slog.Logger
+	cfg       *config.Config
+	metrics   *metrics.Metrics
+	cmdStorer store.CmdStorer
+	queue     chan *store.Submission
+	done      chan struct{}
+	stopped   chan struct{}
+}
+
+func newSubmissionLog(log *slog.Logger, cfg *config.Config, m *metrics.Metrics, s store.CmdStorer) *submissionLog {
+	l := &submissionLog{
+		log:       log,
+		cfg:       cfg,
+		metrics:   m,
+		cmdStorer: s,
+		queue:     make(chan *store.Submission, cfg.SubmissionQueueSize),
+		done:      make(chan struct{}),
+		stopped:   make(chan struct{}),
+	}
+	go l.run()
+	return l
+}
+
+// record queues a submission, dropping it if the writer has fallen behind.
+func (l *submissionLog) record(s *store.Submission) {
+	select {
+	case l.queue <- s:
+	default:
+		l.metrics.SubmissionsDropped.Inc()
+	}
+}
+
+// close stops the writer after the queued submissions are written.
+func (l *submissionLog) close() {
+	close(l.done)
+	<-l.stopped
+}
+
+func (l *submissionLog) run() {
+	defer close(l.stopped)
+
+	ticker := time.NewTicker(l.cfg.SubmissionPruneInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case s := <-l.queue:
+			l.write(s)
+		case <-ticker.C:
+			l.prune()
+		case <-l.done:
+			for {
+				select {
+				case s := <-l.queue:
+					l.write(s)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (l *submissionLog) write(s *store.Submission) {
+	if err := l.cmdStorer.CreateSubmission(s); err != nil {
+		l.log.Error("Unable to log submission", "slug", s.Slug, "err", err)
+	}
+}
+
+func (l *submissionLog) prune() {
+	before := time.Now().Add(-l.cfg.SubmissionRetention)
+	pruned, err := l.cmdStorer.PruneSubmissions(before)
+	if err != nil {
+		l.log.Error("Unable to prune submissions", "err", err)
+		return
+	}
+	l.log.Info("Pruned submissions", "count", pruned, "before", before)
+	l.metrics.SubmissionsPruned.Add(float64(pruned))
+}
+
+func cmdHash(cmd string) string {
+	sum := sha256.Sum256([]byte(cmd))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,62 @@
+package challenge
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gitlab.com/jarv/cmdchallenge/internal/metrics"
+	"gitlab.com/jarv/cmdchallenge/internal/store"
+)
+
+func TestSubmissionLogClose(t *testing.T) {
+	s, err := store.NewMemStore()
+	require.NoError(t, err)
+
+	l := newSubmissionLog(testLogger(t), cfg, metrics.New(testLogger(t)), s)
+	for i := 0; i < 10; i++ {
+		l.record(&store.Submission{Slug: "hello_world", Version: 5, CreateTime: time.Now()})
+	}
+	l.close()
+
+	// Everything queued before close is written
+	n, err := s.PruneSubmissions(time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), n)
+}
+
+func TestSubmissionLogOverflow(t *testing.T) {
+	m := metrics.New(testLogger(t))
+	dropped := testutil.ToFloat64(m.SubmissionsDropped)
+
+	// Without a writer running the queue fills up
+	l := &submissionLog{log: testLogger(t), cfg: cfg, metrics: m, queue: make(chan *store.Submission, 2)}
+	for i := 0; i < 5; i++ {
+		l.record(&store.Submission{Slug: "hello_world", Version: 5, CreateTime: time.Now()})
+	}
+
+	assert.Len(t, l.queue, 2)
+	assert.Equal(t, dropped+3, testutil.ToFloat64(m.SubmissionsDropped))
+}
+
+func TestSubmissionLogPrune(t *testing.T) {
+	s, err := store.NewMemStore()
+	require.NoError(t, err)
+	m := metrics.New(testLogger(t))
+	pruned := testutil.ToFloat64(m.SubmissionsPruned)
+
+	now := time.Now()
+	require.NoError(t, s.CreateSubmission(&store.Submission{Slug: "hello_world", CreateTime: now.Add(-cfg.SubmissionRetention - time.Hour)}))
+	require.NoError(t, s.CreateSubmission(&store.Submission{Slug: "hello_world", CreateTime: now}))
+
+	l := &submissionLog{log: testLogger(t), cfg: cfg, metrics: m, cmdStorer: s}
+	l.prune()
+	assert.Equal(t, pruned+1, testutil.ToFloat64(m.SubmissionsPruned))
+
+	// Only the submission within the retention is left
+	n, err := s.PruneSubmissions(now.Add(time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+}
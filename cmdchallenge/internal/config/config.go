@@ -9,6 +9,37 @@ import (
 
 const oopsBin = "oops-this-will-delete-bin-dirs"
 const devTagSuffix = "-testing"
+const defaultSubmissionRetentionDays = 90
+const defaultSessionRetentionDays = 30
+const defaultAbuseThreshold = 5
+const defaultAbuseBanMinutes = 15
+
+// Where rate limit buckets are kept, in memory for each server or in the
+// store shared by all servers using the same db.
+const (
+	RateLimitBackendMemory = "memory"
+	RateLimitBackendStore  = "store"
+
+	defaultRateLimitBackend = RateLimitBackendMemory
+)
+
+var (
+	DefaultRunRateLimit  = RateLimit{PerSec: 0.5, Burst: 2}
+	DefaultReadRateLimit = RateLimit{PerSec: 2, Burst: 1}
+
+	// Loopback and private networks, where the proxy in front of the
+	// server usually runs
+	DefaultTrustedProxies = []string{
+		"127.0.0.0/8", "::1/128", "10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "fc00::/7",
+	}
+)
+
+// RateLimit is the number of requests per second allowed from a single
+// client, and how many more it may send at once.
+type RateLimit struct {
+	PerSec float64
+	Burst  int
+}
 
 var (
 	ErrInvalidRegistryImgURI = errors.New("registry image doesn't exist")
@@ -20,6 +51,27 @@ type ConfigOpts struct {
 	DevTag        bool
 	DBFile        string
 	StaticDistDir string
+
+	SubmissionRetentionDays int
+	SessionRetentionDays    int
+	AdminToken              string
+	BlocklistFile           string
+	EventsFile              string
+	Revalidate              bool
+	CacheSize               int
+	BatchToken              string
+	ClassToken              string
+	PullImages              bool
+	AdminAddr               string
+	RunRateLimit            RateLimit
+	ReadRateLimit           RateLimit
+	RateLimitBackend        string
+	TrustedProxies          []string
+	AbuseThreshold          int
+	AbuseBanMinutes         int
+	HintPenalty             int
+	DailyTags               []string
+	DailySeed               bool
 }
 
 type Config struct {
@@ -39,6 +91,52 @@ type Config struct {
 	Caller               string
 	registryImgURIs      map[string]string
 	StaticDistDir        string
+
+	SubmissionQueueSize     int
+	SubmissionRetention     time.Duration
+	SubmissionPruneInterval time.Duration
+
+	AdminToken    string
+	AdminAddr     string
+	BlocklistFile string
+	EventsFile    string
+
+	Revalidate      bool
+	RevalidateLimit int
+
+	CacheSize          int
+	CacheFlushInterval time.Duration
+
+	BatchToken       string
+	BatchMaxItems    int
+	BatchConcurrency int
+
+	PullImages   bool
+	ReadyTimeout time.Duration
+
+	ShutdownTimeout time.Duration
+
+	RunRateLimit     RateLimit
+	ReadRateLimit    RateLimit
+	RateLimitBackend string
+	TrustedProxies   []string
+
+	AbuseThreshold   int
+	AbuseWindow      time.Duration
+	AbuseBanDuration time.Duration
+
+	LeaderboardSize     int
+	LeaderboardCacheTTL time.Duration
+	HintPenalty         int
+
+	SessionRetention     time.Duration
+	SessionPruneInterval time.Duration
+
+	ClassToken    string
+	ClassMaxSlugs int
+
+	DailyTags []string
+	DailySeed bool
 }
 
 func New(c ConfigOpts) *Config {
@@ -47,6 +145,38 @@ func New(c ConfigOpts) *Config {
 		tagSuffix = devTagSuffix
 	}
 
+	if c.SubmissionRetentionDays == 0 {
+		c.SubmissionRetentionDays = defaultSubmissionRetentionDays
+	}
+
+	if c.SessionRetentionDays == 0 {
+		c.SessionRetentionDays = defaultSessionRetentionDays
+	}
+
+	if c.RunRateLimit.PerSec == 0 {
+		c.RunRateLimit = DefaultRunRateLimit
+	}
+
+	if c.ReadRateLimit.PerSec == 0 {
+		c.ReadRateLimit = DefaultReadRateLimit
+	}
+
+	if c.RateLimitBackend == "" {
+		c.RateLimitBackend = defaultRateLimitBackend
+	}
+
+	if c.AbuseThreshold == 0 {
+		c.AbuseThreshold = defaultAbuseThreshold
+	}
+
+	if c.AbuseBanMinutes == 0 {
+		c.AbuseBanMinutes = defaultAbuseBanMinutes
+	}
+
+	if c.TrustedProxies == nil {
+		c.TrustedProxies = DefaultTrustedProxies
+	}
+
 	return &Config{
 		CmdTimeout:         5 * time.Second,
 		RegistryAuth:       "",
@@ -60,6 +190,53 @@ func New(c ConfigOpts) *Config {
 		SolutionsKeyPrefix: "s/solutions",
 		StaticDistDir:      c.StaticDistDir,
 
+		SubmissionQueueSize:     1000,
+		SubmissionRetention:     time.Duration(c.SubmissionRetentionDays) * 24 * time.Hour,
+		SubmissionPruneInterval: 1 * time.Hour,
+
+		AdminToken:    c.AdminToken,
+		AdminAddr:     c.AdminAddr,
+		BlocklistFile: c.BlocklistFile,
+		EventsFile:    c.EventsFile,
+
+		Revalidate:      c.Revalidate,
+		RevalidateLimit: 50,
+
+		CacheSize:          c.CacheSize,
+		CacheFlushInterval: 10 * time.Second,
+
+		BatchToken:       c.BatchToken,
+		BatchMaxItems:    100,
+		BatchConcurrency: 4,
+
+		CMDImgNames:  []string{"cmd", "cmd-no-bin"},
+		PullImages:   c.PullImages,
+		ReadyTimeout: 2 * time.Second,
+
+		ShutdownTimeout: 30 * time.Second,
+
+		RunRateLimit:     c.RunRateLimit,
+		ReadRateLimit:    c.ReadRateLimit,
+		RateLimitBackend: c.RateLimitBackend,
+		TrustedProxies:   c.TrustedProxies,
+
+		AbuseThreshold:   c.AbuseThreshold,
+		AbuseWindow:      10 * time.Minute,
+		AbuseBanDuration: time.Duration(c.AbuseBanMinutes) * time.Minute,
+
+		LeaderboardSize:     50,
+		LeaderboardCacheTTL: 30 * time.Second,
+		HintPenalty:         c.HintPenalty,
+
+		SessionRetention:     time.Duration(c.SessionRetentionDays) * 24 * time.Hour,
+		SessionPruneInterval: 1 * time.Hour,
+
+		ClassToken:    c.ClassToken,
+		ClassMaxSlugs: 100,
+
+		DailyTags: c.DailyTags,
+		DailySeed: c.DailySeed,
+
 		registryImgURIs: map[string]string{
 			"cmd":        "cmd:" + runtime.GOARCH + tagSuffix,
 			"cmd-no-bin": "cmd-no-bin:" + runtime.GOARCH + tagSuffix,
@@ -73,3 +250,18 @@ func (c *Config) RegistryImgURI(name string) (string, error) {
 	}
 	return "", ErrInvalidRegistryImgURI
 }
+
+// Redacted returns a copy of the config that is safe to log.
+func (c *Config) Redacted() Config {
+	r := *c
+	if r.AdminToken != "" {
+		r.AdminToken = "[REDACTED]"
+	}
+	if r.BatchToken != "" {
+		r.BatchToken = "[REDACTED]"
+	}
+	if r.ClassToken != "" {
+		r.ClassToken = "[REDACTED]"
+	}
+	return r
+}
@@ -19,12 +19,25 @@ type CmdProcessedLabels struct {
 }
 
 type Metrics struct {
-	log            *slog.Logger
-	CmdProcessed   *prometheus.CounterVec
-	CmdErrors      *prometheus.CounterVec
-	TotalRequests  *prometheus.CounterVec
-	ResponseStatus *prometheus.CounterVec
-	HTTPDuration   *prometheus.HistogramVec
+	log                *slog.Logger
+	CmdProcessed       *prometheus.CounterVec
+	CmdErrors          *prometheus.CounterVec
+	TotalRequests      *prometheus.CounterVec
+	ResponseStatus     *prometheus.CounterVec
+	HTTPDuration       *prometheus.HistogramVec
+	SubmissionsDropped prometheus.Counter
+	SubmissionsPruned  prometheus.Counter
+	SessionsPruned     prometheus.Counter
+	CmdRevalidated     *prometheus.CounterVec
+
+	CacheRequests          *prometheus.CounterVec
+	CacheFlushedIncrements prometheus.Counter
+
+	AbuseEvents   *prometheus.CounterVec
+	AbuseBans     prometheus.Counter
+	AbuseRejected prometheus.Counter
+
+	HintsRevealed *prometheus.CounterVec
 }
 
 var singleMetrics *Metrics
@@ -43,6 +56,11 @@ func (rw *responseWriter) WriteHeader(code int) {
 	rw.ResponseWriter.WriteHeader(code)
 }
 
+// Unwrap allows http.ResponseController to flush streamed responses.
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
 func New(log *slog.Logger) *Metrics {
 	if singleMetrics != nil {
 		return singleMetrics
@@ -81,6 +99,60 @@ func New(log *slog.Logger) *Metrics {
 				Help: "Duration of HTTP requests.",
 			},
 			[]string{"status", "path"}),
+		SubmissionsDropped: promauto.NewCounter(
+			prometheus.CounterOpts{
+				Name: "submissions_dropped_total",
+				Help: "Submissions not logged because the write queue was full",
+			}),
+		SubmissionsPruned: promauto.NewCounter(
+			prometheus.CounterOpts{
+				Name: "submissions_pruned_total",
+				Help: "Submissions removed by retention pruning",
+			}),
+		SessionsPruned: promauto.NewCounter(
+			prometheus.CounterOpts{
+				Name: "sessions_pruned_total",
+				Help: "Idle sessions without progress removed by retention pruning",
+			}),
+		CmdRevalidated: promauto.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "cmd_revalidated_total",
+				Help: "Correct commands of a previous challenge version replayed against the current version",
+			},
+			[]string{"slug", "result"}),
+		CacheRequests: promauto.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "result_cache_requests_total",
+				Help: "Result lookups served by the in-memory cache (hit) or the store (miss)",
+			},
+			[]string{"result"}),
+		CacheFlushedIncrements: promauto.NewCounter(
+			prometheus.CounterOpts{
+				Name: "result_cache_flushed_increments_total",
+				Help: "Distinct results with pending increments written to the store",
+			}),
+		AbuseEvents: promauto.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "abuse_events_total",
+				Help: "Runs that count towards banning a client, by kind",
+			},
+			[]string{"kind"}),
+		AbuseBans: promauto.NewCounter(
+			prometheus.CounterOpts{
+				Name: "abuse_bans_total",
+				Help: "Clients temporarily banned for pathological commands",
+			}),
+		AbuseRejected: promauto.NewCounter(
+			prometheus.CounterOpts{
+				Name: "abuse_rejected_total",
+				Help: "Commands rejected because the client is banned",
+			}),
+		HintsRevealed: promauto.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "hints_revealed_total",
+				Help: "Hints revealed to sessions for the first time, by challenge",
+			},
+			[]string{"slug"}),
 	}
 
 	singleMetrics = &m
@@ -89,7 +161,11 @@ func New(log *slog.Logger) *Metrics {
 
 func (m *Metrics) DBStatsRegister(db *sql.DB, dbName string) {
 	m.log.Info("Registering DB stats")
-	prometheus.MustRegister(collectors.NewDBStatsCollector(db, dbName))
+	// Only the first db opened with a name reports stats, opening it again
+	// (for example in tests) is not an error
+	if err := prometheus.Register(collectors.NewDBStatsCollector(db, dbName)); err != nil {
+		m.log.Warn("Unable to register DB stats", "dbName", dbName, "err", err)
+	}
 }
 
 func (m *Metrics) PrometheusMiddleware(next http.Handler) http.Handler {
@@ -1,10 +1,12 @@
 package runcmd
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"log/slog"
 	"os"
 	"os/exec"
@@ -27,10 +29,17 @@ type RunCmd struct {
 	log     *slog.Logger
 	config  *config.Config
 	oopsCmd *exec.Cmd
+	stream  io.Writer
 }
 
 func New(log *slog.Logger, cfg *config.Config) *RunCmd {
-	return &RunCmd{log, cfg, nil}
+	return &RunCmd{log, cfg, nil, nil}
+}
+
+// SetStream copies the output of the command to w while it runs, the output
+// of the rerun after randomizing data is not copied.
+func (r *RunCmd) SetStream(w io.Writer) {
+	r.stream = w
 }
 
 func (r *RunCmd) startOops(ctx context.Context) (*exec.Cmd, chan string, error) {
@@ -92,7 +101,7 @@ func (r *RunCmd) Run(ch *challenge.Challenge, command string) string {
 	}
 
 	// Run command and record output and exit code
-	cmdOut, exitCode, err := r.runCombinedOutput(ctx, command)
+	cmdOut, exitCode, err := r.runCombinedOutput(ctx, command, r.stream)
 	if err != nil {
 		return r.marshalIncorrectErrInt(err, resp, err.Error())
 	}
@@ -143,7 +152,7 @@ func (r *RunCmd) checkAfterRandomizer(ctx context.Context, ch *challenge.Challen
 	}
 
 	// Run command after randomizer
-	outAfterRnd, _, err := r.runCombinedOutput(ctx, command)
+	outAfterRnd, _, err := r.runCombinedOutput(ctx, command, nil)
 	if err != nil {
 		return false, err
 	}
@@ -183,6 +192,8 @@ func (r *RunCmd) marshalIncorrectErr(resp *challenge.CmdResponse, errMsg string)
 }
 
 func marshalOrPanic(resp *challenge.CmdResponse) string {
+	// Keep the response small, the server doesn't read past the limit
+	resp.TruncateOutput()
 	jsonResp, err := json.Marshal(resp)
 	if err != nil {
 		panic(err)
@@ -192,19 +203,26 @@ func marshalOrPanic(resp *challenge.CmdResponse) string {
 }
 
 //nolint:gocritic // unnamedResult
-func (r *RunCmd) runCombinedOutput(ctx context.Context, command string) (*string, *int, error) {
+func (r *RunCmd) runCombinedOutput(ctx context.Context, command string, stream io.Writer) (*string, *int, error) {
 	bashArgs := []string{"-O", "globstar", "-c", "export MANPAGER=cat;" + command}
 	cmd := exec.Command("bash", bashArgs...)
 	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
 
+	var outb bytes.Buffer
+	cmd.Stdout = &outb
+	if stream != nil {
+		cmd.Stdout = io.MultiWriter(&outb, stream)
+	}
+	cmd.Stderr = cmd.Stdout
+
 	type cmdResult struct {
 		outb []byte
 		err  error
 	}
 	cmdDone := make(chan cmdResult, 1)
 	go func() {
-		outb, cmderr := cmd.CombinedOutput()
-		cmdDone <- cmdResult{outb, cmderr}
+		cmderr := cmd.Run()
+		cmdDone <- cmdResult{outb.Bytes(), cmderr}
 	}()
 
 	select {
@@ -0,0 +1,204 @@
+package store
+
+import (
+	"container/list"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"gitlab.com/jarv/cmdchallenge/internal/metrics"
+)
+
+// ResultKey identifies a stored result.
+type ResultKey struct {
+	CmdKey  string
+	Slug    string
+	Version int
+}
+
+// BatchIncrementer is implemented by stores that can apply many counter
+// increments at once.
+type BatchIncrementer interface {
+	IncrementResults(counts map[ResultKey]int) error
+}
+
+type cacheEntry struct {
+	key    ResultKey
+	result *CmdStore
+}
+
+// CachedStore keeps recently used results in memory in front of another
+// store. Increments are counted in memory and written to the underlying
+// store in batches by Flush, which runs periodically until Close is called.
+// All other methods go straight to the underlying store.
+type CachedStore struct {
+	CmdStorer
+
+	log     *slog.Logger
+	metrics *metrics.Metrics
+	size    int
+
+	mu      sync.Mutex
+	ll      *list.List
+	items   map[ResultKey]*list.Element
+	pending map[ResultKey]int
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+func NewCachedStore(log *slog.Logger, m *metrics.Metrics, next CmdStorer, size int, flushInterval time.Duration) *CachedStore {
+	c := &CachedStore{
+		CmdStorer: next,
+		log:       log,
+		metrics:   m,
+		size:      size,
+		ll:        list.New(),
+		items:     make(map[ResultKey]*list.Element),
+		pending:   make(map[ResultKey]int),
+		done:      make(chan struct{}),
+	}
+
+	c.wg.Add(1)
+	go c.flushLoop(flushInterval)
+
+	return c
+}
+
+func (c *CachedStore) GetResult(cmdKey, slug string, version int) (*CmdStore, error) {
+	key := ResultKey{cmdKey, slug, version}
+
+	c.mu.Lock()
+	if el, ok := c.items[key]; ok {
+		c.ll.MoveToFront(el)
+		result := el.Value.(*cacheEntry).result
+		c.mu.Unlock()
+		c.metrics.CacheRequests.WithLabelValues("hit").Inc()
+		return result, nil
+	}
+	c.mu.Unlock()
+
+	c.metrics.CacheRequests.WithLabelValues("miss").Inc()
+	result, err := c.CmdStorer.GetResult(cmdKey, slug, version)
+	if err != nil {
+		return nil, err
+	}
+
+	c.add(key, result)
+	return result, nil
+}
+
+func (c *CachedStore) CreateResult(s *CmdStore) error {
+	if err := c.CmdStorer.CreateResult(s); err != nil {
+		return err
+	}
+
+	cmdKey := s.Cmd
+	if s.CmdKey != nil {
+		cmdKey = s.CmdKey
+	}
+	c.add(ResultKey{*cmdKey, *s.Slug, *s.Version}, s)
+	return nil
+}
+
+func (c *CachedStore) IncrementResult(cmdKey, slug string, version int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.pending[ResultKey{cmdKey, slug, version}]++
+	return nil
+}
+
+// Flush writes pending increments to the underlying store.
+func (c *CachedStore) Flush() error {
+	c.mu.Lock()
+	pending := c.pending
+	c.pending = make(map[ResultKey]int)
+	c.mu.Unlock()
+
+	flushed := len(pending)
+	if flushed == 0 {
+		return nil
+	}
+
+	if b, ok := c.CmdStorer.(BatchIncrementer); ok {
+		if err := b.IncrementResults(pending); err != nil {
+			// The batch is written in a single transaction, keep the
+			// increments for the next flush
+			c.requeue(pending)
+			return err
+		}
+	} else {
+		for key := range pending {
+			for pending[key] > 0 {
+				if err := c.CmdStorer.IncrementResult(key.CmdKey, key.Slug, key.Version); err != nil {
+					// Keep the increments that weren't written for the
+					// next flush
+					c.requeue(pending)
+					return err
+				}
+				pending[key]--
+			}
+		}
+	}
+
+	c.metrics.CacheFlushedIncrements.Add(float64(flushed))
+	return nil
+}
+
+// Close stops the periodic flush, writes any remaining increments and closes
+// the underlying store.
+func (c *CachedStore) Close() error {
+	close(c.done)
+	c.wg.Wait()
+	return errors.Join(c.Flush(), c.CmdStorer.Close())
+}
+
+// requeue adds increments that couldn't be written back to the pending ones.
+func (c *CachedStore) requeue(pending map[ResultKey]int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key, n := range pending {
+		if n > 0 {
+			c.pending[key] += n
+		}
+	}
+}
+
+func (c *CachedStore) flushLoop(interval time.Duration) {
+	defer c.wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := c.Flush(); err != nil {
+				c.log.Error("Unable to flush result increments", "err", err)
+			}
+		case <-c.done:
+			return
+		}
+	}
+}
+
+func (c *CachedStore) add(key ResultKey, result *CmdStore) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.items[key]; ok {
+		c.ll.MoveToFront(el)
+		el.Value.(*cacheEntry).result = result
+		return
+	}
+
+	c.items[key] = c.ll.PushFront(&cacheEntry{key, result})
+	if c.ll.Len() > c.size {
+		oldest := c.ll.Back()
+		c.ll.Remove(oldest)
+		delete(c.items, oldest.Value.(*cacheEntry).key)
+	}
+}
@@ -0,0 +1,128 @@
+package store
+
+import (
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gitlab.com/jarv/cmdchallenge/internal/metrics"
+)
+
+func newTestCachedStore(t *testing.T, next CmdStorer, size int) *CachedStore {
+	log := slog.New(slog.DiscardHandler)
+	c := NewCachedStore(log, metrics.New(log), next, size, time.Hour)
+	t.Cleanup(func() { _ = c.Close() })
+	return c
+}
+
+func TestCachedStoreIncrements(t *testing.T) {
+	db := newTestDB(t)
+	createTestResults(t, db)
+	c := newTestCachedStore(t, db, 10)
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, c.IncrementResult("echo hello world", "hello_world", 5))
+	}
+
+	// Increments are only written on flush
+	assert.Equal(t, 2, resultCount(t, db, "hello_world", 5))
+
+	require.NoError(t, c.Flush())
+	assert.Equal(t, 5, resultCount(t, db, "hello_world", 5))
+}
+
+func TestCachedStoreGetResult(t *testing.T) {
+	db := newTestDB(t)
+	createTestResults(t, db)
+	c := newTestCachedStore(t, db, 1)
+
+	first, err := c.GetResult("echo hello world", "hello_world", 5)
+	require.NoError(t, err)
+
+	second, err := c.GetResult("echo hello world", "hello_world", 5)
+	require.NoError(t, err)
+	assert.Same(t, first, second)
+
+	// Evicts the first result
+	_, err = c.GetResult("echo hello", "hello_world", 5)
+	require.NoError(t, err)
+
+	third, err := c.GetResult("echo hello world", "hello_world", 5)
+	require.NoError(t, err)
+	assert.NotSame(t, first, third)
+
+	_, err = c.GetResult("echo nope", "hello_world", 5)
+	assert.ErrorIs(t, err, ErrResultNotFound)
+}
+
+func TestCachedStoreCreateResult(t *testing.T) {
+	m, err := NewMemStore()
+	require.NoError(t, err)
+	c := newTestCachedStore(t, m, 10)
+
+	cmd := "echo  hello world"
+	result := &CmdStore{
+		Cmd:     &cmd,
+		CmdKey:  toStrPtr("echo hello world"),
+		Slug:    toStrPtr("hello_world"),
+		Version: toPtr(5),
+	}
+	require.NoError(t, c.CreateResult(result))
+
+	cached, err := c.GetResult("echo hello world", "hello_world", 5)
+	require.NoError(t, err)
+	assert.Same(t, result, cached)
+}
+
+// flakyIncrementer counts increments in memory and fails once failAfter
+// increments were written.
+type flakyIncrementer struct {
+	CmdStorer
+	failAfter int
+	counts    map[ResultKey]int
+}
+
+func (f *flakyIncrementer) IncrementResult(cmdKey, slug string, version int) error {
+	if f.failAfter == 0 {
+		return errors.New("db gone")
+	}
+	f.failAfter--
+	f.counts[ResultKey{cmdKey, slug, version}]++
+	return nil
+}
+
+func TestCachedStoreFlushPartialError(t *testing.T) {
+	m, err := NewMemStore()
+	require.NoError(t, err)
+	next := &flakyIncrementer{CmdStorer: m, failAfter: 2, counts: make(map[ResultKey]int)}
+	c := newTestCachedStore(t, next, 10)
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, c.IncrementResult("echo hello world", "hello_world", 5))
+		require.NoError(t, c.IncrementResult("echo hello", "hello_world", 5))
+	}
+	require.Error(t, c.Flush())
+
+	// The increments that weren't written are kept for the next flush
+	next.failAfter = 10
+	require.NoError(t, c.Flush())
+	assert.Equal(t, map[ResultKey]int{
+		{"echo hello world", "hello_world", 5}: 3,
+		{"echo hello", "hello_world", 5}:       3,
+	}, next.counts)
+}
+
+func TestCachedStoreCloseFlushes(t *testing.T) {
+	m, err := NewMemStore()
+	require.NoError(t, err)
+	next := &flakyIncrementer{CmdStorer: m, failAfter: 10, counts: make(map[ResultKey]int)}
+	log := slog.New(slog.DiscardHandler)
+	c := NewCachedStore(log, metrics.New(log), next, 10, time.Hour)
+
+	require.NoError(t, c.IncrementResult("echo hello world", "hello_world", 5))
+	require.NoError(t, c.Close())
+	assert.Equal(t, map[ResultKey]int{{"echo hello world", "hello_world", 5}: 1}, next.counts)
+}
@@ -0,0 +1,169 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	createClassQuery     = `INSERT INTO classes (id, name, join_code, instructor_key, create_time) VALUES ($1, $2, $3, $4, $5);`
+	createClassSlugQuery = `INSERT INTO class_slugs (class_id, slug) VALUES ($1, $2);`
+	classSlugsQuery      = `SELECT slug FROM class_slugs WHERE class_id = $1 ORDER BY slug;`
+
+	// The WHERE clause is filled in with the column to look up by
+	classQuery = `SELECT id, name, join_code, instructor_key, create_time FROM classes WHERE %s = $1;`
+
+	// Joining again changes the name of the student
+	joinClassQuery = `
+INSERT INTO class_members (class_id, session_id, name, join_time) VALUES ($1, $2, $3, $4)
+	ON CONFLICT (class_id, session_id) DO UPDATE SET name = excluded.name;
+`
+
+	// Records the attempt for every class of the session the challenge is
+	// assigned to
+	recordClassAttemptQuery = `
+INSERT INTO class_attempts (class_id, session_id, slug, cmd, solved, attempts, update_time)
+SELECT m.class_id, m.session_id, s.slug, ?3, ?4, 1, ?5 FROM class_members m
+	JOIN class_slugs s ON s.class_id = m.class_id
+	WHERE m.session_id = ?1 AND s.slug = ?2
+	ON CONFLICT (class_id, session_id, slug) DO UPDATE SET
+		cmd = excluded.cmd,
+		solved = MAX(class_attempts.solved, excluded.solved),
+		attempts = class_attempts.attempts + 1,
+		update_time = excluded.update_time;
+`
+
+	classMembersQuery = `
+SELECT session_id, name, join_time FROM class_members
+	WHERE class_id = $1
+	ORDER BY join_time, name;
+`
+
+	classAttemptsQuery = `
+SELECT session_id, slug, cmd, solved, attempts, update_time FROM class_attempts
+	WHERE class_id = $1
+	ORDER BY slug;
+`
+)
+
+func (d *DB) CreateClass(c *Class) error {
+	tx, err := d.sql.Begin()
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(createClassQuery, c.ID, c.Name, c.JoinCode, c.InstructorKey, c.CreateTime.Unix()); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	for _, slug := range c.Slugs {
+		if _, err := tx.Exec(createClassSlugQuery, c.ID, slug); err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (d *DB) ClassByID(id string) (*Class, error) {
+	return d.class("id", id)
+}
+
+func (d *DB) ClassByJoinCode(code string) (*Class, error) {
+	return d.class("join_code", code)
+}
+
+func (d *DB) class(column, value string) (*Class, error) {
+	var c Class
+	var createTime int64
+	err := d.sql.QueryRow(fmt.Sprintf(classQuery, column), value).Scan(
+		&c.ID, &c.Name, &c.JoinCode, &c.InstructorKey, &createTime,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrClassNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	c.CreateTime = time.Unix(createTime, 0)
+
+	rows, err := d.sql.Query(classSlugsQuery, c.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	c.Slugs = make([]string, 0)
+	for rows.Next() {
+		var slug string
+		if err := rows.Scan(&slug); err != nil {
+			return nil, err
+		}
+		c.Slugs = append(c.Slugs, slug)
+	}
+	return &c, rows.Err()
+}
+
+// JoinClass adds a session to a class, names are unique in a class
+// regardless of case.
+func (d *DB) JoinClass(classID, sessionID, name string, now time.Time) error {
+	_, err := d.sql.Exec(joinClassQuery, classID, sessionID, name, now.Unix())
+	if err != nil && strings.Contains(err.Error(), "UNIQUE constraint failed") {
+		return ErrNameTaken
+	}
+	return err
+}
+
+func (d *DB) RecordClassAttempt(sessionID, slug, cmd string, correct bool, now time.Time) error {
+	_, err := d.sql.Exec(recordClassAttemptQuery, sessionID, slug, cmd, correct, now.Unix())
+	return err
+}
+
+func (d *DB) ClassStudents(classID string) ([]ClassStudent, error) {
+	rows, err := d.sql.Query(classMembersQuery, classID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	students := make([]ClassStudent, 0)
+	bySession := make(map[string]int)
+	for rows.Next() {
+		var sessionID string
+		var s ClassStudent
+		var joinTime int64
+		if err := rows.Scan(&sessionID, &s.Name, &joinTime); err != nil {
+			return nil, err
+		}
+		s.JoinTime = time.Unix(joinTime, 0)
+		s.Attempts = make([]ClassAttempt, 0)
+		bySession[sessionID] = len(students)
+		students = append(students, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	attemptRows, err := d.sql.Query(classAttemptsQuery, classID)
+	if err != nil {
+		return nil, err
+	}
+	defer attemptRows.Close()
+
+	for attemptRows.Next() {
+		var sessionID string
+		var a ClassAttempt
+		var updateTime int64
+		if err := attemptRows.Scan(&sessionID, &a.Slug, &a.Cmd, &a.Solved, &a.Attempts, &updateTime); err != nil {
+			return nil, err
+		}
+		a.UpdateTime = time.Unix(updateTime, 0)
+		if i, ok := bySession[sessionID]; ok {
+			students[i].Attempts = append(students[i].Attempts, a)
+		}
+	}
+	return students, attemptRows.Err()
+}
@@ -0,0 +1,56 @@
+package store
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClasses(t *testing.T) {
+	db := newTestDB(t)
+	now := time.Unix(1700000000, 0)
+
+	require.NoError(t, db.CreateClass(&Class{
+		ID:            "c1",
+		Name:          "Onboarding",
+		JoinCode:      "JOIN1",
+		InstructorKey: "key",
+		Slugs:         []string{"hello_world", "current_working_directory"},
+		CreateTime:    now,
+	}))
+
+	c, err := db.ClassByJoinCode("JOIN1")
+	require.NoError(t, err)
+	assert.Equal(t, &Class{
+		ID:            "c1",
+		Name:          "Onboarding",
+		JoinCode:      "JOIN1",
+		InstructorKey: "key",
+		Slugs:         []string{"current_working_directory", "hello_world"},
+		CreateTime:    now,
+	}, c)
+
+	_, err = db.ClassByID("missing")
+	assert.ErrorIs(t, err, ErrClassNotFound)
+
+	require.NoError(t, db.JoinClass("c1", "a", "alice", now))
+	require.NoError(t, db.JoinClass("c1", "b", "bob", now.Add(time.Second)))
+	assert.ErrorIs(t, db.JoinClass("c1", "b", "Alice", now), ErrNameTaken)
+
+	require.NoError(t, db.RecordClassAttempt("a", "hello_world", "echo hello world", true, now))
+	require.NoError(t, db.RecordClassAttempt("a", "hello_world", "ls", false, now.Add(time.Minute)))
+	// Challenges outside the class and sessions outside it aren't recorded
+	require.NoError(t, db.RecordClassAttempt("a", "print_file_contents", "cat access.log", true, now))
+	require.NoError(t, db.RecordClassAttempt("c", "hello_world", "echo hello world", true, now))
+
+	students, err := db.ClassStudents("c1")
+	require.NoError(t, err)
+	assert.Equal(t, []ClassStudent{
+		{Name: "alice", JoinTime: now, Attempts: []ClassAttempt{
+			{Slug: "hello_world", Cmd: "ls", Solved: true, Attempts: 2, UpdateTime: now.Add(time.Minute)},
+		}},
+		{Name: "bob", JoinTime: now.Add(time.Second), Attempts: []ClassAttempt{}},
+	}, students)
+}
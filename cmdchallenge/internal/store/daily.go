@@ -0,0 +1,41 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+const (
+	dailySubmissionsQuery = `
+SELECT
+	COUNT(*),
+	COALESCE(SUM(correct), 0)
+	FROM submissions
+		WHERE slug=$1 AND version=$2 AND create_time >= $3 AND create_time < $4;
+`
+
+	// Solutions hidden by moderation are left out
+	dailyShortestQuery = `
+SELECT p.cmd FROM progress p
+	LEFT JOIN challenges c ON c.cmd_key = p.cmd_key AND c.slug = p.slug AND c.version = p.version
+	WHERE p.slug=$1 AND p.version=$2 AND p.update_time >= $3 AND p.update_time < $4 AND COALESCE(c.hidden, 0) = 0
+	ORDER BY LENGTH(p.cmd), p.update_time LIMIT 1;
+`
+)
+
+func (d *DB) DailyStatsForSlug(slug string, version int, start, end time.Time) (*DailyStats, error) {
+	var stats DailyStats
+	if err := d.sql.QueryRow(dailySubmissionsQuery, slug, version, start.Unix(), end.Unix()).Scan(
+		&stats.Attempts,
+		&stats.Solves,
+	); err != nil {
+		return nil, err
+	}
+
+	err := d.sql.QueryRow(dailyShortestQuery, slug, version, start.Unix(), end.Unix()).Scan(&stats.Shortest)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+	return &stats, nil
+}
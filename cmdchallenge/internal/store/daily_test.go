@@ -0,0 +1,53 @@
+package store
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDailyStatsForSlug(t *testing.T) {
+	db := newTestDB(t)
+	start := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	end := start.Add(24 * time.Hour)
+
+	for _, s := range []Submission{
+		{Slug: "hello_world", Version: 5, Correct: true, CreateTime: start},
+		{Slug: "hello_world", Version: 5, Correct: false, CreateTime: start.Add(time.Hour)},
+		{Slug: "hello_world", Version: 5, Correct: true, CreateTime: end.Add(-time.Second)},
+		// Outside of the day, or for another version
+		{Slug: "hello_world", Version: 5, Correct: true, CreateTime: end},
+		{Slug: "hello_world", Version: 4, Correct: true, CreateTime: start},
+	} {
+		s := s
+		s.CmdHash = "hash"
+		require.NoError(t, db.CreateSubmission(&s))
+	}
+
+	createTestPlayer(t, db, "a", "", Progress{Slug: "hello_world", Version: 5, Cmd: "echo hello world", UpdateTime: start})
+	createTestPlayer(t, db, "b", "", Progress{Slug: "hello_world", Version: 5, Cmd: "echo 'hello world'", UpdateTime: start})
+	createTestPlayer(t, db, "c", "", Progress{Slug: "hello_world", Version: 5, Cmd: "echo hi", UpdateTime: end})
+
+	stats, err := db.DailyStatsForSlug("hello_world", 5, start, end)
+	require.NoError(t, err)
+	assert.Equal(t, &DailyStats{Attempts: 3, Solves: 2, Shortest: "echo hello world"}, stats)
+
+	// Hidden solutions aren't returned, including spellings of them that
+	// share their key
+	require.NoError(t, db.CreateSession("d", start))
+	require.NoError(t, db.RecordProgress("d", &Progress{
+		Slug: "hello_world", Version: 5, Cmd: "echo  hello world", CmdKey: "echo hello world", UpdateTime: start,
+	}))
+	createTestResults(t, db)
+	hidden := true
+	require.NoError(t, db.ModerateResult("echo hello world", "hello_world", 5, Moderation{Hidden: &hidden}))
+	stats, err = db.DailyStatsForSlug("hello_world", 5, start, end)
+	require.NoError(t, err)
+	assert.Equal(t, "echo 'hello world'", stats.Shortest)
+
+	stats, err = db.DailyStatsForSlug("missing", 1, start, end)
+	require.NoError(t, err)
+	assert.Equal(t, &DailyStats{}, stats)
+}
@@ -3,5 +3,10 @@ package store
 import "errors"
 
 var (
-	ErrResultNotFound = errors.New("result not found")
+	ErrResultNotFound  = errors.New("result not found")
+	ErrInvalidSort     = errors.New("invalid sort")
+	ErrSessionNotFound = errors.New("session not found")
+	ErrHandleTaken     = errors.New("handle is already taken")
+	ErrClassNotFound   = errors.New("class not found")
+	ErrNameTaken       = errors.New("name is already taken in the class")
 )
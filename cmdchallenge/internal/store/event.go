@@ -0,0 +1,45 @@
+package store
+
+import "time"
+
+const (
+	// Keeps the time of the first solve and the shortest command
+	recordEventSolveQuery = `
+INSERT INTO event_solves (event, session_id, slug, cmd, solve_time) VALUES ($1, $2, $3, $4, $5)
+	ON CONFLICT (event, session_id, slug) DO UPDATE SET
+		cmd = excluded.cmd
+	WHERE LENGTH(excluded.cmd) < LENGTH(event_solves.cmd);
+`
+
+	eventSolvesQuery = `
+SELECT s.handle, e.slug, e.cmd, e.solve_time FROM event_solves e
+	JOIN sessions s ON s.id = e.session_id
+	WHERE e.event = $1 AND s.handle IS NOT NULL
+	ORDER BY e.solve_time;
+`
+)
+
+func (d *DB) RecordEventSolve(event, id string, s *EventSolve) error {
+	_, err := d.sql.Exec(recordEventSolveQuery, event, id, s.Slug, s.Cmd, s.SolveTime.Unix())
+	return err
+}
+
+func (d *DB) EventSolves(event string) ([]EventSolve, error) {
+	rows, err := d.sql.Query(eventSolvesQuery, event)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	solves := make([]EventSolve, 0)
+	for rows.Next() {
+		var s EventSolve
+		var solveTime int64
+		if err := rows.Scan(&s.Handle, &s.Slug, &s.Cmd, &solveTime); err != nil {
+			return nil, err
+		}
+		s.SolveTime = time.Unix(solveTime, 0)
+		solves = append(solves, s)
+	}
+	return solves, rows.Err()
+}
@@ -0,0 +1,35 @@
+package store
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventSolves(t *testing.T) {
+	db := newTestDB(t)
+	start := time.Unix(1700000000, 0)
+	createTestPlayer(t, db, "a", "alice")
+	createTestPlayer(t, db, "b", "")
+
+	require.NoError(t, db.RecordEventSolve("ctf", "a", &EventSolve{Slug: "hello_world", Cmd: "echo hello world", SolveTime: start}))
+	// A shorter command keeps the time of the first solve
+	require.NoError(t, db.RecordEventSolve("ctf", "a", &EventSolve{Slug: "hello_world", Cmd: "echo hi", SolveTime: start.Add(time.Hour)}))
+	later := &EventSolve{Slug: "hello_world", Cmd: "echo hello", SolveTime: start.Add(2 * time.Hour)}
+	require.NoError(t, db.RecordEventSolve("ctf", "a", later))
+	require.NoError(t, db.RecordEventSolve("other", "a", &EventSolve{Slug: "hello_world", Cmd: "echo", SolveTime: start}))
+	// Sessions without a handle aren't returned
+	require.NoError(t, db.RecordEventSolve("ctf", "b", &EventSolve{Slug: "hello_world", Cmd: "echo", SolveTime: start}))
+
+	solves, err := db.EventSolves("ctf")
+	require.NoError(t, err)
+	assert.Equal(t, []EventSolve{
+		{Handle: "alice", Slug: "hello_world", Cmd: "echo hi", SolveTime: start},
+	}, solves)
+
+	solves, err = db.EventSolves("missing")
+	require.NoError(t, err)
+	assert.Empty(t, solves)
+}
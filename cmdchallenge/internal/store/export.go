@@ -0,0 +1,265 @@
+package store
+
+import (
+	"bufio"
+	"compress/gzip"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+)
+
+const (
+	exportQuery = `
+SELECT
+	cmd,
+	cmd_key,
+	slug,
+	version,
+	correct,
+	error,
+	exit_code,
+	output,
+	count,
+	create_time,
+	hidden,
+	pinned
+	FROM challenges
+		WHERE ($1 = '' OR slug=$1) AND ($2 = 0 OR version=$2) AND ($3 IS NULL OR correct=$3)
+		ORDER BY slug, version, cmd;
+`
+
+	importQuery = `
+INSERT INTO challenges (
+	cmd,
+	cmd_key,
+	slug,
+	version,
+	correct,
+	error,
+	exit_code,
+	output,
+	count,
+	create_time,
+	hidden,
+	pinned
+) VALUES (
+	?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?
+) ON CONFLICT DO NOTHING
+`
+
+	backupQuery = `VACUUM INTO $1`
+)
+
+// ExportFilter limits exported results, zero values match everything.
+type ExportFilter struct {
+	Slug    string
+	Version int
+	Correct *bool
+}
+
+// ExportRecord is a single result in an export, it uses the same shape as
+// the user submissions test data so either can be imported.
+type ExportRecord struct {
+	Cmd        string  `json:"cmd"`
+	CmdKey     *string `json:"cmd_key,omitempty"`
+	Slug       string  `json:"slug"`
+	Version    int     `json:"version"`
+	Correct    int     `json:"correct"`
+	Error      *string `json:"error,omitempty"`
+	ExitCode   *int    `json:"exit_code,omitempty"`
+	Output     *string `json:"output,omitempty"`
+	Count      int     `json:"count,omitempty"`
+	CreateTime int64   `json:"create_time,omitempty"`
+	Hidden     int     `json:"hidden,omitempty"`
+	Pinned     int     `json:"pinned,omitempty"`
+}
+
+// ExportResults writes results matching the filter to w as gzipped JSON
+// lines and returns the number of records written.
+func (d *DB) ExportResults(w io.Writer, f ExportFilter) (int, error) {
+	rows, err := d.sql.Query(exportQuery, f.Slug, f.Version, f.Correct)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	gw := gzip.NewWriter(w)
+	enc := json.NewEncoder(gw)
+	n := 0
+
+	for rows.Next() {
+		var (
+			rec      ExportRecord
+			cmdKey   sql.NullString
+			correct  bool
+			hidden   bool
+			pinned   bool
+			exitCode sql.NullInt64
+			output   sql.NullString
+			errorStr sql.NullString
+			count    sql.NullInt64
+			created  sql.NullInt64
+		)
+		if err = rows.Scan(
+			&rec.Cmd,
+			&cmdKey,
+			&rec.Slug,
+			&rec.Version,
+			&correct,
+			&errorStr,
+			&exitCode,
+			&output,
+			&count,
+			&created,
+			&hidden,
+			&pinned,
+		); err != nil {
+			return n, err
+		}
+
+		rec.Correct = boolToInt(correct)
+		rec.Hidden = boolToInt(hidden)
+		rec.Pinned = boolToInt(pinned)
+		rec.Count = int(count.Int64)
+		rec.CreateTime = created.Int64
+		if cmdKey.Valid {
+			rec.CmdKey = &cmdKey.String
+		}
+		if errorStr.Valid {
+			rec.Error = &errorStr.String
+		}
+		if exitCode.Valid {
+			rec.ExitCode = toPtr(int(exitCode.Int64))
+		}
+		if output.Valid {
+			rec.Output = &output.String
+		}
+
+		if err = enc.Encode(&rec); err != nil {
+			return n, err
+		}
+		n++
+	}
+
+	if err = rows.Err(); err != nil {
+		return n, err
+	}
+
+	return n, gw.Close()
+}
+
+// ImportResults reads gzipped JSON lines, or a gzipped JSON array, of
+// results and inserts them. Results that already exist are left untouched
+// so importing the same file twice is safe. It returns the number of new
+// results.
+func (d *DB) ImportResults(r io.Reader) (int, error) {
+	gr, err := gzip.NewReader(r)
+	if err != nil {
+		return 0, err
+	}
+	defer gr.Close()
+
+	br := bufio.NewReader(gr)
+	dec := json.NewDecoder(br)
+
+	isArray, err := startsWithArray(br)
+	if err != nil {
+		return 0, err
+	}
+	if isArray {
+		// Consume the opening bracket
+		if _, err = dec.Token(); err != nil {
+			return 0, err
+		}
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	tx, err := d.sql.Begin()
+	if err != nil {
+		return 0, err
+	}
+
+	stmt, err := tx.Prepare(importQuery)
+	if err != nil {
+		_ = tx.Rollback()
+		return 0, err
+	}
+	defer stmt.Close()
+
+	n := 0
+	for !isArray || dec.More() {
+		var rec ExportRecord
+		err = dec.Decode(&rec)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			_ = tx.Rollback()
+			return 0, err
+		}
+
+		res, err := stmt.Exec(
+			rec.Cmd,
+			rec.CmdKey,
+			rec.Slug,
+			rec.Version,
+			rec.Correct == 1,
+			rec.Error,
+			rec.ExitCode,
+			rec.Output,
+			rec.Count,
+			rec.CreateTime,
+			rec.Hidden == 1,
+			rec.Pinned == 1,
+		)
+		if err != nil {
+			_ = tx.Rollback()
+			return 0, err
+		}
+
+		inserted, err := res.RowsAffected()
+		if err != nil {
+			_ = tx.Rollback()
+			return 0, err
+		}
+		n += int(inserted)
+	}
+
+	return n, tx.Commit()
+}
+
+// Backup writes a consistent copy of the database to fname while it
+// continues to serve requests, fname must not exist.
+func (d *DB) Backup(fname string) error {
+	d.log.Info("Backing up db", "file", fname)
+	_, err := d.sql.Exec(backupQuery, fname)
+	return err
+}
+
+func startsWithArray(br *bufio.Reader) (bool, error) {
+	for {
+		b, err := br.Peek(1)
+		if errors.Is(err, io.EOF) {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		switch b[0] {
+		case ' ', '\t', '\r', '\n':
+			_, _ = br.ReadByte()
+		default:
+			return b[0] == '[', nil
+		}
+	}
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
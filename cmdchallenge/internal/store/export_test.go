@@ -0,0 +1,125 @@
+package store
+
+import (
+	"bytes"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gitlab.com/jarv/cmdchallenge/internal/metrics"
+)
+
+func newTestDB(t *testing.T) *DB {
+	log := slog.New(slog.DiscardHandler)
+	db, err := NewSQLStore(log, metrics.New(log), filepath.Join(t.TempDir(), "db.sqlite3"))
+	require.NoError(t, err)
+	return db
+}
+
+func createTestResults(t *testing.T, db *DB) {
+	for _, r := range []struct {
+		cmd     string
+		correct bool
+		version int
+	}{
+		{"echo hello world", true, 5},
+		{"echo hello", false, 5},
+		{"echo 'hello world'", true, 4},
+	} {
+		require.NoError(t, db.CreateResult(&CmdStore{
+			Cmd:      &r.cmd,
+			CmdKey:   &r.cmd,
+			Slug:     toStrPtr("hello_world"),
+			Version:  toPtr(r.version),
+			Correct:  &r.correct,
+			ExitCode: toPtr(0),
+			Output:   toStrPtr("hello world"),
+		}))
+		require.NoError(t, db.IncrementResult(r.cmd, "hello_world", r.version))
+	}
+}
+
+// resultCount is the number of times results for a challenge version were returned.
+func resultCount(t *testing.T, db *DB, slug string, version int) int {
+	var n int
+	require.NoError(t, db.sql.QueryRow("SELECT COALESCE(SUM(count), 0) FROM challenges WHERE slug = $1 AND version = $2", slug, version).Scan(&n))
+	return n
+}
+
+func TestExportImport(t *testing.T) {
+	src := newTestDB(t)
+	createTestResults(t, src)
+
+	var buf bytes.Buffer
+	n, err := src.ExportResults(&buf, ExportFilter{})
+	require.NoError(t, err)
+	assert.Equal(t, 3, n)
+
+	dst := newTestDB(t)
+	n, err = dst.ImportResults(bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+	assert.Equal(t, 3, n)
+
+	// Importing again doesn't create duplicates
+	n, err = dst.ImportResults(bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+
+	result, err := dst.GetResult("echo hello world", "hello_world", 5)
+	require.NoError(t, err)
+	assert.True(t, *result.Correct)
+	assert.Equal(t, "hello world", *result.Output)
+
+	assert.Equal(t, 2, resultCount(t, dst, "hello_world", 5))
+}
+
+func TestExportFilter(t *testing.T) {
+	db := newTestDB(t)
+	createTestResults(t, db)
+
+	correct := true
+	var buf bytes.Buffer
+	n, err := db.ExportResults(&buf, ExportFilter{Slug: "hello_world", Version: 5, Correct: &correct})
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	n, err = db.ExportResults(&buf, ExportFilter{Slug: "reverse_readme"})
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+}
+
+func TestImportSubmissionsTestData(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+
+	f, err := os.Open("../../cmd/submissions/testdata/user-submissions.json.gz")
+	require.NoError(t, err)
+	defer f.Close()
+
+	n, err := newTestDB(t).ImportResults(f)
+	require.NoError(t, err)
+	assert.Positive(t, n)
+}
+
+func TestBackup(t *testing.T) {
+	db := newTestDB(t)
+	createTestResults(t, db)
+
+	fname := filepath.Join(t.TempDir(), "backup.sqlite3")
+	require.NoError(t, db.Backup(fname))
+
+	log := slog.New(slog.DiscardHandler)
+	restored, err := NewSQLStore(log, metrics.New(log), fname)
+	require.NoError(t, err)
+
+	_, err = restored.GetResult("echo hello", "hello_world", 5)
+	require.NoError(t, err)
+}
+
+func toStrPtr(s string) *string {
+	return &s
+}
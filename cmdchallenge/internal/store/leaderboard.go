@@ -0,0 +1,88 @@
+package store
+
+import (
+	"strings"
+	"time"
+)
+
+const (
+	// Ties are won by whoever sent the command first
+	slugLeaderboardQuery = `
+SELECT s.handle, p.cmd, LENGTH(p.cmd), COALESCE(h.hints, 0), LENGTH(p.cmd) + ?3 * COALESCE(h.hints, 0) AS score, p.update_time
+	FROM progress p
+	JOIN sessions s ON s.id = p.session_id
+	LEFT JOIN hint_usage h ON h.session_id = p.session_id AND h.slug = p.slug AND h.version = p.version
+	LEFT JOIN challenges c ON c.cmd_key = p.cmd_key AND c.slug = p.slug AND c.version = p.version
+	WHERE p.slug = ?1 AND p.version = ?2 AND s.handle IS NOT NULL AND COALESCE(c.hidden, 0) = 0
+	ORDER BY score, p.update_time, s.handle LIMIT ?4;
+`
+
+	// Players are ranked by the number of challenges solved, then by the
+	// total length of their commands plus the hint penalty
+	overallLeaderboardQuery = `
+WITH current (slug, version) AS (VALUES %s)
+SELECT s.handle, COUNT(*), SUM(LENGTH(p.cmd)), SUM(COALESCE(h.hints, 0)),
+	SUM(LENGTH(p.cmd)) + ? * SUM(COALESCE(h.hints, 0)) AS score, MAX(p.update_time)
+	FROM progress p
+	JOIN current cur ON cur.slug = p.slug AND cur.version = p.version
+	JOIN sessions s ON s.id = p.session_id
+	LEFT JOIN hint_usage h ON h.session_id = p.session_id AND h.slug = p.slug AND h.version = p.version
+	LEFT JOIN challenges c ON c.cmd_key = p.cmd_key AND c.slug = p.slug AND c.version = p.version
+	WHERE s.handle IS NOT NULL AND COALESCE(c.hidden, 0) = 0
+	GROUP BY s.id
+	ORDER BY COUNT(*) DESC, score, MAX(p.update_time), s.handle LIMIT ?;
+`
+)
+
+func (d *DB) SlugLeaderboard(slug string, version, hintPenalty, limit int) ([]LeaderboardEntry, error) {
+	rows, err := d.sql.Query(slugLeaderboardQuery, slug, version, hintPenalty, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := make([]LeaderboardEntry, 0)
+	for rows.Next() {
+		var e LeaderboardEntry
+		var solvedTime int64
+		if err := rows.Scan(&e.Handle, &e.Cmd, &e.Length, &e.Hints, &e.Score, &solvedTime); err != nil {
+			return nil, err
+		}
+		e.SolvedTime = time.Unix(solvedTime, 0)
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// OverallLeaderboard ranks players by their progress for the given
+// challenge versions, usually the current version of every challenge.
+func (d *DB) OverallLeaderboard(versions []SlugVersion, hintPenalty, limit int) ([]OverallEntry, error) {
+	entries := make([]OverallEntry, 0)
+	if len(versions) == 0 {
+		return entries, nil
+	}
+
+	args := make([]any, 0, 2*len(versions)+2)
+	for _, v := range versions {
+		args = append(args, v.Slug, v.Version)
+	}
+	args = append(args, hintPenalty, limit)
+
+	values := strings.TrimSuffix(strings.Repeat("(?, ?),", len(versions)), ",")
+	rows, err := d.sql.Query(strings.Replace(overallLeaderboardQuery, "%s", values, 1), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var e OverallEntry
+		var lastSolvedTime int64
+		if err := rows.Scan(&e.Handle, &e.Solved, &e.TotalLength, &e.Hints, &e.Score, &lastSolvedTime); err != nil {
+			return nil, err
+		}
+		e.LastSolvedTime = time.Unix(lastSolvedTime, 0)
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
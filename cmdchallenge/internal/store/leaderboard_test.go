@@ -0,0 +1,153 @@
+package store
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func createTestPlayer(t *testing.T, s SessionStorer, id, handle string, progress ...Progress) {
+	require.NoError(t, s.CreateSession(id, time.Now()))
+	if handle != "" {
+		require.NoError(t, s.SetHandle(id, handle))
+	}
+	for _, p := range progress {
+		p.CmdKey = p.Cmd
+		require.NoError(t, s.RecordProgress(id, &p))
+	}
+}
+
+func TestSetHandle(t *testing.T) {
+	db := newTestDB(t)
+	require.NoError(t, db.CreateSession("a", time.Now()))
+	require.NoError(t, db.CreateSession("b", time.Now()))
+
+	require.NoError(t, db.SetHandle("a", "alice"))
+	require.NoError(t, db.SetHandle("a", "Alice"))
+	assert.ErrorIs(t, db.SetHandle("b", "ALICE"), ErrHandleTaken)
+	assert.ErrorIs(t, db.SetHandle("c", "carol"), ErrSessionNotFound)
+}
+
+func TestLeaderboards(t *testing.T) {
+	db := newTestDB(t)
+	createTestResults(t, db)
+	hidden := true
+	require.NoError(t, db.ModerateResult("echo 'hello world'", "hello_world", 4, Moderation{Hidden: &hidden}))
+
+	start := time.Unix(1700000000, 0)
+	createTestPlayer(t, db, "a", "alice",
+		Progress{Slug: "hello_world", Version: 5, Cmd: "echo hello world", UpdateTime: start.Add(time.Minute)},
+		Progress{Slug: "current_working_directory", Version: 5, Cmd: "pwd", UpdateTime: start},
+	)
+	createTestPlayer(t, db, "b", "bob",
+		Progress{Slug: "hello_world", Version: 5, Cmd: "echo hello world", UpdateTime: start},
+	)
+	createTestPlayer(t, db, "c", "carol",
+		Progress{Slug: "hello_world", Version: 5, Cmd: "echo hello  world", UpdateTime: start},
+		Progress{Slug: "hello_world", Version: 4, Cmd: "echo 'hello world'", UpdateTime: start},
+	)
+	// Sessions without a handle aren't ranked
+	createTestPlayer(t, db, "d", "",
+		Progress{Slug: "hello_world", Version: 5, Cmd: "echo hi", UpdateTime: start},
+	)
+
+	entries, err := db.SlugLeaderboard("hello_world", 5, 10, 10)
+	require.NoError(t, err)
+	assert.Equal(t, []LeaderboardEntry{
+		{Handle: "bob", Cmd: "echo hello world", Length: 16, Score: 16, SolvedTime: start},
+		{Handle: "alice", Cmd: "echo hello world", Length: 16, Score: 16, SolvedTime: start.Add(time.Minute)},
+		{Handle: "carol", Cmd: "echo hello  world", Length: 17, Score: 17, SolvedTime: start},
+	}, entries)
+
+	// The result is hidden
+	entries, err = db.SlugLeaderboard("hello_world", 4, 10, 10)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+
+	overall, err := db.OverallLeaderboard([]SlugVersion{
+		{Slug: "hello_world", Version: 5},
+		{Slug: "current_working_directory", Version: 5},
+	}, 10, 2)
+	require.NoError(t, err)
+	assert.Equal(t, []OverallEntry{
+		{Handle: "alice", Solved: 2, TotalLength: 19, Score: 19, LastSolvedTime: start.Add(time.Minute)},
+		{Handle: "bob", Solved: 1, TotalLength: 16, Score: 16, LastSolvedTime: start},
+	}, overall)
+
+	// Each hint adds the penalty to the length
+	require.NoError(t, db.RecordHintsUsed("b", "hello_world", 5, 1, start))
+	entries, err = db.SlugLeaderboard("hello_world", 5, 10, 10)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"alice", "carol", "bob"}, leaderboardHandles(entries))
+	assert.Equal(t, LeaderboardEntry{
+		Handle: "bob", Cmd: "echo hello world", Length: 16, Hints: 1, Score: 26, SolvedTime: start,
+	}, entries[2])
+}
+
+func TestMemLeaderboards(t *testing.T) {
+	m := NewMemSessionStore()
+	start := time.Unix(1700000000, 0)
+	createTestPlayer(t, m, "a", "alice",
+		Progress{Slug: "hello_world", Version: 5, Cmd: "echo hello world", UpdateTime: start.Add(time.Minute)},
+		Progress{Slug: "current_working_directory", Version: 5, Cmd: "pwd", UpdateTime: start},
+	)
+	createTestPlayer(t, m, "b", "bob",
+		Progress{Slug: "hello_world", Version: 5, Cmd: "echo hello world", UpdateTime: start},
+	)
+	createTestPlayer(t, m, "c", "carol",
+		Progress{Slug: "hello_world", Version: 5, Cmd: "echo hello  world", UpdateTime: start},
+	)
+	createTestPlayer(t, m, "d", "",
+		Progress{Slug: "hello_world", Version: 5, Cmd: "echo hi", UpdateTime: start},
+	)
+
+	entries, err := m.SlugLeaderboard("hello_world", 5, 10, 10)
+	require.NoError(t, err)
+	assert.Equal(t, []LeaderboardEntry{
+		{Handle: "bob", Cmd: "echo hello world", Length: 16, Score: 16, SolvedTime: start},
+		{Handle: "alice", Cmd: "echo hello world", Length: 16, Score: 16, SolvedTime: start.Add(time.Minute)},
+		{Handle: "carol", Cmd: "echo hello  world", Length: 17, Score: 17, SolvedTime: start},
+	}, entries)
+
+	overall, err := m.OverallLeaderboard([]SlugVersion{
+		{Slug: "hello_world", Version: 5},
+		{Slug: "current_working_directory", Version: 5},
+	}, 10, 2)
+	require.NoError(t, err)
+	assert.Equal(t, []OverallEntry{
+		{Handle: "alice", Solved: 2, TotalLength: 19, Score: 19, LastSolvedTime: start.Add(time.Minute)},
+		{Handle: "bob", Solved: 1, TotalLength: 16, Score: 16, LastSolvedTime: start},
+	}, overall)
+
+	require.NoError(t, m.RecordHintsUsed("b", "hello_world", 5, 1, start))
+	entries, err = m.SlugLeaderboard("hello_world", 5, 10, 2)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"alice", "carol"}, leaderboardHandles(entries))
+}
+
+func leaderboardHandles(entries []LeaderboardEntry) []string {
+	handles := make([]string, 0, len(entries))
+	for _, e := range entries {
+		handles = append(handles, e.Handle)
+	}
+	return handles
+}
+
+func TestHintsUsed(t *testing.T) {
+	db := newTestDB(t)
+	now := time.Now()
+
+	n, err := db.HintsUsed("a", "hello_world", 5)
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+
+	require.NoError(t, db.RecordHintsUsed("a", "hello_world", 5, 2, now))
+	// Hints can't be taken back
+	require.NoError(t, db.RecordHintsUsed("a", "hello_world", 5, 1, now))
+
+	n, err = db.HintsUsed("a", "hello_world", 5)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+}
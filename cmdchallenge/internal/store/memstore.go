@@ -1,13 +1,19 @@
 package store
 
 import (
+	"cmp"
+	"context"
 	"fmt"
+	"slices"
+	"strings"
 	"sync"
+	"time"
 )
 
 type MemStore struct {
-	mu      sync.Mutex
-	results map[string]*CmdStore
+	mu          sync.Mutex
+	results     map[string]*CmdStore
+	submissions []*Submission
 }
 
 func NewMemStore() (CmdStorer, error) {
@@ -16,31 +22,171 @@ func NewMemStore() (CmdStorer, error) {
 	return m, nil
 }
 
-func (m *MemStore) TopCmdsForSlug(slug string) ([]string, error) {
-	return make([]string, 0), nil
+func (m *MemStore) TopCmdsForSlug(q CmdsQuery) ([]Solution, error) {
+	return make([]Solution, 0), nil
 }
 
-func (m *MemStore) GetResult(cmd, slug string, version int) (*CmdStore, error) {
-	if !m.hasResult(genKey(&cmd, &slug, &version)) {
+func (m *MemStore) StatsForSlug(slug string, version int) (*SlugStats, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stats := SlugStats{Slug: slug, Version: version, TopErrors: make([]ErrorCount, 0)}
+	hashes := make(map[string]bool)
+	errCounts := make(map[string]int)
+	lengths := make([]int, 0)
+	correct := 0
+	for _, s := range m.submissions {
+		if s.Slug != slug || s.Version != version {
+			continue
+		}
+		stats.Attempts++
+		hashes[s.CmdHash] = true
+		lengths = append(lengths, s.CmdLength)
+		if s.Correct {
+			correct++
+		} else if s.Error != "" {
+			errCounts[s.Error]++
+		}
+	}
+
+	if stats.Attempts == 0 {
+		return &stats, nil
+	}
+	stats.UniqueCmds = len(hashes)
+	stats.CorrectRate = float64(correct) / float64(stats.Attempts)
+	slices.Sort(lengths)
+	stats.MedianCmdLength = lengths[(len(lengths)-1)/2]
+
+	for e, n := range errCounts {
+		stats.TopErrors = append(stats.TopErrors, ErrorCount{Error: e, Count: n})
+	}
+	slices.SortFunc(stats.TopErrors, func(a, b ErrorCount) int {
+		return cmp.Or(cmp.Compare(b.Count, a.Count), cmp.Compare(a.Error, b.Error))
+	})
+	if len(stats.TopErrors) > maxTopErrors {
+		stats.TopErrors = stats.TopErrors[:maxTopErrors]
+	}
+	return &stats, nil
+}
+
+func (m *MemStore) DailyStatsForSlug(slug string, version int, start, end time.Time) (*DailyStats, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var stats DailyStats
+	for _, s := range m.submissions {
+		if s.Slug != slug || s.Version != version || s.CreateTime.Before(start) || !s.CreateTime.Before(end) {
+			continue
+		}
+		stats.Attempts++
+		if s.Correct {
+			stats.Solves++
+		}
+	}
+	return &stats, nil
+}
+
+func (m *MemStore) GetResult(cmdKey, slug string, version int) (*CmdStore, error) {
+	if !m.hasResult(genKey(&cmdKey, &slug, &version)) {
 		return nil, ErrResultNotFound
 	}
 
-	return m.results[genKey(&cmd, &slug, &version)], nil
+	return m.results[genKey(&cmdKey, &slug, &version)], nil
 }
 
 func (m *MemStore) CreateResult(s *CmdStore) error {
-	if m.hasResult(genKey(s.Cmd, s.Slug, s.Version)) {
+	cmdKey := s.Cmd
+	if s.CmdKey != nil {
+		cmdKey = s.CmdKey
+	}
+
+	if m.hasResult(genKey(cmdKey, s.Slug, s.Version)) {
 		return nil
 	}
 
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	m.results[genKey(s.Cmd, s.Slug, s.Version)] = s
+	m.results[genKey(cmdKey, s.Slug, s.Version)] = s
 	return nil
 }
 
-func (m *MemStore) IncrementResult(cmd, slug string, version int) error {
+func (m *MemStore) IncrementResult(cmdKey, slug string, version int) error {
+	return nil
+}
+
+func (m *MemStore) ModerateResult(cmd, slug string, version int, _ Moderation) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, r := range m.results {
+		if *r.Cmd == cmd && *r.Slug == slug && *r.Version == version {
+			return nil
+		}
+	}
+	return ErrResultNotFound
+}
+
+func (m *MemStore) PreviousVersion(slug string, version int) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	prev := -1
+	for _, r := range m.results {
+		if *r.Slug == slug && *r.Version < version && *r.Version > prev {
+			prev = *r.Version
+		}
+	}
+	if prev == -1 {
+		return 0, ErrResultNotFound
+	}
+	return prev, nil
+}
+
+func (m *MemStore) CorrectCmdsForVersion(slug string, version, limit int) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	cmds := make([]string, 0)
+	for _, r := range m.results {
+		if len(cmds) >= limit {
+			break
+		}
+		if *r.Slug == slug && *r.Version == version && *r.Correct {
+			cmds = append(cmds, *r.Cmd)
+		}
+	}
+	return cmds, nil
+}
+
+func (m *MemStore) CreateSubmission(s *Submission) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.submissions = append(m.submissions, s)
+	return nil
+}
+
+func (m *MemStore) PruneSubmissions(before time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	kept := m.submissions[:0]
+	for _, s := range m.submissions {
+		if !s.CreateTime.Before(before) {
+			kept = append(kept, s)
+		}
+	}
+	pruned := int64(len(m.submissions) - len(kept))
+	m.submissions = kept
+	return pruned, nil
+}
+
+func (m *MemStore) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (m *MemStore) Close() error {
 	return nil
 }
 
@@ -55,3 +201,367 @@ func (m *MemStore) hasResult(key string) bool {
 func genKey(cmd, slug *string, version *int) string {
 	return fmt.Sprintf("%s-%s-%d", *cmd, *slug, *version)
 }
+
+// MemSessionStore keeps sessions in memory for development.
+type MemSessionStore struct {
+	mu       sync.Mutex
+	sessions map[string]map[string]Progress
+	lastSeen map[string]time.Time
+	handles  map[string]string
+	hints    map[string]int
+	events   map[string]map[string]EventSolve
+}
+
+func NewMemSessionStore() *MemSessionStore {
+	return &MemSessionStore{
+		sessions: make(map[string]map[string]Progress),
+		lastSeen: make(map[string]time.Time),
+		handles:  make(map[string]string),
+		hints:    make(map[string]int),
+		events:   make(map[string]map[string]EventSolve),
+	}
+}
+
+func (m *MemSessionStore) CreateSession(id string, now time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.sessions[id] = make(map[string]Progress)
+	m.lastSeen[id] = now
+	return nil
+}
+
+func (m *MemSessionStore) TouchSession(id string, now time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.sessions[id]; !ok {
+		return ErrSessionNotFound
+	}
+	m.lastSeen[id] = now
+	return nil
+}
+
+func (m *MemSessionStore) SetHandle(id, handle string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.sessions[id]; !ok {
+		return ErrSessionNotFound
+	}
+	for other, h := range m.handles {
+		if other != id && strings.EqualFold(h, handle) {
+			return ErrHandleTaken
+		}
+	}
+	m.handles[id] = handle
+	return nil
+}
+
+func (m *MemSessionStore) RecordProgress(id string, p *Progress) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	progress, ok := m.sessions[id]
+	if !ok {
+		return ErrSessionNotFound
+	}
+
+	key := fmt.Sprintf("%s-%d", p.Slug, p.Version)
+	if prev, ok := progress[key]; ok && len(prev.Cmd) <= len(p.Cmd) {
+		return nil
+	}
+	progress[key] = *p
+	return nil
+}
+
+func (m *MemSessionStore) ProgressForSession(id string) ([]Progress, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	progress := make([]Progress, 0, len(m.sessions[id]))
+	for _, p := range m.sessions[id] {
+		progress = append(progress, p)
+	}
+	slices.SortFunc(progress, func(a, b Progress) int {
+		return cmp.Or(cmp.Compare(a.Slug, b.Slug), cmp.Compare(a.Version, b.Version))
+	})
+	return progress, nil
+}
+
+func (m *MemSessionStore) HintsUsed(id, slug string, version int) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.hints[fmt.Sprintf("%s-%s-%d", id, slug, version)], nil
+}
+
+func (m *MemSessionStore) RecordHintsUsed(id, slug string, version, n int, now time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := fmt.Sprintf("%s-%s-%d", id, slug, version)
+	m.hints[key] = max(m.hints[key], n)
+	return nil
+}
+
+// PruneSessions removes sessions that weren't seen since before and have no
+// progress, handle or event solves. Class members are kept in MemClassStore
+// and aren't checked.
+func (m *MemSessionStore) PruneSessions(before time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var n int64
+	for id, progress := range m.sessions {
+		if !m.lastSeen[id].Before(before) || len(progress) > 0 || m.handles[id] != "" || m.hasEventSolves(id) {
+			continue
+		}
+		delete(m.sessions, id)
+		delete(m.lastSeen, id)
+		for key := range m.hints {
+			if strings.HasPrefix(key, id+"-") {
+				delete(m.hints, key)
+			}
+		}
+		n++
+	}
+	return n, nil
+}
+
+func (m *MemSessionStore) hasEventSolves(id string) bool {
+	for _, solves := range m.events {
+		for key := range solves {
+			if strings.HasPrefix(key, id+"-") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// SlugLeaderboard ranks the sessions with a handle like DB.SlugLeaderboard,
+// hidden results aren't left out since the results are in MemStore.
+func (m *MemSessionStore) SlugLeaderboard(slug string, version, hintPenalty, limit int) ([]LeaderboardEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entries := make([]LeaderboardEntry, 0)
+	for id, handle := range m.handles {
+		p, ok := m.sessions[id][fmt.Sprintf("%s-%d", slug, version)]
+		if !ok {
+			continue
+		}
+		hints := m.hints[fmt.Sprintf("%s-%s-%d", id, slug, version)]
+		entries = append(entries, LeaderboardEntry{
+			Handle:     handle,
+			Cmd:        p.Cmd,
+			Length:     len(p.Cmd),
+			Hints:      hints,
+			Score:      len(p.Cmd) + hintPenalty*hints,
+			SolvedTime: p.UpdateTime,
+		})
+	}
+
+	slices.SortFunc(entries, func(a, b LeaderboardEntry) int {
+		return cmp.Or(cmp.Compare(a.Score, b.Score), a.SolvedTime.Compare(b.SolvedTime), cmp.Compare(a.Handle, b.Handle))
+	})
+	return entries[:min(limit, len(entries))], nil
+}
+
+// OverallLeaderboard ranks the sessions with a handle like
+// DB.OverallLeaderboard.
+func (m *MemSessionStore) OverallLeaderboard(versions []SlugVersion, hintPenalty, limit int) ([]OverallEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entries := make([]OverallEntry, 0)
+	for id, handle := range m.handles {
+		e := OverallEntry{Handle: handle}
+		for _, v := range versions {
+			p, ok := m.sessions[id][fmt.Sprintf("%s-%d", v.Slug, v.Version)]
+			if !ok {
+				continue
+			}
+			e.Solved++
+			e.TotalLength += len(p.Cmd)
+			e.Hints += m.hints[fmt.Sprintf("%s-%s-%d", id, v.Slug, v.Version)]
+			if p.UpdateTime.After(e.LastSolvedTime) {
+				e.LastSolvedTime = p.UpdateTime
+			}
+		}
+		if e.Solved == 0 {
+			continue
+		}
+		e.Score = e.TotalLength + hintPenalty*e.Hints
+		entries = append(entries, e)
+	}
+
+	slices.SortFunc(entries, func(a, b OverallEntry) int {
+		return cmp.Or(cmp.Compare(b.Solved, a.Solved), cmp.Compare(a.Score, b.Score),
+			a.LastSolvedTime.Compare(b.LastSolvedTime), cmp.Compare(a.Handle, b.Handle))
+	})
+	return entries[:min(limit, len(entries))], nil
+}
+
+func (m *MemSessionStore) RecordEventSolve(event, id string, s *EventSolve) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.sessions[id]; !ok {
+		return ErrSessionNotFound
+	}
+	if _, ok := m.events[event]; !ok {
+		m.events[event] = make(map[string]EventSolve)
+	}
+
+	key := id + "-" + s.Slug
+	prev, ok := m.events[event][key]
+	switch {
+	case !ok:
+		m.events[event][key] = *s
+	case len(s.Cmd) < len(prev.Cmd):
+		prev.Cmd = s.Cmd
+		m.events[event][key] = prev
+	}
+	return nil
+}
+
+func (m *MemSessionStore) EventSolves(event string) ([]EventSolve, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	solves := make([]EventSolve, 0, len(m.events[event]))
+	for key, s := range m.events[event] {
+		id := strings.TrimSuffix(key, "-"+s.Slug)
+		handle, ok := m.handles[id]
+		if !ok {
+			continue
+		}
+		s.Handle = handle
+		solves = append(solves, s)
+	}
+	slices.SortFunc(solves, func(a, b EventSolve) int {
+		return a.SolveTime.Compare(b.SolveTime)
+	})
+	return solves, nil
+}
+
+type memStudent struct {
+	ClassStudent
+	sessionID string
+}
+
+// MemClassStore keeps classes in memory for development.
+type MemClassStore struct {
+	mu       sync.Mutex
+	classes  map[string]*Class
+	students map[string][]*memStudent
+}
+
+func NewMemClassStore() *MemClassStore {
+	return &MemClassStore{
+		classes:  make(map[string]*Class),
+		students: make(map[string][]*memStudent),
+	}
+}
+
+func (m *MemClassStore) CreateClass(c *Class) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	cp := *c
+	m.classes[c.ID] = &cp
+	return nil
+}
+
+func (m *MemClassStore) ClassByID(id string) (*Class, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	c, ok := m.classes[id]
+	if !ok {
+		return nil, ErrClassNotFound
+	}
+	cp := *c
+	return &cp, nil
+}
+
+func (m *MemClassStore) ClassByJoinCode(code string) (*Class, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, c := range m.classes {
+		if c.JoinCode == code {
+			cp := *c
+			return &cp, nil
+		}
+	}
+	return nil, ErrClassNotFound
+}
+
+func (m *MemClassStore) JoinClass(classID, sessionID, name string, now time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var member *memStudent
+	for _, s := range m.students[classID] {
+		if s.sessionID == sessionID {
+			member = s
+		} else if strings.EqualFold(s.Name, name) {
+			return ErrNameTaken
+		}
+	}
+
+	if member == nil {
+		member = &memStudent{
+			ClassStudent: ClassStudent{JoinTime: now, Attempts: make([]ClassAttempt, 0)},
+			sessionID:    sessionID,
+		}
+		m.students[classID] = append(m.students[classID], member)
+	}
+	member.Name = name
+	return nil
+}
+
+func (m *MemClassStore) RecordClassAttempt(sessionID, slug, cmd string, correct bool, now time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for classID, students := range m.students {
+		if !slices.Contains(m.classes[classID].Slugs, slug) {
+			continue
+		}
+		for _, s := range students {
+			if s.sessionID == sessionID {
+				s.record(slug, cmd, correct, now)
+			}
+		}
+	}
+	return nil
+}
+
+func (s *memStudent) record(slug, cmd string, correct bool, now time.Time) {
+	for i := range s.Attempts {
+		if a := &s.Attempts[i]; a.Slug == slug {
+			a.Cmd, a.Solved, a.UpdateTime = cmd, a.Solved || correct, now
+			a.Attempts++
+			return
+		}
+	}
+	s.Attempts = append(s.Attempts, ClassAttempt{Slug: slug, Cmd: cmd, Solved: correct, Attempts: 1, UpdateTime: now})
+	slices.SortFunc(s.Attempts, func(a, b ClassAttempt) int { return cmp.Compare(a.Slug, b.Slug) })
+}
+
+func (m *MemClassStore) ClassStudents(classID string) ([]ClassStudent, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	students := make([]ClassStudent, 0, len(m.students[classID]))
+	for _, s := range m.students[classID] {
+		cs := s.ClassStudent
+		cs.Attempts = slices.Clone(s.Attempts)
+		students = append(students, cs)
+	}
+	return students, nil
+}
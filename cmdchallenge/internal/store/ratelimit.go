@@ -0,0 +1,52 @@
+package store
+
+import "time"
+
+const (
+	// Refills the bucket for the time since it was last updated and takes a
+	// token from it. Buckets without a token left aren't updated, so no row
+	// is affected when the request is denied. This is a single statement so
+	// it is atomic across processes sharing the db, parameters are numbered
+	// because they are used out of order.
+	takeTokenQuery = `
+INSERT INTO rate_limits (key, tokens, update_time) VALUES (?1, ?3 - 1, ?4)
+	ON CONFLICT (key) DO UPDATE SET
+		tokens = MIN(?3, tokens + (?4 - update_time) * ?2) - 1,
+		update_time = ?4
+	WHERE MIN(?3, tokens + (?4 - update_time) * ?2) >= 1;
+`
+
+	pruneRateLimitsQuery = `DELETE FROM rate_limits WHERE update_time < ?1;`
+)
+
+// TakeToken takes a token from the bucket for key, which holds up to burst
+// tokens and refills at perSec tokens a second. It reports whether a token
+// was available.
+func (d *DB) TakeToken(key string, perSec float64, burst int, now time.Time) (bool, error) {
+	burst = max(burst, 1)
+
+	res, err := d.sql.Exec(takeTokenQuery, key, perSec, burst, unixSeconds(now))
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+// PruneRateLimits removes buckets that haven't been used since before, they
+// would be full again by now.
+func (d *DB) PruneRateLimits(before time.Time) (int64, error) {
+	res, err := d.sql.Exec(pruneRateLimitsQuery, unixSeconds(before))
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func unixSeconds(t time.Time) float64 {
+	return float64(t.UnixNano()) / float64(time.Second)
+}
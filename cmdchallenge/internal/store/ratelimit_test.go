@@ -0,0 +1,51 @@
+package store
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTakeToken(t *testing.T) {
+	db := newTestDB(t)
+	now := time.Now()
+
+	take := func(key string, at time.Time) bool {
+		ok, err := db.TakeToken(key, 0.5, 2, at)
+		require.NoError(t, err)
+		return ok
+	}
+
+	// The bucket starts full
+	assert.True(t, take("run:1.1.1.1", now))
+	assert.True(t, take("run:1.1.1.1", now))
+	assert.False(t, take("run:1.1.1.1", now))
+	assert.False(t, take("run:1.1.1.1", now.Add(time.Second)))
+
+	// Other clients have their own bucket
+	assert.True(t, take("run:2.2.2.2", now))
+
+	// One token is back after two seconds, the bucket never holds more
+	// than the burst
+	assert.True(t, take("run:1.1.1.1", now.Add(2*time.Second)))
+	assert.False(t, take("run:1.1.1.1", now.Add(2*time.Second)))
+	assert.True(t, take("run:1.1.1.1", now.Add(time.Hour)))
+	assert.True(t, take("run:1.1.1.1", now.Add(time.Hour)))
+	assert.False(t, take("run:1.1.1.1", now.Add(time.Hour)))
+}
+
+func TestPruneRateLimits(t *testing.T) {
+	db := newTestDB(t)
+	now := time.Now()
+
+	_, err := db.TakeToken("run:1.1.1.1", 0.5, 2, now.Add(-2*time.Hour))
+	require.NoError(t, err)
+	_, err = db.TakeToken("run:2.2.2.2", 0.5, 2, now)
+	require.NoError(t, err)
+
+	n, err := db.PruneRateLimits(now.Add(-time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+}
@@ -0,0 +1,167 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+const (
+	createSessionQuery = `INSERT INTO sessions (id, create_time, last_seen_time) VALUES ($1, $2, $2);`
+	touchSessionQuery  = `UPDATE sessions SET last_seen_time = $1 WHERE id = $2;`
+	setHandleQuery     = `UPDATE sessions SET handle = $1 WHERE id = $2;`
+
+	// Keeps the shortest command, the first one sent wins a tie
+	recordProgressQuery = `
+INSERT INTO progress (session_id, slug, version, cmd, cmd_key, update_time) VALUES ($1, $2, $3, $4, $5, $6)
+	ON CONFLICT (session_id, slug, version) DO UPDATE SET
+		cmd = excluded.cmd,
+		cmd_key = excluded.cmd_key,
+		update_time = excluded.update_time
+	WHERE LENGTH(excluded.cmd) < LENGTH(progress.cmd);
+`
+
+	hintsUsedQuery = `SELECT hints FROM hint_usage WHERE session_id = $1 AND slug = $2 AND version = $3;`
+
+	// Hints are revealed in order, so only the number used is kept
+	recordHintsUsedQuery = `
+INSERT INTO hint_usage (session_id, slug, version, hints, update_time) VALUES ($1, $2, $3, $4, $5)
+	ON CONFLICT (session_id, slug, version) DO UPDATE SET
+		hints = excluded.hints,
+		update_time = excluded.update_time
+	WHERE excluded.hints > hint_usage.hints;
+`
+
+	// Sessions not seen since the cutoff that have no progress, handle,
+	// event solves or class membership, hints used are only kept for them
+	idleSessionsCond = `
+	last_seen_time < $1 AND handle IS NULL
+	AND NOT EXISTS (SELECT 1 FROM progress p WHERE p.session_id = sessions.id)
+	AND NOT EXISTS (SELECT 1 FROM event_solves e WHERE e.session_id = sessions.id)
+	AND NOT EXISTS (SELECT 1 FROM class_members m WHERE m.session_id = sessions.id)`
+
+	pruneSessionHintsQuery = `DELETE FROM hint_usage WHERE session_id IN (SELECT id FROM sessions WHERE ` + idleSessionsCond + `);`
+	pruneSessionsQuery     = `DELETE FROM sessions WHERE ` + idleSessionsCond + `;`
+
+	progressQuery = `
+SELECT slug, version, cmd, update_time FROM progress
+	WHERE session_id = $1
+	ORDER BY slug, version;
+`
+)
+
+func (d *DB) CreateSession(id string, now time.Time) error {
+	_, err := d.sql.Exec(createSessionQuery, id, now.Unix())
+	return err
+}
+
+// TouchSession records that a session was used, it returns
+// ErrSessionNotFound for unknown sessions.
+func (d *DB) TouchSession(id string, now time.Time) error {
+	res, err := d.sql.Exec(touchSessionQuery, now.Unix(), id)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+// SetHandle sets the name a session is shown with on leaderboards, handles
+// are unique regardless of case.
+func (d *DB) SetHandle(id, handle string) error {
+	res, err := d.sql.Exec(setHandleQuery, handle, id)
+	if err != nil {
+		if strings.Contains(err.Error(), "UNIQUE constraint failed") {
+			return ErrHandleTaken
+		}
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+func (d *DB) RecordProgress(id string, p *Progress) error {
+	_, err := d.sql.Exec(recordProgressQuery, id, p.Slug, p.Version, p.Cmd, p.CmdKey, p.UpdateTime.Unix())
+	return err
+}
+
+func (d *DB) ProgressForSession(id string) ([]Progress, error) {
+	rows, err := d.sql.Query(progressQuery, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	progress := make([]Progress, 0)
+	for rows.Next() {
+		var p Progress
+		var updateTime int64
+		if err := rows.Scan(&p.Slug, &p.Version, &p.Cmd, &updateTime); err != nil {
+			return nil, err
+		}
+		p.UpdateTime = time.Unix(updateTime, 0)
+		progress = append(progress, p)
+	}
+	return progress, rows.Err()
+}
+
+// HintsUsed returns the number of hints a session revealed for a challenge
+// version.
+func (d *DB) HintsUsed(id, slug string, version int) (int, error) {
+	var n int
+	err := d.sql.QueryRow(hintsUsedQuery, id, slug, version).Scan(&n)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	return n, err
+}
+
+func (d *DB) RecordHintsUsed(id, slug string, version, n int, now time.Time) error {
+	_, err := d.sql.Exec(recordHintsUsedQuery, id, slug, version, n, now.Unix())
+	return err
+}
+
+// PruneSessions removes sessions that weren't seen since before and have
+// nothing to show for it, it returns the number of sessions removed.
+func (d *DB) PruneSessions(before time.Time) (int64, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	tx, err := d.sql.Begin()
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err = tx.Exec(pruneSessionHintsQuery, before.Unix()); err != nil {
+		_ = tx.Rollback()
+		return 0, err
+	}
+
+	res, err := tx.Exec(pruneSessionsQuery, before.Unix())
+	if err != nil {
+		_ = tx.Rollback()
+		return 0, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		_ = tx.Rollback()
+		return 0, err
+	}
+	return n, tx.Commit()
+}
@@ -0,0 +1,101 @@
+package store
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSessionProgress(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+
+	for name, s := range map[string]SessionStorer{
+		"sql": newTestDB(t),
+		"mem": NewMemSessionStore(),
+	} {
+		t.Run(name, func(t *testing.T) {
+			assert.ErrorIs(t, s.TouchSession("abc", now), ErrSessionNotFound)
+
+			require.NoError(t, s.CreateSession("abc", now))
+			require.NoError(t, s.TouchSession("abc", now))
+
+			for _, p := range []Progress{
+				{Slug: "hello_world", Version: 5, Cmd: "echo hello world", UpdateTime: now},
+				{Slug: "hello_world", Version: 5, Cmd: "echo  hello world", UpdateTime: now},
+				{Slug: "hello_world", Version: 5, Cmd: "echo hello  world", UpdateTime: now},
+				{Slug: "hello_world", Version: 4, Cmd: "echo 'hello world'", UpdateTime: now},
+				{Slug: "current_working_directory", Version: 5, Cmd: "pwd", UpdateTime: now},
+			} {
+				require.NoError(t, s.RecordProgress("abc", &p))
+			}
+			require.NoError(t, s.RecordProgress("abc", &Progress{Slug: "hello_world", Version: 5, Cmd: "echo hi", UpdateTime: now}))
+
+			progress, err := s.ProgressForSession("abc")
+			require.NoError(t, err)
+			assert.Equal(t, []Progress{
+				{Slug: "current_working_directory", Version: 5, Cmd: "pwd", UpdateTime: now},
+				{Slug: "hello_world", Version: 4, Cmd: "echo 'hello world'", UpdateTime: now},
+				{Slug: "hello_world", Version: 5, Cmd: "echo hi", UpdateTime: now},
+			}, progress)
+
+			progress, err = s.ProgressForSession("other")
+			require.NoError(t, err)
+			assert.Empty(t, progress)
+		})
+	}
+}
+
+func TestPruneSessions(t *testing.T) {
+	old := time.Unix(1700000000, 0)
+	cutoff := old.Add(time.Hour)
+
+	type sessionEventStorer interface {
+		SessionStorer
+		EventStorer
+	}
+
+	for name, s := range map[string]sessionEventStorer{
+		"sql": newTestDB(t),
+		"mem": NewMemSessionStore(),
+	} {
+		t.Run(name, func(t *testing.T) {
+			for _, id := range []string{"idle", "hints", "progress", "handle", "event", "recent"} {
+				require.NoError(t, s.CreateSession(id, old))
+			}
+			require.NoError(t, s.TouchSession("recent", cutoff))
+			require.NoError(t, s.RecordHintsUsed("hints", "hello_world", 5, 1, old))
+			require.NoError(t, s.RecordProgress("progress", &Progress{Slug: "hello_world", Version: 5, Cmd: "pwd", UpdateTime: old}))
+			require.NoError(t, s.SetHandle("handle", "alice"))
+			require.NoError(t, s.RecordEventSolve("ctf", "event", &EventSolve{Slug: "hello_world", Cmd: "pwd", SolveTime: old}))
+
+			pruned, err := s.PruneSessions(cutoff)
+			require.NoError(t, err)
+			assert.Equal(t, int64(2), pruned)
+
+			for _, id := range []string{"idle", "hints"} {
+				assert.ErrorIs(t, s.TouchSession(id, cutoff), ErrSessionNotFound, id)
+			}
+			for _, id := range []string{"progress", "handle", "event", "recent"} {
+				assert.NoError(t, s.TouchSession(id, cutoff), id)
+			}
+
+			hints, err := s.HintsUsed("hints", "hello_world", 5)
+			require.NoError(t, err)
+			assert.Zero(t, hints)
+		})
+	}
+}
+
+func TestPruneSessionsClassMembers(t *testing.T) {
+	old := time.Unix(1700000000, 0)
+	db := newTestDB(t)
+
+	require.NoError(t, db.CreateSession("student", old))
+	require.NoError(t, db.JoinClass("class", "student", "Alice", old))
+
+	pruned, err := db.PruneSessions(old.Add(time.Hour))
+	require.NoError(t, err)
+	assert.Zero(t, pruned)
+}
@@ -1,8 +1,12 @@
 package store
 
 import (
+	"context"
 	"database/sql"
+	"errors"
+	"fmt"
 	"log/slog"
+	"strings"
 	"sync"
 	"time"
 
@@ -10,10 +14,41 @@ import (
 	"gitlab.com/jarv/cmdchallenge/internal/metrics"
 )
 
+const (
+	maxTopErrors = 5
+)
+
+var cmdsOrder = map[CmdsSort]string{
+	SortPopular:  "count DESC,LENGTH(cmd),cmd",
+	SortShortest: "LENGTH(cmd),count DESC,cmd",
+	SortNewest:   "create_time DESC,cmd",
+}
+
+// Columns added after the initial schema, applied to existing databases.
+// New databases already have them from schemaSQL so the duplicate column
+// error is expected and ignored.
+//
+// Results are looked up by cmd_key, the normalized command, and progress is
+// joined to results on it. Rows created before it was added have no key
+// until BackfillCmdKeys runs.
+var migrationsSQL = []string{
+	`ALTER TABLE challenges ADD COLUMN hidden BOOLEAN NOT NULL DEFAULT 0;`,
+	`ALTER TABLE challenges ADD COLUMN pinned BOOLEAN NOT NULL DEFAULT 0;`,
+	`ALTER TABLE challenges ADD COLUMN cmd_key TEXT DEFAULT NULL;`,
+	`CREATE UNIQUE INDEX IF NOT EXISTS challenges_cmd_key ON challenges(cmd_key, slug, version);`,
+	`ALTER TABLE sessions ADD COLUMN handle TEXT DEFAULT NULL;`,
+	`CREATE UNIQUE INDEX IF NOT EXISTS sessions_handle ON sessions(handle COLLATE NOCASE);`,
+	`ALTER TABLE progress ADD COLUMN cmd_key TEXT DEFAULT NULL;`,
+	`CREATE INDEX IF NOT EXISTS progress_slug_version ON progress(slug, version);`,
+	`ALTER TABLE submissions ADD COLUMN cmd_length INTEGER DEFAULT NULL;`,
+	`ALTER TABLE submissions ADD COLUMN error TEXT DEFAULT NULL;`,
+}
+
 const (
 	insertQuery = `
 INSERT INTO challenges (
 	cmd,
+	cmd_key,
 	slug,
 	version,
 	correct,
@@ -22,8 +57,10 @@ INSERT INTO challenges (
 	output,
 	create_time
 ) VALUES (
-	?, ?, ?, ?, ?, ?, ?, ?
+	?, ?, ?, ?, ?, ?, ?, ?, ?
 )
+	ON CONFLICT (cmd, slug, version) DO UPDATE SET cmd_key = excluded.cmd_key
+	ON CONFLICT DO NOTHING
 `
 	schemaSQL = `
 CREATE TABLE IF NOT EXISTS challenges (
@@ -36,10 +73,94 @@ CREATE TABLE IF NOT EXISTS challenges (
 	output              		TEXT,
 	create_time                 INTEGER,
 	count                       INTEGER DEFAULT 0,
+	hidden                      BOOLEAN NOT NULL DEFAULT 0,
+	pinned                      BOOLEAN NOT NULL DEFAULT 0,
+	cmd_key                     TEXT DEFAULT NULL,
 	PRIMARY KEY (cmd, slug, version)
 );
 CREATE INDEX IF NOT EXISTS challenges_correct ON challenges(correct);
 CREATE INDEX IF NOT EXISTS challenges_slug ON challenges(slug);
+CREATE TABLE IF NOT EXISTS submissions (
+	id                          INTEGER PRIMARY KEY AUTOINCREMENT,
+	slug                        TEXT NOT NULL,
+	version                     INTEGER NOT NULL,
+	cmd_hash                    TEXT NOT NULL,
+	correct                     BOOLEAN NOT NULL,
+	cached                      BOOLEAN NOT NULL,
+	latency_ms                  INTEGER NOT NULL,
+	create_time                 INTEGER NOT NULL,
+	cmd_length                  INTEGER DEFAULT NULL,
+	error                       TEXT DEFAULT NULL
+);
+CREATE INDEX IF NOT EXISTS submissions_slug_create_time ON submissions(slug, create_time);
+CREATE INDEX IF NOT EXISTS submissions_create_time ON submissions(create_time);
+CREATE TABLE IF NOT EXISTS sessions (
+	id                          TEXT PRIMARY KEY,
+	create_time                 INTEGER NOT NULL,
+	last_seen_time              INTEGER NOT NULL,
+	handle                      TEXT DEFAULT NULL
+);
+CREATE TABLE IF NOT EXISTS progress (
+	session_id                  TEXT NOT NULL,
+	slug                        TEXT NOT NULL,
+	version                     INTEGER NOT NULL,
+	cmd                         TEXT NOT NULL,
+	update_time                 INTEGER NOT NULL,
+	cmd_key                     TEXT DEFAULT NULL,
+	PRIMARY KEY (session_id, slug, version)
+);
+CREATE TABLE IF NOT EXISTS hint_usage (
+	session_id                  TEXT NOT NULL,
+	slug                        TEXT NOT NULL,
+	version                     INTEGER NOT NULL,
+	hints                       INTEGER NOT NULL,
+	update_time                 INTEGER NOT NULL,
+	PRIMARY KEY (session_id, slug, version)
+);
+CREATE TABLE IF NOT EXISTS event_solves (
+	event                       TEXT NOT NULL,
+	session_id                  TEXT NOT NULL,
+	slug                        TEXT NOT NULL,
+	cmd                         TEXT NOT NULL,
+	solve_time                  INTEGER NOT NULL,
+	PRIMARY KEY (event, session_id, slug)
+);
+CREATE TABLE IF NOT EXISTS classes (
+	id                          TEXT PRIMARY KEY,
+	name                        TEXT NOT NULL,
+	join_code                   TEXT NOT NULL UNIQUE,
+	instructor_key              TEXT NOT NULL,
+	create_time                 INTEGER NOT NULL
+);
+CREATE TABLE IF NOT EXISTS class_slugs (
+	class_id                    TEXT NOT NULL,
+	slug                        TEXT NOT NULL,
+	PRIMARY KEY (class_id, slug)
+);
+CREATE TABLE IF NOT EXISTS class_members (
+	class_id                    TEXT NOT NULL,
+	session_id                  TEXT NOT NULL,
+	name                        TEXT NOT NULL,
+	join_time                   INTEGER NOT NULL,
+	PRIMARY KEY (class_id, session_id)
+);
+CREATE UNIQUE INDEX IF NOT EXISTS class_members_name ON class_members(class_id, name COLLATE NOCASE);
+CREATE INDEX IF NOT EXISTS class_members_session ON class_members(session_id);
+CREATE TABLE IF NOT EXISTS class_attempts (
+	class_id                    TEXT NOT NULL,
+	session_id                  TEXT NOT NULL,
+	slug                        TEXT NOT NULL,
+	cmd                         TEXT NOT NULL,
+	solved                      BOOLEAN NOT NULL,
+	attempts                    INTEGER NOT NULL,
+	update_time                 INTEGER NOT NULL,
+	PRIMARY KEY (class_id, session_id, slug)
+);
+CREATE TABLE IF NOT EXISTS rate_limits (
+	key                         TEXT PRIMARY KEY,
+	tokens                      REAL NOT NULL,
+	update_time                 REAL NOT NULL
+);
 `
 
 	resultQuery = `
@@ -48,21 +169,125 @@ SELECT
 	error,
 	exit_code,
 	output FROM challenges
-		WHERE cmd=$1 AND slug=$2 AND version=$3;
+		WHERE cmd_key=$1 AND slug=$2 AND version=$3;
 `
 
+	// The ORDER BY clause is filled in from cmdsOrder
 	cmdsQuery = `
+SELECT
+	cmd,
+	count,
+	LENGTH(cmd)
+	FROM challenges
+		WHERE slug=$1 AND correct=1 AND hidden=0 AND version = (SELECT MAX(version) from challenges where slug=$1)
+		ORDER BY pinned DESC,%s LIMIT $2 OFFSET $3;
+`
+
+	statsQuery = `
+SELECT
+	COUNT(*),
+	COUNT(DISTINCT cmd_hash),
+	COALESCE(SUM(correct), 0)
+	FROM submissions
+		WHERE slug=$1 AND version=$2;
+`
+
+	// Weighted by attempts, submissions logged before the length was
+	// recorded are left out
+	medianLengthQuery = `
+SELECT
+	cmd_length
+	FROM submissions
+		WHERE slug=$1 AND version=$2 AND cmd_length IS NOT NULL
+		ORDER BY cmd_length LIMIT 1 OFFSET (
+			SELECT (COUNT(*)-1)/2 FROM submissions WHERE slug=$1 AND version=$2 AND cmd_length IS NOT NULL
+		);
+`
+
+	topErrorsQuery = `
+SELECT
+	error,
+	COUNT(*)
+	FROM submissions
+		WHERE slug=$1 AND version=$2 AND correct=0 AND error IS NOT NULL
+		GROUP BY error
+		ORDER BY COUNT(*) DESC, error LIMIT $3;
+`
+
+	previousVersionQuery = `
+SELECT
+	MAX(version)
+	FROM challenges
+		WHERE slug=$1 AND version < $2;
+`
+
+	correctCmdsForVersionQuery = `
 SELECT
 	cmd
 	FROM challenges
-		WHERE slug=$1 AND correct=1 AND version = (SELECT MAX(version) from challenges where slug=$1)
-		ORDER BY count DESC,LENGTH(cmd) LIMIT 50;
+		WHERE slug=$1 AND version=$2 AND correct=1 AND hidden=0
+		ORDER BY pinned DESC,count DESC,LENGTH(cmd) LIMIT $3;
+`
+
+	moderateQuery = `
+UPDATE challenges
+	SET hidden = COALESCE($1, hidden), pinned = COALESCE($2, pinned)
+		WHERE cmd=$3 AND slug=$4 AND version=$5
 `
 
 	incrementQuery = `
  UPDATE challenges
  	SET count = count + 1
-		WHERE cmd=$1 AND slug=$2 AND version=$3
+		WHERE cmd_key=$1 AND slug=$2 AND version=$3
+`
+
+	incrementByQuery = `
+ UPDATE challenges
+ 	SET count = count + $1
+		WHERE cmd_key=$2 AND slug=$3 AND version=$4
+`
+
+	insertSubmissionQuery = `
+INSERT INTO submissions (
+	slug,
+	version,
+	cmd_hash,
+	correct,
+	cached,
+	latency_ms,
+	create_time,
+	cmd_length,
+	error
+) VALUES (
+	?, ?, ?, ?, ?, ?, ?, ?, ?
+)
+`
+
+	nullCmdKeysQuery = `
+SELECT rowid, cmd FROM challenges
+	WHERE cmd_key IS NULL AND rowid > $1
+	ORDER BY rowid LIMIT $2
+`
+
+	// Commands that normalize to the key of another row keep a NULL key,
+	// the row that already has the key is the one that is looked up
+	setCmdKeyQuery = `
+UPDATE OR IGNORE challenges SET cmd_key = $1 WHERE rowid = $2
+`
+
+	nullProgressCmdKeysQuery = `
+SELECT rowid, cmd FROM progress
+	WHERE cmd_key IS NULL AND rowid > $1
+	ORDER BY rowid LIMIT $2
+`
+
+	setProgressCmdKeyQuery = `
+UPDATE progress SET cmd_key = $1 WHERE rowid = $2
+`
+
+	pruneSubmissionsQuery = `
+DELETE FROM submissions
+	WHERE create_time < $1
 `
 )
 
@@ -72,6 +297,7 @@ type DB struct {
 	sql           *sql.DB
 	insertStmt    *sql.Stmt
 	incrementStmt *sql.Stmt
+	submitStmt    *sql.Stmt
 }
 
 func NewSQLStore(log *slog.Logger, cmdMetrics *metrics.Metrics, dbFile string) (*DB, error) {
@@ -88,23 +314,37 @@ func NewSQLStore(log *slog.Logger, cmdMetrics *metrics.Metrics, dbFile string) (
 		}
 	}
 
-	log.Info("Peparing insertQuery", "dbFile", dbFile)
+	log.Info("Migrating db", "dbFile", dbFile)
+	for _, m := range migrationsSQL {
+		if _, err = sqlDB.Exec(m); err != nil && !strings.Contains(err.Error(), "duplicate column name") {
+			return nil, err
+		}
+	}
+
+	log.Info("Preparing insertQuery", "dbFile", dbFile)
 	insertStmt, err := sqlDB.Prepare(insertQuery)
 	if err != nil {
 		return nil, err
 	}
 
-	log.Info("Peparing incrementQuery", "dbFile", dbFile)
+	log.Info("Preparing incrementQuery", "dbFile", dbFile)
 	incrementStmt, err := sqlDB.Prepare(incrementQuery)
 	if err != nil {
 		return nil, err
 	}
 
+	log.Info("Preparing insertSubmissionQuery", "dbFile", dbFile)
+	submitStmt, err := sqlDB.Prepare(insertSubmissionQuery)
+	if err != nil {
+		return nil, err
+	}
+
 	db := DB{
 		log:           log,
 		sql:           sqlDB,
 		insertStmt:    insertStmt,
 		incrementStmt: incrementStmt,
+		submitStmt:    submitStmt,
 	}
 
 	cmdMetrics.DBStatsRegister(sqlDB, "command")
@@ -112,26 +352,108 @@ func NewSQLStore(log *slog.Logger, cmdMetrics *metrics.Metrics, dbFile string) (
 	return &db, nil
 }
 
-func (d *DB) TopCmdsForSlug(slug string) ([]string, error) {
-	var cmd string
-	cmds := make([]string, 0)
+// BackfillCmdKeys sets the cmd_key of results and progress stored before
+// commands were normalized, so they are found by lookups and joins that use
+// the key. It returns the number of rows that were given a key.
+func (d *DB) BackfillCmdKeys(normalize func(string) string) (int64, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var total int64
+	for _, q := range []struct{ nullKeys, setKey string }{
+		{nullCmdKeysQuery, setCmdKeyQuery},
+		{nullProgressCmdKeysQuery, setProgressCmdKeyQuery},
+	} {
+		n, err := d.backfillKeys(q.nullKeys, q.setKey, normalize)
+		total += n
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+// backfillKeys sets the key of the rows returned by nullKeysQuery with
+// setKeyQuery in batches, the caller holds the lock.
+func (d *DB) backfillKeys(nullKeysQuery, setKeyQuery string, normalize func(string) string) (int64, error) {
+	const batchSize = 1000
+
+	var total, lastID int64
+	for {
+		type nullKey struct {
+			id  int64
+			cmd string
+		}
+		batch := make([]nullKey, 0, batchSize)
+
+		rows, err := d.sql.Query(nullKeysQuery, lastID, batchSize)
+		if err != nil {
+			return total, err
+		}
+		for rows.Next() {
+			var k nullKey
+			if err := rows.Scan(&k.id, &k.cmd); err != nil {
+				rows.Close()
+				return total, err
+			}
+			batch = append(batch, k)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return total, err
+		}
+		if len(batch) == 0 {
+			return total, nil
+		}
+
+		tx, err := d.sql.Begin()
+		if err != nil {
+			return total, err
+		}
+		for _, k := range batch {
+			res, err := tx.Exec(setKeyQuery, normalize(k.cmd), k.id)
+			if err != nil {
+				_ = tx.Rollback()
+				return total, err
+			}
+			n, _ := res.RowsAffected()
+			total += n
+		}
+		if err := tx.Commit(); err != nil {
+			return total, err
+		}
+		lastID = batch[len(batch)-1].id
+	}
+}
+
+func (d *DB) TopCmdsForSlug(q CmdsQuery) ([]Solution, error) {
+	var sol Solution
+	solutions := make([]Solution, 0)
 
 	d.log.Info("Running TopCmds Query",
-		"slug", slug,
+		"slug", q.Slug,
+		"sort", q.Sort,
+		"limit", q.Limit,
+		"offset", q.Offset,
 	)
 
-	rows, err := d.sql.Query(cmdsQuery, slug)
+	order, ok := cmdsOrder[q.Sort]
+	if !ok {
+		return nil, ErrInvalidSort
+	}
+
+	rows, err := d.sql.Query(fmt.Sprintf(cmdsQuery, order), q.Slug, q.Limit, q.Offset)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
 	for rows.Next() {
-		err = rows.Scan(&cmd)
+		err = rows.Scan(&sol.Cmd, &sol.Count, &sol.Length)
 		if err != nil {
 			return nil, err
 		}
-		cmds = append(cmds, cmd)
+		solutions = append(solutions, sol)
 	}
 
 	err = rows.Err()
@@ -139,10 +461,93 @@ func (d *DB) TopCmdsForSlug(slug string) ([]string, error) {
 		return nil, err
 	}
 
+	return solutions, nil
+}
+
+func (d *DB) PreviousVersion(slug string, version int) (int, error) {
+	var prev sql.NullInt64
+	if err := d.sql.QueryRow(previousVersionQuery, slug, version).Scan(&prev); err != nil {
+		return 0, err
+	}
+	if !prev.Valid {
+		return 0, ErrResultNotFound
+	}
+	return int(prev.Int64), nil
+}
+
+func (d *DB) CorrectCmdsForVersion(slug string, version, limit int) ([]string, error) {
+	var cmd string
+	cmds := make([]string, 0)
+
+	rows, err := d.sql.Query(correctCmdsForVersionQuery, slug, version, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		if err = rows.Scan(&cmd); err != nil {
+			return nil, err
+		}
+		cmds = append(cmds, cmd)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
 	return cmds, nil
 }
 
-func (d *DB) GetResult(cmd, slug string, version int) (*CmdStore, error) {
+func (d *DB) StatsForSlug(slug string, version int) (*SlugStats, error) {
+	d.log.Info("Running Stats Query",
+		"slug", slug,
+		"version", version,
+	)
+
+	stats := SlugStats{Slug: slug, Version: version, TopErrors: make([]ErrorCount, 0)}
+
+	var correct int
+	if err := d.sql.QueryRow(statsQuery, slug, version).Scan(
+		&stats.Attempts,
+		&stats.UniqueCmds,
+		&correct,
+	); err != nil {
+		return nil, err
+	}
+
+	if stats.Attempts == 0 {
+		return &stats, nil
+	}
+	stats.CorrectRate = float64(correct) / float64(stats.Attempts)
+
+	err := d.sql.QueryRow(medianLengthQuery, slug, version).Scan(&stats.MedianCmdLength)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	rows, err := d.sql.Query(topErrorsQuery, slug, version, maxTopErrors)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var e ErrorCount
+		if err = rows.Scan(&e.Error, &e.Count); err != nil {
+			return nil, err
+		}
+		stats.TopErrors = append(stats.TopErrors, e)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return &stats, nil
+}
+
+func (d *DB) GetResult(cmdKey, slug string, version int) (*CmdStore, error) {
 	var s struct {
 		output   sql.NullString
 		exitCode sql.NullInt32
@@ -150,7 +555,7 @@ func (d *DB) GetResult(cmd, slug string, version int) (*CmdStore, error) {
 		errorStr sql.NullString
 	}
 
-	row := d.sql.QueryRow(resultQuery, cmd, slug, version)
+	row := d.sql.QueryRow(resultQuery, cmdKey, slug, version)
 
 	switch err := row.Scan(
 		&s.correct,
@@ -174,7 +579,7 @@ func (d *DB) GetResult(cmd, slug string, version int) (*CmdStore, error) {
 	}
 }
 
-func (d *DB) IncrementResult(cmd, slug string, version int) error {
+func (d *DB) IncrementResult(cmdKey, slug string, version int) error {
 	d.mu.Lock()
 	defer d.mu.Unlock()
 
@@ -183,7 +588,7 @@ func (d *DB) IncrementResult(cmd, slug string, version int) error {
 		return err
 	}
 
-	_, err = tx.Stmt(d.incrementStmt).Exec(cmd, slug, version)
+	_, err = tx.Stmt(d.incrementStmt).Exec(cmdKey, slug, version)
 	if err != nil {
 		_ = tx.Rollback()
 		return err
@@ -191,6 +596,32 @@ func (d *DB) IncrementResult(cmd, slug string, version int) error {
 	return tx.Commit()
 }
 
+// IncrementResults applies many increments in a single transaction.
+func (d *DB) IncrementResults(counts map[ResultKey]int) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	tx, err := d.sql.Begin()
+	if err != nil {
+		return err
+	}
+
+	stmt, err := tx.Prepare(incrementByQuery)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	defer stmt.Close()
+
+	for key, n := range counts {
+		if _, err = stmt.Exec(n, key.CmdKey, key.Slug, key.Version); err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
 func (d *DB) CreateResult(s *CmdStore) error {
 	d.log.Info("Writing result to DB",
 		"slug", s.Slug,
@@ -206,6 +637,7 @@ func (d *DB) CreateResult(s *CmdStore) error {
 	createTime := time.Now().Unix()
 	_, err = tx.Stmt(d.insertStmt).Exec(
 		s.Cmd,
+		s.CmdKey,
 		s.Slug,
 		s.Version,
 		s.Correct,
@@ -221,6 +653,87 @@ func (d *DB) CreateResult(s *CmdStore) error {
 	return tx.Commit()
 }
 
+func (d *DB) ModerateResult(cmd, slug string, version int, m Moderation) error {
+	d.log.Info("Moderating result",
+		"slug", slug,
+		"cmd", cmd,
+		"version", version)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	res, err := d.sql.Exec(moderateQuery, m.Hidden, m.Pinned, cmd, slug, version)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrResultNotFound
+	}
+	return nil
+}
+
+func (d *DB) CreateSubmission(s *Submission) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	tx, err := d.sql.Begin()
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Stmt(d.submitStmt).Exec(
+		s.Slug,
+		s.Version,
+		s.CmdHash,
+		s.Correct,
+		s.Cached,
+		s.Latency.Milliseconds(),
+		s.CreateTime.Unix(),
+		s.CmdLength,
+		sql.NullString{String: s.Error, Valid: s.Error != ""},
+	)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func (d *DB) PruneSubmissions(before time.Time) (int64, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	res, err := d.sql.Exec(pruneSubmissionsQuery, before.Unix())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// Ping checks that the database is responding.
+func (d *DB) Ping(ctx context.Context) error {
+	return d.sql.PingContext(ctx)
+}
+
+// Close waits for pending writes and closes the database.
+func (d *DB) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.log.Info("Closing db")
+	return errors.Join(
+		d.insertStmt.Close(),
+		d.incrementStmt.Close(),
+		d.submitStmt.Close(),
+		d.sql.Close(),
+	)
+}
+
 type ptrConvert interface {
 	int
 }
@@ -0,0 +1,46 @@
+package store
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackfillCmdKeys(t *testing.T) {
+	db := newTestDB(t)
+	createTestResults(t, db)
+
+	// Results stored before commands were normalized have no key
+	for _, cmd := range []string{"echo  hi", "echo hi ", "ls"} {
+		_, err := db.sql.Exec(
+			"INSERT INTO challenges (cmd, slug, version, correct, create_time) VALUES ($1, 'hello_world', 5, 0, 0)", cmd)
+		require.NoError(t, err)
+	}
+
+	// So does progress, which is joined to the results on the key
+	_, err := db.sql.Exec(
+		"INSERT INTO progress (session_id, slug, version, cmd, update_time) VALUES ('a', 'hello_world', 5, 'echo  hi', 0)")
+	require.NoError(t, err)
+
+	normalize := func(cmd string) string { return strings.Join(strings.Fields(cmd), " ") }
+	n, err := db.BackfillCmdKeys(normalize)
+	require.NoError(t, err)
+	// Both spellings of echo hi normalize to the same key, only one result
+	// gets it
+	assert.Equal(t, int64(3), n)
+
+	for _, key := range []string{"echo hi", "ls", "echo hello world"} {
+		_, err := db.GetResult(key, "hello_world", 5)
+		assert.NoError(t, err, key)
+	}
+
+	var progressKey string
+	require.NoError(t, db.sql.QueryRow("SELECT cmd_key FROM progress WHERE session_id = 'a'").Scan(&progressKey))
+	assert.Equal(t, "echo hi", progressKey)
+
+	n, err = db.BackfillCmdKeys(normalize)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), n)
+}
@@ -0,0 +1,53 @@
+package store
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatsForSlug(t *testing.T) {
+	mem, err := NewMemStore()
+	require.NoError(t, err)
+
+	for name, s := range map[string]CmdStorer{"sql": newTestDB(t), "mem": mem} {
+		t.Run(name, func(t *testing.T) {
+			now := time.Now()
+			for _, sub := range []Submission{
+				{CmdHash: "a", CmdLength: 16, Correct: true},
+				{CmdHash: "a", CmdLength: 16, Correct: true, Cached: true},
+				{CmdHash: "b", CmdLength: 4, Error: "Output does not match expected lines"},
+				{CmdHash: "c", CmdLength: 40, Error: "Output does not match expected lines"},
+				{CmdHash: "d", CmdLength: 2, Error: "timed out"},
+			} {
+				sub := sub
+				sub.Slug, sub.Version, sub.CreateTime = "hello_world", 5, now
+				require.NoError(t, s.CreateSubmission(&sub))
+			}
+			// Other versions aren't counted
+			require.NoError(t, s.CreateSubmission(&Submission{Slug: "hello_world", Version: 4, CmdHash: "a", CmdLength: 1, CreateTime: now}))
+
+			stats, err := s.StatsForSlug("hello_world", 5)
+			require.NoError(t, err)
+			assert.Equal(t, &SlugStats{
+				Slug:        "hello_world",
+				Version:     5,
+				Attempts:    5,
+				UniqueCmds:  4,
+				CorrectRate: 0.4,
+				// Weighted by attempts: 2, 4, 16, 16, 40
+				MedianCmdLength: 16,
+				TopErrors: []ErrorCount{
+					{Error: "Output does not match expected lines", Count: 2},
+					{Error: "timed out", Count: 1},
+				},
+			}, stats)
+
+			stats, err = s.StatsForSlug("hello_world", 6)
+			require.NoError(t, err)
+			assert.Equal(t, &SlugStats{Slug: "hello_world", Version: 6, TopErrors: []ErrorCount{}}, stats)
+		})
+	}
+}
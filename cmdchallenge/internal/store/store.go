@@ -1,7 +1,13 @@
 package store
 
+import (
+	"context"
+	"time"
+)
+
 type CmdStore struct {
 	Cmd      *string
+	CmdKey   *string // normalized command used for lookups
 	Slug     *string
 	Version  *int
 	Correct  *bool
@@ -10,9 +16,210 @@ type CmdStore struct {
 	Output   *string
 }
 
+// Submission is a single attempt at a challenge, recorded in the
+// append-only submissions log regardless of whether the result was cached.
+// Error is the failed check of an incorrect result, if any.
+type Submission struct {
+	Slug       string
+	Version    int
+	CmdHash    string
+	CmdLength  int
+	Correct    bool
+	Cached     bool
+	Error      string
+	Latency    time.Duration
+	CreateTime time.Time
+}
+
+type CmdsSort string
+
+const (
+	SortPopular  CmdsSort = "popular"
+	SortShortest CmdsSort = "shortest"
+	SortNewest   CmdsSort = "newest"
+)
+
+// CmdsQuery selects a page of correct commands for the latest version of a
+// challenge.
+type CmdsQuery struct {
+	Slug   string
+	Sort   CmdsSort
+	Limit  int
+	Offset int
+}
+
+// Solution is a published correct command.
+type Solution struct {
+	Cmd    string
+	Count  int
+	Length int
+}
+
+// Moderation changes the visibility of a stored result in the published
+// solutions, nil fields are left unchanged.
+type Moderation struct {
+	Hidden *bool
+	Pinned *bool
+}
+
+// SlugStats summarizes the submissions for a version of a challenge that are
+// still within the retention.
+type SlugStats struct {
+	Slug            string
+	Version         int
+	Attempts        int
+	UniqueCmds      int
+	CorrectRate     float64
+	MedianCmdLength int
+	TopErrors       []ErrorCount
+}
+
+// DailyStats summarizes the commands sent for a challenge in a time range.
+// Shortest is the shortest solution recorded by a session in the range.
+type DailyStats struct {
+	Attempts int
+	Solves   int
+	Shortest string
+}
+
+type ErrorCount struct {
+	Error string
+	Count int
+}
+
 type CmdStorer interface {
-	GetResult(cmd, slug string, version int) (*CmdStore, error)
+	GetResult(cmdKey, slug string, version int) (*CmdStore, error)
 	CreateResult(s *CmdStore) error
-	IncrementResult(cmd, slug string, version int) error
-	TopCmdsForSlug(slug string) ([]string, error)
+	IncrementResult(cmdKey, slug string, version int) error
+	TopCmdsForSlug(q CmdsQuery) ([]Solution, error)
+	StatsForSlug(slug string, version int) (*SlugStats, error)
+	DailyStatsForSlug(slug string, version int, start, end time.Time) (*DailyStats, error)
+	ModerateResult(cmd, slug string, version int, m Moderation) error
+	PreviousVersion(slug string, version int) (int, error)
+	CorrectCmdsForVersion(slug string, version, limit int) ([]string, error)
+	CreateSubmission(s *Submission) error
+	PruneSubmissions(before time.Time) (int64, error)
+	Ping(ctx context.Context) error
+	Close() error
+}
+
+// Progress is the best command of a session for a challenge version, the
+// shortest correct command it has sent.
+type Progress struct {
+	Slug       string
+	Version    int
+	Cmd        string
+	CmdKey     string
+	UpdateTime time.Time
+}
+
+// SessionStorer keeps anonymous player sessions and their progress.
+// Sessions are identified by a hash of the token given to the player, the
+// token itself is never stored.
+type SessionStorer interface {
+	CreateSession(id string, now time.Time) error
+	TouchSession(id string, now time.Time) error
+	SetHandle(id, handle string) error
+	RecordProgress(id string, p *Progress) error
+	ProgressForSession(id string) ([]Progress, error)
+	HintsUsed(id, slug string, version int) (int, error)
+	RecordHintsUsed(id, slug string, version, n int, now time.Time) error
+	PruneSessions(before time.Time) (int64, error)
+}
+
+// SlugVersion is a version of a challenge.
+type SlugVersion struct {
+	Slug    string
+	Version int
+}
+
+// LeaderboardEntry is the best command of a player for a challenge version.
+// Score is the length of the command plus the penalty for the hints used.
+type LeaderboardEntry struct {
+	Handle     string
+	Cmd        string
+	Length     int
+	Hints      int
+	Score      int
+	SolvedTime time.Time
+}
+
+// OverallEntry summarizes the best commands of a player for all challenges.
+type OverallEntry struct {
+	Handle         string
+	Solved         int
+	TotalLength    int
+	Hints          int
+	Score          int
+	LastSolvedTime time.Time
+}
+
+// LeaderboardStorer ranks the progress of sessions that have a handle, each
+// hint used for a challenge adds hintPenalty to the length of its command.
+// Progress with a hidden result is left out.
+type LeaderboardStorer interface {
+	SlugLeaderboard(slug string, version, hintPenalty, limit int) ([]LeaderboardEntry, error)
+	OverallLeaderboard(versions []SlugVersion, hintPenalty, limit int) ([]OverallEntry, error)
+}
+
+// EventSolve is the first correct command of a session for a challenge of
+// an event. Cmd is the shortest correct command sent during the event.
+type EventSolve struct {
+	Handle    string
+	Slug      string
+	Cmd       string
+	SolveTime time.Time
+}
+
+// EventStorer keeps the solves of sessions in timed events, solves are only
+// returned for sessions that have a handle.
+type EventStorer interface {
+	RecordEventSolve(event, id string, s *EventSolve) error
+	EventSolves(event string) ([]EventSolve, error)
+}
+
+// Class is a group of students assigned a set of challenges. Only a hash of
+// the instructor token is kept, like session tokens.
+type Class struct {
+	ID            string
+	Name          string
+	JoinCode      string
+	InstructorKey string
+	Slugs         []string
+	CreateTime    time.Time
+}
+
+// ClassAttempt is the last command a student sent for a challenge of a
+// class, Solved is set once any of their commands was correct.
+type ClassAttempt struct {
+	Slug       string
+	Cmd        string
+	Solved     bool
+	Attempts   int
+	UpdateTime time.Time
+}
+
+// ClassStudent is a session that joined a class under a name.
+type ClassStudent struct {
+	Name     string
+	JoinTime time.Time
+	Attempts []ClassAttempt
+}
+
+// ClassStorer keeps classes, their students and the attempts of students
+// for the challenges assigned to the class.
+type ClassStorer interface {
+	CreateClass(c *Class) error
+	ClassByID(id string) (*Class, error)
+	ClassByJoinCode(code string) (*Class, error)
+	JoinClass(classID, sessionID, name string, now time.Time) error
+	RecordClassAttempt(sessionID, slug, cmd string, correct bool, now time.Time) error
+	ClassStudents(classID string) ([]ClassStudent, error)
+}
+
+// RateLimitStorer keeps token buckets for rate limits that are shared by
+// every server using the same store.
+type RateLimitStorer interface {
+	TakeToken(key string, perSec float64, burst int, now time.Time) (bool, error)
+	PruneRateLimits(before time.Time) (int64, error)
 }
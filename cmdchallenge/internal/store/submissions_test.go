@@ -0,0 +1,46 @@
+package store
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubmissions(t *testing.T) {
+	db := newTestDB(t)
+	now := time.Unix(1700000000, 0)
+
+	require.NoError(t, db.CreateSubmission(&Submission{
+		Slug:       "hello_world",
+		Version:    5,
+		CmdHash:    "abc",
+		Correct:    true,
+		Cached:     true,
+		Latency:    1500 * time.Millisecond,
+		CreateTime: now.Add(-48 * time.Hour),
+	}))
+	require.NoError(t, db.CreateSubmission(&Submission{Slug: "hello_world", Version: 5, CmdHash: "def", CreateTime: now}))
+
+	var s Submission
+	var latencyMs, createTime int64
+	require.NoError(t, db.sql.QueryRow(
+		"SELECT slug, version, cmd_hash, correct, cached, latency_ms, create_time FROM submissions WHERE cmd_hash = 'abc'",
+	).Scan(&s.Slug, &s.Version, &s.CmdHash, &s.Correct, &s.Cached, &latencyMs, &createTime))
+	assert.Equal(t, Submission{Slug: "hello_world", Version: 5, CmdHash: "abc", Correct: true, Cached: true}, s)
+	assert.Equal(t, int64(1500), latencyMs)
+	assert.Equal(t, now.Add(-48*time.Hour).Unix(), createTime)
+
+	pruned, err := db.PruneSubmissions(now.Add(-24 * time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), pruned)
+
+	// Submissions at the cutoff are kept
+	pruned, err = db.PruneSubmissions(now)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), pruned)
+	pruned, err = db.PruneSubmissions(now.Add(time.Second))
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), pruned)
+}
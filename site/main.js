@@ -270,7 +270,10 @@ const sendCommand = function (command) {
       processResp($.parseJSON(resp))
     },
     error: function (resp) {
-      const output = resp.responseText || 'Unknown Error :('
+      let output = resp.responseText || 'Unknown Error :('
+      try {
+        output = $.parseJSON(resp.responseText).error.message
+      } catch (e) {}
       retCode = '☠️'
       updateInfoText(
         output,